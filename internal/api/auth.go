@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"kb-freelance-api/internal/logging"
+	"kb-freelance-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyHeader is an alternative to "Authorization: Bearer <key>".
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyContextKey holds the authenticated *services.APIKey in the gin
+// context.
+const apiKeyContextKey = "api_key"
+
+// authenticate rejects requests without a valid API key when
+// config.AuthRequired is set, and otherwise acts on behalf of the key's
+// user. The key is taken from the Authorization bearer token or the
+// X-API-Key header. With authentication disabled every request acts for
+// the default user.
+func (s *Server) authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.config.AuthRequired {
+			return
+		}
+
+		key, err := s.apiKeyService.Authenticate(c.Request.Context(), requestAPIKey(c.Request))
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="kb-freelance-api"`)
+			respondError(c, err)
+			return
+		}
+
+		c.Set(apiKeyContextKey, key)
+		logger := logging.FromContext(c.Request.Context()).With("api_key", key.Prefix, "user_id", key.UserID)
+		ctx := logging.NewContext(c.Request.Context(), logger)
+		c.Request = c.Request.WithContext(services.WithUser(ctx, key.UserID))
+	}
+}
+
+// requireScope rejects requests whose API key does not grant scope.
+func (s *Server) requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.config.AuthRequired {
+			return
+		}
+
+		key := c.MustGet(apiKeyContextKey).(*services.APIKey)
+		if !key.HasScope(scope) {
+			err := services.WithDetails(services.ErrForbidden, map[string]interface{}{"scope": scope})
+			respondError(c, err)
+		}
+	}
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
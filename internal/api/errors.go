@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"kb-freelance-api/internal/logging"
+	"kb-freelance-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// kindStatus is the HTTP status code for each kind of service error.
+var kindStatus = map[services.ErrorKind]int{
+	services.KindValidation:     http.StatusBadRequest,
+	services.KindUnauthorized:   http.StatusUnauthorized,
+	services.KindForbidden:      http.StatusForbidden,
+	services.KindNotFound:       http.StatusNotFound,
+	services.KindConflict:       http.StatusConflict,
+	services.KindUnprocessable:  http.StatusUnprocessableEntity,
+	services.KindUpstream:       http.StatusBadGateway,
+	services.KindTimeout:        http.StatusGatewayTimeout,
+	services.KindUnavailable:    http.StatusServiceUnavailable,
+	services.KindNotImplemented: http.StatusNotImplemented,
+}
+
+var (
+	errInvalidRequest = &services.Error{Kind: services.KindValidation, Code: "invalid_request", Message: "invalid request"}
+	errRouteNotFound  = &services.Error{Kind: services.KindNotFound, Code: "route_not_found", Message: "no such endpoint"}
+	errFileNotFound   = &services.Error{Kind: services.KindNotFound, Code: "file_not_found", Message: "file not found"}
+)
+
+// ErrorBody is the error member of a failed response:
+// {"success": false, "error": {"code": ..., "message": ..., "details": {...}}}
+type ErrorBody struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details"`
+}
+
+// errorStatus returns the HTTP status code for err.
+func errorStatus(err error) int {
+	var serviceErr *services.Error
+	if errors.As(err, &serviceErr) {
+		if status, ok := kindStatus[serviceErr.Kind]; ok {
+			return status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// respondError writes err in the error envelope. Only the parts of err
+// that are safe for clients are sent; errors that may hold CLI output,
+// tracebacks or file paths are logged in full instead.
+func respondError(c *gin.Context, err error) {
+	body := ErrorBody{
+		Code:    "internal_error",
+		Message: services.ClientMessage(err),
+		Details: services.ErrorDetails(err),
+	}
+
+	var serviceErr *services.Error
+	if errors.As(err, &serviceErr) {
+		body.Code = serviceErr.Code
+	}
+
+	status := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		logging.FromContext(c.Request.Context()).Error("request failed", "method", c.Request.Method, "path", c.Request.URL.Path, "status", status, "error", err)
+	}
+	c.AbortWithStatusJSON(status, gin.H{"success": false, "error": body})
+}
+
+// respondInvalidRequest reports a request body or parameter that could not
+// be parsed. Validation failures list the offending fields in the details.
+func respondInvalidRequest(c *gin.Context, err error) {
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		respondError(c, invalidRequest(err.Error()))
+		return
+	}
+
+	fields := map[string]string{}
+	names := make([]string, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		name := jsonFieldName(fieldErr.Field())
+		fields[name] = fieldErr.Tag()
+		names = append(names, name)
+	}
+	err = invalidRequest("invalid " + strings.Join(names, ", "))
+	respondError(c, services.WithDetails(err, map[string]interface{}{"fields": fields}))
+}
+
+// invalidRequest returns a validation error described by message.
+func invalidRequest(message string) error {
+	return fmt.Errorf("%w: %s", errInvalidRequest, message)
+}
+
+// jsonFieldName converts a request struct field name such as ClientEmail
+// to its JSON name, client_email.
+func jsonFieldName(field string) string {
+	var name strings.Builder
+	for i, r := range field {
+		if 'A' <= r && r <= 'Z' {
+			if i > 0 {
+				name.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		name.WriteRune(r)
+	}
+	return name.String()
+}
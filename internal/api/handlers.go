@@ -1,32 +1,59 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"kb-freelance-api/internal/services"
+	"kb-freelance-api/internal/store"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Time tracking handlers
 
+// StartTimerRequest names the client directly or by the ID of a registered
+// client. The project must be registered and active unless AllowAnyProject
+// is set.
 type StartTimerRequest struct {
-	Client      string `json:"client" binding:"required"`
-	Project     string `json:"project" binding:"required"`
-	Description string `json:"description"`
+	Client          string `json:"client" binding:"required_without=ClientID"`
+	ClientID        int    `json:"client_id"`
+	Project         string `json:"project" binding:"required"`
+	Description     string `json:"description"`
+	AllowAnyProject bool   `json:"allow_any_project"`
 }
 
 func (s *Server) startTimer(c *gin.Context) {
 	var req StartTimerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		respondInvalidRequest(c, err)
 		return
 	}
 
-	result, err := s.timeTrackerService.StartTimer(req.Client, req.Project, req.Description)
+	client, ok := s.entryClient(c, req.ClientID, req.Client)
+	if !ok {
+		return
+	}
+	// The project is checked and recorded under the same name
+	project := strings.TrimSpace(req.Project)
+	if !req.AllowAnyProject {
+		if err := s.projectService.CheckTimerProject(c.Request.Context(), project); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	result, err := s.timeTrackerService.StartTimer(c.Request.Context(), client, project, req.Description)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -34,9 +61,60 @@ func (s *Server) startTimer(c *gin.Context) {
 }
 
 func (s *Server) stopTimer(c *gin.Context) {
-	result, err := s.timeTrackerService.StopTimer()
+	result, err := s.timeTrackerService.StopTimer(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// switchTimer takes the same request as startTimer, for the task to switch
+// to.
+func (s *Server) switchTimer(c *gin.Context) {
+	var req StartTimerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	client, ok := s.entryClient(c, req.ClientID, req.Client)
+	if !ok {
+		return
+	}
+	// The project is checked and recorded under the same name
+	project := strings.TrimSpace(req.Project)
+	if !req.AllowAnyProject {
+		if err := s.projectService.CheckTimerProject(c.Request.Context(), project); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	result, err := s.timeTrackerService.SwitchTimer(c.Request.Context(), client, project, req.Description)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+func (s *Server) pauseTimer(c *gin.Context) {
+	result, err := s.timeTrackerService.PauseTimer(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+func (s *Server) resumeTimer(c *gin.Context) {
+	result, err := s.timeTrackerService.ResumeTimer(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -44,9 +122,9 @@ func (s *Server) stopTimer(c *gin.Context) {
 }
 
 func (s *Server) getTimerStatus(c *gin.Context) {
-	status, err := s.timeTrackerService.GetStatus()
+	status, err := s.timeTrackerService.GetStatus(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -66,68 +144,892 @@ func (s *Server) getTimeEntries(c *gin.Context) {
 		limit = 10
 	}
 
-	entries, err := s.timeTrackerService.GetRecentEntries(limit)
+	filter := services.TimeEntryFilter{
+		Client:  c.Query("client"),
+		Project: c.Query("project"),
+		Query:   c.Query("q"),
+		Sort:    c.Query("sort"),
+		Cursor:  c.Query("cursor"),
+		Limit:   limit,
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseDateParam(from, false)
+		if err != nil {
+			respondError(c, invalidRequest("invalid from: "+err.Error()))
+			return
+		}
+		filter.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseDateParam(to, true)
+		if err != nil {
+			respondError(c, invalidRequest("invalid to: "+err.Error()))
+			return
+		}
+		filter.To = &t
+	}
+
+	page, err := s.timeTrackerService.ListEntries(c.Request.Context(), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": entries})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": page.Entries, "next_cursor": page.NextCursor})
+}
+
+// parseDateParam accepts an RFC 3339 timestamp or a YYYY-MM-DD date in local
+// time. A date used as an upper bound covers the whole day.
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("expected YYYY-MM-DD or RFC 3339")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
 }
 
 func (s *Server) getTodaySummary(c *gin.Context) {
-	summary, err := s.timeTrackerService.GetTodaySummary()
+	summary, err := s.timeTrackerService.GetTodaySummary(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": summary})
 }
 
+// CreateTimeEntryRequest names the client directly or by the ID of a
+// registered client.
+type CreateTimeEntryRequest struct {
+	Client      string    `json:"client" binding:"required_without=ClientID"`
+	ClientID    int       `json:"client_id"`
+	Project     string    `json:"project" binding:"required"`
+	Description string    `json:"description"`
+	StartTime   time.Time `json:"start_time" binding:"required"`
+	EndTime     time.Time `json:"end_time" binding:"required"`
+}
+
+// UpdateTimeEntryRequest changes the fields given. HourlyRate sets the
+// entry's own rate and ClearHourlyRate removes it.
+type UpdateTimeEntryRequest struct {
+	Client          *string    `json:"client"`
+	Project         *string    `json:"project"`
+	Description     *string    `json:"description"`
+	StartTime       *time.Time `json:"start_time"`
+	EndTime         *time.Time `json:"end_time"`
+	HourlyRate      *float64   `json:"hourly_rate"`
+	ClearHourlyRate bool       `json:"clear_hourly_rate"`
+}
+
+func (s *Server) createTimeEntry(c *gin.Context) {
+	var req CreateTimeEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	client, ok := s.entryClient(c, req.ClientID, req.Client)
+	if !ok {
+		return
+	}
+
+	entry, err := s.timeTrackerService.CreateEntry(c.Request.Context(), client, req.Project, req.Description, req.StartTime, req.EndTime)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": entry})
+}
+
+func (s *Server) getTimeEntry(c *gin.Context) {
+	id, ok := idParam(c, "time entry")
+	if !ok {
+		return
+	}
+
+	entry, err := s.timeTrackerService.GetEntry(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entry})
+}
+
+func (s *Server) updateTimeEntry(c *gin.Context) {
+	id, ok := idParam(c, "time entry")
+	if !ok {
+		return
+	}
+
+	var req UpdateTimeEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	entry, err := s.timeTrackerService.UpdateEntry(c.Request.Context(), id, services.TimeEntryUpdate{
+		Client:          req.Client,
+		Project:         req.Project,
+		Description:     req.Description,
+		StartTime:       req.StartTime,
+		EndTime:         req.EndTime,
+		HourlyRate:      req.HourlyRate,
+		ClearHourlyRate: req.ClearHourlyRate,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entry})
+}
+
+func (s *Server) deleteTimeEntry(c *gin.Context) {
+	id, ok := idParam(c, "time entry")
+	if !ok {
+		return
+	}
+
+	if err := s.timeTrackerService.DeleteEntry(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"id": id}})
+}
+
+// resolveClient loads the caller's registered client with the given ID,
+// writing an error response if there is none.
+func (s *Server) resolveClient(c *gin.Context, id int) (*services.Client, bool) {
+	client, err := s.clientService.GetClient(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return nil, false
+	}
+	return client, true
+}
+
+// entryClient returns the client a time entry records: the name of the
+// registered client clientID if it is set, and name otherwise.
+func (s *Server) entryClient(c *gin.Context, clientID int, name string) (string, bool) {
+	if clientID == 0 {
+		return name, true
+	}
+
+	client, ok := s.resolveClient(c, clientID)
+	if !ok {
+		return "", false
+	}
+	return client.Name, true
+}
+
+// idParam parses the :id path parameter, writing a 400 response if it is not
+// a positive integer.
+func idParam(c *gin.Context, resource string) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		respondError(c, invalidRequest("invalid "+resource+" id"))
+		return 0, false
+	}
+	return id, true
+}
+
 // Invoice handlers
 
+// GenerateInvoiceRequest bills either the registered client ClientID, whose
+// details fill in the invoice, or the client named by ClientName and
+// ClientEmail.
 type GenerateInvoiceRequest struct {
-	ClientName  string                   `json:"client_name" binding:"required"`
-	ClientEmail string                   `json:"client_email" binding:"required"`
+	ClientID    int                      `json:"client_id"`
+	ClientName  string                   `json:"client_name" binding:"required_without=ClientID"`
+	ClientEmail string                   `json:"client_email" binding:"required_without=ClientID"`
 	LineItems   []InvoiceLineItemRequest `json:"line_items" binding:"required"`
 	Notes       string                   `json:"notes"`
 	Date        string                   `json:"date"`
 }
 
+// InvoiceLineItemRequest may leave out the rate to bill the registered
+// client's hourly rate.
 type InvoiceLineItemRequest struct {
 	Description string  `json:"description" binding:"required"`
 	Hours       float64 `json:"hours" binding:"required"`
-	Rate        float64 `json:"rate" binding:"required"`
+	Rate        float64 `json:"rate"`
+}
+
+// serviceLineItems converts the request line items to service line items.
+func (r GenerateInvoiceRequest) serviceLineItems() []services.InvoiceLineItem {
+	lineItems := make([]services.InvoiceLineItem, len(r.LineItems))
+	for i, item := range r.LineItems {
+		lineItems[i] = services.InvoiceLineItem{
+			Description: item.Description,
+			Hours:       item.Hours,
+			Rate:        item.Rate,
+		}
+	}
+	return lineItems
+}
+
+// invoiceClient returns the registered client the request bills, or one
+// made up of its client name and email.
+func (s *Server) invoiceClient(c *gin.Context, req GenerateInvoiceRequest) (services.Client, bool) {
+	if req.ClientID == 0 {
+		return services.Client{Name: req.ClientName, Emails: []string{req.ClientEmail}}, true
+	}
+
+	client, ok := s.resolveClient(c, req.ClientID)
+	if !ok {
+		return services.Client{}, false
+	}
+	return *client, true
 }
 
 func (s *Server) generateInvoice(c *gin.Context) {
 	var req GenerateInvoiceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		respondInvalidRequest(c, err)
 		return
 	}
 
-	// Convert request line items to service line items
-	lineItems := make([]services.InvoiceLineItem, len(req.LineItems))
-	for i, item := range req.LineItems {
-		lineItems[i] = services.InvoiceLineItem{
-			Description: item.Description,
-			Hours:       item.Hours,
-			Rate:        item.Rate,
-		}
+	client, ok := s.invoiceClient(c, req)
+	if !ok {
+		return
 	}
 
-	result, err := s.invoiceService.GenerateInvoice(req.ClientName, req.ClientEmail, lineItems, req.Notes, req.Date)
+	result, err := s.invoiceService.GenerateClientInvoice(c.Request.Context(), client, req.serviceLineItems(), req.Notes, req.Date)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
 }
 
+// InvoiceFromTimeRequest bills the time tracked for either the registered
+// client ClientID or the client named by Client and ClientEmail.
+type InvoiceFromTimeRequest struct {
+	ClientID    int     `json:"client_id"`
+	Client      string  `json:"client" binding:"required_without=ClientID"`
+	ClientEmail string  `json:"client_email" binding:"required_without=ClientID"`
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	GroupBy     string  `json:"group_by"`
+	Rate        float64 `json:"rate"`
+	Notes       string  `json:"notes"`
+	Date        string  `json:"date"`
+}
+
+func (s *Server) generateInvoiceFromTime(c *gin.Context) {
+	var req InvoiceFromTimeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	timeReq := services.TimeInvoiceRequest{
+		Client:      req.Client,
+		ClientEmail: req.ClientEmail,
+		GroupBy:     req.GroupBy,
+		Rate:        req.Rate,
+		Notes:       req.Notes,
+		Date:        req.Date,
+	}
+	if req.ClientID != 0 {
+		client, ok := s.resolveClient(c, req.ClientID)
+		if !ok {
+			return
+		}
+		timeReq.Registered = client
+	}
+	if req.From != "" {
+		t, err := parseDateParam(req.From, false)
+		if err != nil {
+			respondError(c, invalidRequest("invalid from: "+err.Error()))
+			return
+		}
+		timeReq.From = &t
+	}
+	if req.To != "" {
+		t, err := parseDateParam(req.To, true)
+		if err != nil {
+			respondError(c, invalidRequest("invalid to: "+err.Error()))
+			return
+		}
+		timeReq.To = &t
+	}
+
+	result, err := s.invoiceService.GenerateInvoiceFromTime(c.Request.Context(), timeReq)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": result})
+}
+
+func (s *Server) listInvoices(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		limit = 50
+	}
+
+	invoices, err := s.invoiceService.ListInvoices(c.Request.Context(), services.InvoiceFilter{
+		Status: c.Query("status"),
+		Limit:  limit,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": invoices})
+}
+
+func (s *Server) getInvoice(c *gin.Context) {
+	id, ok := idParam(c, "invoice")
+	if !ok {
+		return
+	}
+
+	invoice, err := s.invoiceService.GetInvoice(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": invoice})
+}
+
+func (s *Server) issueInvoice(c *gin.Context) {
+	s.transitionInvoice(c, s.invoiceService.IssueInvoice)
+}
+
+func (s *Server) sendInvoice(c *gin.Context) {
+	s.transitionInvoice(c, s.invoiceService.SendInvoice)
+}
+
+func (s *Server) voidInvoice(c *gin.Context) {
+	s.transitionInvoice(c, s.invoiceService.VoidInvoice)
+}
+
+func (s *Server) transitionInvoice(c *gin.Context, transition func(ctx context.Context, id int) (*services.Invoice, error)) {
+	id, ok := idParam(c, "invoice")
+	if !ok {
+		return
+	}
+
+	invoice, err := transition(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": invoice})
+}
+
+type RecordPaymentRequest struct {
+	Amount float64 `json:"amount" binding:"required"`
+	// Date is YYYY-MM-DD and defaults to today.
+	Date      string `json:"date"`
+	Reference string `json:"reference"`
+}
+
+func (s *Server) recordPayment(c *gin.Context) {
+	id, ok := idParam(c, "invoice")
+	if !ok {
+		return
+	}
+
+	var req RecordPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	payment := services.InvoicePayment{Amount: req.Amount, Reference: req.Reference}
+	if req.Date != "" {
+		date, err := time.ParseInLocation("2006-01-02", req.Date, time.Local)
+		if err != nil {
+			respondError(c, invalidRequest("date must be YYYY-MM-DD"))
+			return
+		}
+		payment.Date = date
+	}
+
+	invoice, err := s.invoiceService.RecordPayment(c.Request.Context(), id, payment)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": invoice})
+}
+
+// previewInvoice computes an invoice from a GenerateInvoiceRequest body
+// without generating it. It responds with an HTML page when the client
+// accepts text/html and JSON otherwise.
 func (s *Server) previewInvoice(c *gin.Context) {
-	// TODO: Implement invoice preview
-	c.JSON(http.StatusNotImplemented, gin.H{"message": "Invoice preview not yet implemented"})
+	var req GenerateInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	client, ok := s.invoiceClient(c, req)
+	if !ok {
+		return
+	}
+
+	preview, err := s.invoiceService.PreviewClientInvoice(c.Request.Context(), client, req.serviceLineItems(), req.Notes, req.Date)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		var page bytes.Buffer
+		if err := services.RenderInvoiceHTML(&page, preview); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": preview})
+}
+
+// serveInvoiceFile serves a PDF from the caller's invoice directory. The
+// default user's directory holds the others' under users/, which it must
+// not reach.
+func (s *Server) serveInvoiceFile(c *gin.Context) {
+	userID := services.UserID(c.Request.Context())
+	name := path.Clean(c.Param("filepath"))
+	if userID == store.DefaultUserID && (name == "/users" || strings.HasPrefix(name, "/users/")) {
+		respondError(c, errFileNotFound)
+		return
+	}
+
+	dir := services.UserInvoiceDir(s.config, userID)
+	if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil || info.IsDir() {
+		respondError(c, errFileNotFound)
+		return
+	}
+	c.FileFromFS(name, gin.Dir(dir, false))
+}
+
+// Client handlers
+
+type CreateClientRequest struct {
+	Name             string   `json:"name" binding:"required"`
+	LegalName        string   `json:"legal_name"`
+	Emails           []string `json:"emails"`
+	BillingAddress   string   `json:"billing_address"`
+	TaxID            string   `json:"tax_id"`
+	Currency         string   `json:"currency"`
+	PaymentTermsDays *int     `json:"payment_terms_days"`
+	HourlyRate       float64  `json:"hourly_rate"`
+}
+
+// UpdateClientRequest changes the fields it sets. ClearPaymentTerms drops
+// the client's payment terms, so its invoices use INVOICE_DUE_DAYS again.
+type UpdateClientRequest struct {
+	Name              *string   `json:"name"`
+	LegalName         *string   `json:"legal_name"`
+	Emails            *[]string `json:"emails"`
+	BillingAddress    *string   `json:"billing_address"`
+	TaxID             *string   `json:"tax_id"`
+	Currency          *string   `json:"currency"`
+	PaymentTermsDays  *int      `json:"payment_terms_days"`
+	ClearPaymentTerms bool      `json:"clear_payment_terms"`
+	HourlyRate        *float64  `json:"hourly_rate"`
+}
+
+func (s *Server) createClient(c *gin.Context) {
+	var req CreateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	client, err := s.clientService.CreateClient(c.Request.Context(), services.Client{
+		Name:             req.Name,
+		LegalName:        req.LegalName,
+		Emails:           req.Emails,
+		BillingAddress:   req.BillingAddress,
+		TaxID:            req.TaxID,
+		Currency:         req.Currency,
+		PaymentTermsDays: req.PaymentTermsDays,
+		HourlyRate:       req.HourlyRate,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": client})
+}
+
+func (s *Server) listClients(c *gin.Context) {
+	clients, err := s.clientService.ListClients(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": clients})
+}
+
+func (s *Server) getClient(c *gin.Context) {
+	id, ok := idParam(c, "client")
+	if !ok {
+		return
+	}
+
+	client, ok := s.resolveClient(c, id)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": client})
+}
+
+func (s *Server) updateClient(c *gin.Context) {
+	id, ok := idParam(c, "client")
+	if !ok {
+		return
+	}
+
+	var req UpdateClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	client, err := s.clientService.UpdateClient(c.Request.Context(), id, services.ClientUpdate{
+		Name:              req.Name,
+		LegalName:         req.LegalName,
+		Emails:            req.Emails,
+		BillingAddress:    req.BillingAddress,
+		TaxID:             req.TaxID,
+		Currency:          req.Currency,
+		PaymentTermsDays:  req.PaymentTermsDays,
+		ClearPaymentTerms: req.ClearPaymentTerms,
+		HourlyRate:        req.HourlyRate,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": client})
+}
+
+func (s *Server) deleteClient(c *gin.Context) {
+	id, ok := idParam(c, "client")
+	if !ok {
+		return
+	}
+
+	if err := s.clientService.DeleteClient(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"id": id}})
+}
+
+// Project handlers
+
+// CreateProjectRequest registers a project. BillingMode defaults to hourly;
+// fixed-fee projects need a FixedFee.
+type CreateProjectRequest struct {
+	Name         string  `json:"name" binding:"required"`
+	ClientID     *int    `json:"client_id"`
+	BillingMode  string  `json:"billing_mode"`
+	HourlyRate   float64 `json:"hourly_rate"`
+	FixedFee     float64 `json:"fixed_fee"`
+	BudgetHours  float64 `json:"budget_hours"`
+	BudgetAmount float64 `json:"budget_amount"`
+}
+
+// UpdateProjectRequest changes the fields it sets. ClearClient unlinks the
+// project from its client, and Archived archives or restores it.
+type UpdateProjectRequest struct {
+	Name         *string  `json:"name"`
+	ClientID     *int     `json:"client_id"`
+	ClearClient  bool     `json:"clear_client"`
+	BillingMode  *string  `json:"billing_mode"`
+	HourlyRate   *float64 `json:"hourly_rate"`
+	FixedFee     *float64 `json:"fixed_fee"`
+	BudgetHours  *float64 `json:"budget_hours"`
+	BudgetAmount *float64 `json:"budget_amount"`
+	Archived     *bool    `json:"archived"`
+}
+
+func (s *Server) createProject(c *gin.Context) {
+	var req CreateProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	project, err := s.projectService.CreateProject(c.Request.Context(), services.Project{
+		Name:         req.Name,
+		ClientID:     req.ClientID,
+		BillingMode:  req.BillingMode,
+		HourlyRate:   req.HourlyRate,
+		FixedFee:     req.FixedFee,
+		BudgetHours:  req.BudgetHours,
+		BudgetAmount: req.BudgetAmount,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": project})
+}
+
+// listProjects lists the active projects, and archived ones as well with
+// ?archived=true.
+func (s *Server) listProjects(c *gin.Context) {
+	includeArchived := c.Query("archived") == "true"
+
+	projects, err := s.projectService.ListProjects(c.Request.Context(), includeArchived)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": projects})
+}
+
+func (s *Server) getProject(c *gin.Context) {
+	id, ok := idParam(c, "project")
+	if !ok {
+		return
+	}
+
+	project, err := s.projectService.GetProject(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": project})
+}
+
+func (s *Server) updateProject(c *gin.Context) {
+	id, ok := idParam(c, "project")
+	if !ok {
+		return
+	}
+
+	var req UpdateProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	project, err := s.projectService.UpdateProject(c.Request.Context(), id, services.ProjectUpdate{
+		ClientID:     req.ClientID,
+		ClearClient:  req.ClearClient,
+		Name:         req.Name,
+		BillingMode:  req.BillingMode,
+		HourlyRate:   req.HourlyRate,
+		FixedFee:     req.FixedFee,
+		BudgetHours:  req.BudgetHours,
+		BudgetAmount: req.BudgetAmount,
+		Archived:     req.Archived,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": project})
+}
+
+func (s *Server) deleteProject(c *gin.Context) {
+	id, ok := idParam(c, "project")
+	if !ok {
+		return
+	}
+
+	if err := s.projectService.DeleteProject(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"id": id}})
+}
+
+func (s *Server) getProjectBudget(c *gin.Context) {
+	id, ok := idParam(c, "project")
+	if !ok {
+		return
+	}
+
+	budget, err := s.budgetService.ProjectBudget(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": budget})
+}
+
+// Rate handlers
+
+// CreateRateChangeRequest changes the rate of a client, a project or, if it
+// names neither, the caller's own default rate from EffectiveFrom on.
+type CreateRateChangeRequest struct {
+	ClientID      *int    `json:"client_id"`
+	ProjectID     *int    `json:"project_id"`
+	HourlyRate    float64 `json:"hourly_rate"`
+	EffectiveFrom string  `json:"effective_from" binding:"required"`
+}
+
+func (s *Server) listRateChanges(c *gin.Context) {
+	changes, err := s.rateService.ListRateChanges(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": changes})
+}
+
+func (s *Server) createRateChange(c *gin.Context) {
+	var req CreateRateChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	change, err := s.rateService.CreateRateChange(c.Request.Context(), services.RateChange{
+		ClientID:      req.ClientID,
+		ProjectID:     req.ProjectID,
+		HourlyRate:    req.HourlyRate,
+		EffectiveFrom: req.EffectiveFrom,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": change})
+}
+
+func (s *Server) deleteRateChange(c *gin.Context) {
+	id, ok := idParam(c, "rate change")
+	if !ok {
+		return
+	}
+
+	if err := s.rateService.DeleteRateChange(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"id": id}})
+}
+
+// API key handlers
+
+// CreateAPIKeyRequest creates a key for UserID, or for the caller's own
+// user when it is left out.
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	UserID int      `json:"user_id"`
+}
+
+// createAPIKey responds with the new key, which cannot be retrieved later.
+func (s *Server) createAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	userID := req.UserID
+	if userID == 0 {
+		userID = services.UserID(c.Request.Context())
+	}
+
+	key, err := s.apiKeyService.CreateKey(c.Request.Context(), userID, req.Name, req.Scopes)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": key})
+}
+
+func (s *Server) listAPIKeys(c *gin.Context) {
+	keys, err := s.apiKeyService.ListKeys(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": keys})
+}
+
+func (s *Server) revokeAPIKey(c *gin.Context) {
+	id, ok := idParam(c, "API key")
+	if !ok {
+		return
+	}
+
+	key, err := s.apiKeyService.RevokeKey(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": key})
+}
+
+// User handlers
+
+type CreateUserRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (s *Server) createUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	user, err := s.userService.CreateUser(c.Request.Context(), req.Name)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": user})
+}
+
+func (s *Server) listUsers(c *gin.Context) {
+	users, err := s.userService.ListUsers(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": users})
 }
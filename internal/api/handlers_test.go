@@ -2,384 +2,1192 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/logging"
 	"kb-freelance-api/internal/services"
+	"kb-freelance-api/internal/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
 )
 
-// Mock services for testing
-type MockTimeTrackerService struct {
-	mock.Mock
-}
+func TestHealthEndpoint(t *testing.T) {
+	router := setupStoreRouter(t)
 
-func (m *MockTimeTrackerService) StartTimer(client, project, description string) (map[string]interface{}, error) {
-	args := m.Called(client, project, description)
-	return args.Get(0).(map[string]interface{}), args.Error(1)
+	w := performJSON(router, "GET", "/health", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status": "ok", "service": "kb-freelance-api"}`, w.Body.String())
 }
 
-func (m *MockTimeTrackerService) StopTimer() (map[string]interface{}, error) {
-	args := m.Called()
-	return args.Get(0).(map[string]interface{}), args.Error(1)
+func TestInvalidJSONRequest(t *testing.T) {
+	router := setupStoreRouter(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/time/start", bytes.NewBufferString("invalid json"))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_request", decodeError(t, w).Code)
 }
 
-func (m *MockTimeTrackerService) GetStatus() (*services.TimerStatus, error) {
-	args := m.Called()
-	return args.Get(0).(*services.TimerStatus), args.Error(1)
+// setupStoreRouter returns the real routes of a server backed by a temporary
+// SQLite database.
+func setupStoreRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	dbPath := filepath.Join(t.TempDir(), "time_tracker.db")
+	st, err := store.Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	cfg := &config.Config{
+		DatabasePath:       dbPath,
+		TimeTrackerBackend: "sqlite",
+		InvoiceRenderer:    "native",
+		InvoiceOutputPath:  t.TempDir(),
+		InvoiceDueDays:     30,
+		BudgetThresholds:   []float64{80, 100},
+	}
+	return newServer(cfg, st, &services.ScriptedRunner{}, slog.New(slog.DiscardHandler)).routes()
 }
 
-func (m *MockTimeTrackerService) GetRecentEntries(limit int) ([]services.TimeEntry, error) {
-	args := m.Called(limit)
-	return args.Get(0).([]services.TimeEntry), args.Error(1)
+type timeEntryResponse struct {
+	Success bool               `json:"success"`
+	Data    services.TimeEntry `json:"data"`
+	Error   ErrorBody          `json:"error"`
 }
 
-func (m *MockTimeTrackerService) GetTodaySummary() (*services.TodaySummary, error) {
-	args := m.Called()
-	return args.Get(0).(*services.TodaySummary), args.Error(1)
+type errorResponse struct {
+	Success bool      `json:"success"`
+	Error   ErrorBody `json:"error"`
 }
 
-type MockInvoiceService struct {
-	mock.Mock
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) ErrorBody {
+	var response errorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.False(t, response.Success)
+	return response.Error
 }
 
-func (m *MockInvoiceService) GenerateInvoice(clientName, clientEmail string, lineItems []services.InvoiceLineItem, notes, date string) (map[string]interface{}, error) {
-	args := m.Called(clientName, clientEmail, lineItems, notes, date)
-	return args.Get(0).(map[string]interface{}), args.Error(1)
+func performJSON(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Buffer
+	if body != nil {
+		jsonBody, _ := json.Marshal(body)
+		reader = bytes.NewBuffer(jsonBody)
+	} else {
+		reader = bytes.NewBuffer(nil)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
 }
 
-func setupTestRouter() (*gin.Engine, *MockTimeTrackerService, *MockInvoiceService) {
-	gin.SetMode(gin.TestMode)
+func TestTimeEntryCRUDEndpoints(t *testing.T) {
+	router := setupStoreRouter(t)
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
 
-	mockTimeTracker := &MockTimeTrackerService{}
-	mockInvoice := &MockInvoiceService{}
+	w := performJSON(router, "POST", "/api/time/entries", map[string]interface{}{
+		"client":      "Test Client",
+		"project":     "Test Project",
+		"description": "Manual entry",
+		"start_time":  start,
+		"end_time":    start.Add(90 * time.Minute),
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
 
-	router := gin.New()
+	var created timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, created.Success)
+	assert.Equal(t, 90, created.Data.DurationMinutes)
+	path := fmt.Sprintf("/api/time/entries/%d", created.Data.ID)
 
-	// Add middleware
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	w = performJSON(router, "GET", path, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok", "service": "kb-freelance-api"})
+	w = performJSON(router, "PATCH", path, map[string]interface{}{
+		"description": "Corrected",
+		"end_time":    start.Add(2 * time.Hour),
 	})
+	assert.Equal(t, http.StatusOK, w.Code)
 
-	// API routes
-	api := router.Group("/api")
-	{
-		// Time tracking routes
-		time := api.Group("/time")
-		{
-			time.POST("/start", func(c *gin.Context) {
-				var req StartTimerRequest
-				if err := c.ShouldBindJSON(&req); err != nil {
-					c.JSON(400, gin.H{"error": err.Error()})
-					return
-				}
-
-				result, err := mockTimeTracker.StartTimer(req.Client, req.Project, req.Description)
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
-
-				c.JSON(200, result)
-			})
-
-			time.POST("/stop", func(c *gin.Context) {
-				result, err := mockTimeTracker.StopTimer()
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
-
-				c.JSON(200, result)
-			})
-
-			time.GET("/status", func(c *gin.Context) {
-				status, err := mockTimeTracker.GetStatus()
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
-
-				c.JSON(200, status)
-			})
-
-			time.GET("/entries", func(c *gin.Context) {
-				limit := 10
-				if limitStr := c.Query("limit"); limitStr != "" {
-					// Parse limit parameter
-					limit = 10 // Simplified for test
-				}
-
-				entries, err := mockTimeTracker.GetRecentEntries(limit)
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
-
-				c.JSON(200, gin.H{"entries": entries})
-			})
-
-			time.GET("/today", func(c *gin.Context) {
-				summary, err := mockTimeTracker.GetTodaySummary()
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
-
-				c.JSON(200, summary)
-			})
-		}
+	var updated timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "Corrected", updated.Data.Description)
+	assert.Equal(t, 120, updated.Data.DurationMinutes)
+
+	w = performJSON(router, "DELETE", path, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(router, "GET", path, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
 
-		// Invoice routes
-		invoice := api.Group("/invoice")
-		{
-			invoice.POST("/generate", func(c *gin.Context) {
-				var req GenerateInvoiceRequest
-				if err := c.ShouldBindJSON(&req); err != nil {
-					c.JSON(400, gin.H{"error": err.Error()})
-					return
-				}
-
-				// Convert request line items to service line items
-				lineItems := make([]services.InvoiceLineItem, len(req.LineItems))
-				for i, item := range req.LineItems {
-					lineItems[i] = services.InvoiceLineItem{
-						Description: item.Description,
-						Hours:       item.Hours,
-						Rate:        item.Rate,
-					}
-				}
-
-				result, err := mockInvoice.GenerateInvoice(req.ClientName, req.ClientEmail, lineItems, req.Notes, req.Date)
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
-
-				c.JSON(200, result)
-			})
+func TestTimeEntryEndpointValidation(t *testing.T) {
+	router := setupStoreRouter(t)
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	w := performJSON(router, "POST", "/api/time/entries", map[string]interface{}{
+		"client":     "Test Client",
+		"project":    "Test Project",
+		"start_time": start,
+		"end_time":   start.Add(-time.Hour),
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(router, "GET", "/api/time/entries/abc", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performJSON(router, "PATCH", "/api/time/entries/999", map[string]interface{}{"description": "x"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPauseResumeEndpoints(t *testing.T) {
+	router := setupStoreRouter(t)
+
+	w := performJSON(router, "POST", "/api/time/pause", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "no_timer_running", decodeError(t, w).Code)
+
+	w = performJSON(router, "POST", "/api/time/start", map[string]interface{}{"client": "Acme", "project": "Website", "allow_any_project": true})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(router, "POST", "/api/time/pause", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var paused timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &paused))
+	assert.True(t, paused.Data.IsPaused)
+	assert.Len(t, paused.Data.Pauses, 1)
+
+	w = performJSON(router, "POST", "/api/time/pause", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "timer_paused", decodeError(t, w).Code)
+
+	w = performJSON(router, "GET", "/api/time/current", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var current struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &current))
+	assert.Equal(t, true, current.Data["is_paused"])
+	assert.Equal(t, 0.0, current.Data["duration_minutes"])
+	assert.NotEmpty(t, current.Data["paused_since"])
+
+	w = performJSON(router, "POST", "/api/time/resume", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resumed timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resumed))
+	assert.False(t, resumed.Data.IsPaused)
+	if assert.Len(t, resumed.Data.Pauses, 1) {
+		assert.NotNil(t, resumed.Data.Pauses[0].EndTime)
+	}
+
+	w = performJSON(router, "POST", "/api/time/resume", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "timer_not_paused", decodeError(t, w).Code)
+}
+
+func TestSwitchTimerEndpoint(t *testing.T) {
+	router := setupStoreRouter(t)
+	start := map[string]interface{}{"client": "Acme", "project": "Website", "allow_any_project": true}
+	next := map[string]interface{}{"client": "Acme", "project": "App", "description": "Review", "allow_any_project": true}
+
+	w := performJSON(router, "POST", "/api/time/switch", next)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "no_timer_running", decodeError(t, w).Code)
+
+	w = performJSON(router, "POST", "/api/time/start", start)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var started timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+
+	// Unknown projects are turned away before anything is stopped
+	w = performJSON(router, "POST", "/api/time/switch", map[string]interface{}{"client": "Acme", "project": "App"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "unknown_project", decodeError(t, w).Code)
+
+	w = performJSON(router, "POST", "/api/time/switch", next)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var switched struct {
+		Data services.TimerSwitch `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &switched))
+	if assert.NotNil(t, switched.Data.Stopped) && assert.NotNil(t, switched.Data.Started) {
+		assert.Equal(t, started.Data.ID, switched.Data.Stopped.ID)
+		assert.False(t, switched.Data.Stopped.IsRunning)
+		if assert.NotNil(t, switched.Data.Stopped.EndTime) {
+			assert.True(t, switched.Data.Stopped.EndTime.Equal(switched.Data.Started.StartTime))
 		}
+		assert.True(t, switched.Data.Started.IsRunning)
+		assert.Equal(t, "App", switched.Data.Started.Project)
 	}
 
-	return router, mockTimeTracker, mockInvoice
+	w = performJSON(router, "GET", "/api/time/current", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var current struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &current))
+	assert.Equal(t, "App", current.Data["project"])
 }
 
-func TestHealthEndpoint(t *testing.T) {
-	router, _, _ := setupTestRouter()
+func TestGetTimeEntriesFilteringAndPagination(t *testing.T) {
+	router := setupStoreRouter(t)
+	base := time.Date(2024, 2, 1, 9, 0, 0, 0, time.Local)
+
+	for i, client := range []string{"Acme", "Acme", "Globex", "Acme"} {
+		start := base.AddDate(0, 0, i)
+		w := performJSON(router, "POST", "/api/time/entries", map[string]interface{}{
+			"client":     client,
+			"project":    "Website",
+			"start_time": start,
+			"end_time":   start.Add(time.Hour),
+		})
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/health", nil)
-	router.ServeHTTP(w, req)
+	type pageResponse struct {
+		Success    bool                 `json:"success"`
+		Data       []services.TimeEntry `json:"data"`
+		NextCursor string               `json:"next_cursor"`
+	}
 
-	assert.Equal(t, 200, w.Code)
+	w := performJSON(router, "GET", "/api/time/entries?client=Acme&from=2024-02-01&to=2024-02-03&sort=asc&limit=1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
 
-	var response map[string]interface{}
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "ok", response["status"])
-	assert.Equal(t, "kb-freelance-api", response["service"])
+	var first pageResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	assert.Len(t, first.Data, 1)
+	assert.Equal(t, 1, first.Data[0].ID)
+	assert.NotEmpty(t, first.NextCursor)
+
+	w = performJSON(router, "GET", "/api/time/entries?client=Acme&from=2024-02-01&to=2024-02-03&sort=asc&limit=1&cursor="+first.NextCursor, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var second pageResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+	assert.Len(t, second.Data, 1)
+	assert.Equal(t, 2, second.Data[0].ID)
+	assert.Empty(t, second.NextCursor)
+
+	w = performJSON(router, "GET", "/api/time/entries?from=yesterday", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
-func TestStartTimerEndpoint(t *testing.T) {
-	router, mockTimeTracker, _ := setupTestRouter()
+func TestGenerateInvoiceMultipleLineItemsUnprocessable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
 
-	// Mock the service call
-	expectedResult := map[string]interface{}{
-		"status":      "success",
-		"message":     "Started tracking time for Test Client/Test Project",
-		"client":      "Test Client",
-		"project":     "Test Project",
-		"description": "Test Description",
+	cfg := &config.Config{InvoiceGenPath: t.TempDir()}
+	server := &Server{config: cfg, invoiceService: services.NewInvoiceService(cfg)}
+	router := gin.New()
+	router.POST("/api/invoice/generate", server.generateInvoice)
+
+	w := performJSON(router, "POST", "/api/invoice/generate", map[string]interface{}{
+		"client_name":  "Test Client",
+		"client_email": "test@example.com",
+		"line_items": []map[string]interface{}{
+			{"description": "Design", "hours": 1.0, "rate": 50.0},
+			{"description": "Development", "hours": 2.0, "rate": 75.0},
+		},
+	})
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	body := decodeError(t, w)
+	assert.Equal(t, "invoice_not_representable", body.Code)
+	assert.Contains(t, body.Message, "one line item")
+}
+
+func TestInvoiceRecordEndpoints(t *testing.T) {
+	router := setupStoreRouter(t)
+
+	w := performJSON(router, "POST", "/api/invoice/generate", GenerateInvoiceRequest{
+		ClientName:  "Test Client",
+		ClientEmail: "test@example.com",
+		LineItems:   []InvoiceLineItemRequest{{Description: "Development", Hours: 2, Rate: 75}},
+		Date:        "2026-03-01",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var generated struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &generated))
+	assert.Equal(t, "2026-0001", generated.Data["invoice_number"])
+	assert.NotContains(t, generated.Data, "pdf_path")
+	id := int(generated.Data["invoice_id"].(float64))
+
+	w = performJSON(router, "GET", fmt.Sprintf("/api/invoices/%d", id), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "pdf_path")
+	assert.Contains(t, w.Body.String(), `"download_url":"/files/invoice_Test_Client_2026-0001.pdf"`)
+	var got struct {
+		Success bool             `json:"success"`
+		Data    services.Invoice `json:"data"`
 	}
-	mockTimeTracker.On("StartTimer", "Test Client", "Test Project", "Test Description").Return(expectedResult, nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, "2026-0001", got.Data.Number)
+	assert.Equal(t, "2026-03-31", got.Data.DueDate)
+	assert.Equal(t, 150.0, got.Data.Total)
+
+	w = performJSON(router, "GET", "/api/invoices", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data []services.Invoice `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 1)
+
+	w = performJSON(router, "GET", "/api/invoices/999", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestInvoiceStatusEndpoints(t *testing.T) {
+	router := setupStoreRouter(t)
+
+	w := performJSON(router, "POST", "/api/invoice/generate", GenerateInvoiceRequest{
+		ClientName:  "Test Client",
+		ClientEmail: "test@example.com",
+		LineItems:   []InvoiceLineItemRequest{{Description: "Development", Hours: 2, Rate: 75}},
+		Date:        "2020-01-01",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(router, "POST", "/api/invoices/1/payments", RecordPaymentRequest{Amount: 150})
+	assert.Equal(t, http.StatusConflict, w.Code)
 
-	// Create request
-	requestBody := StartTimerRequest{
-		Client:      "Test Client",
-		Project:     "Test Project",
-		Description: "Test Description",
+	w = performJSON(router, "POST", "/api/invoices/1/issue", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(router, "GET", "/api/invoices?status=overdue", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data []services.Invoice `json:"data"`
 	}
-	jsonBody, _ := json.Marshal(requestBody)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 1)
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/api/time/start", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	router.ServeHTTP(w, req)
+	w = performJSON(router, "POST", "/api/invoices/1/payments", RecordPaymentRequest{Amount: 150, Date: "01/02/2020"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 
-	assert.Equal(t, 200, w.Code)
+	w = performJSON(router, "POST", "/api/invoices/1/payments", RecordPaymentRequest{Amount: 150, Date: "2020-01-20"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var paid struct {
+		Data services.Invoice `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &paid))
+	assert.Equal(t, services.InvoicePaid, paid.Data.Status)
+	assert.Equal(t, "2020-01-20", paid.Data.Payments[0].Date)
 
-	var response map[string]interface{}
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "success", response["status"])
+	w = performJSON(router, "POST", "/api/invoices/1/void", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
 
-	mockTimeTracker.AssertExpectations(t)
+	w = performJSON(router, "GET", "/api/invoices?status=unknown", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
-func TestStopTimerEndpoint(t *testing.T) {
-	router, mockTimeTracker, _ := setupTestRouter()
+func TestPreviewInvoiceEndpoint(t *testing.T) {
+	router := setupStoreRouter(t)
+	body := GenerateInvoiceRequest{
+		ClientName:  "Test Client",
+		ClientEmail: "test@example.com",
+		LineItems:   []InvoiceLineItemRequest{{Description: "Development", Hours: 2, Rate: 75}},
+		Date:        "2026-03-01",
+	}
 
-	// Mock the service call
-	expectedResult := map[string]interface{}{
-		"status":  "success",
-		"message": "Timer stopped successfully",
+	w := performJSON(router, "POST", "/api/invoice/preview", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var preview struct {
+		Success bool                    `json:"success"`
+		Data    services.InvoicePreview `json:"data"`
 	}
-	mockTimeTracker.On("StopTimer").Return(expectedResult, nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Equal(t, 150.0, preview.Data.Total)
+	assert.Equal(t, "2026-03-31", preview.Data.DueDate)
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/api/time/stop", nil)
+	jsonBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", "/api/invoice/preview", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/html")
+	w = httptest.NewRecorder()
 	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "Development")
+
+	// Previewing must not create an invoice
+	w = performJSON(router, "GET", "/api/invoices", nil)
+	var list struct {
+		Data []services.Invoice `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Empty(t, list.Data)
+
+	body.LineItems[0].Hours = -1
+	w = performJSON(router, "POST", "/api/invoice/preview", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
 
-	assert.Equal(t, 200, w.Code)
+func TestGenerateInvoiceFromTimeEndpoint(t *testing.T) {
+	router := setupStoreRouter(t)
 
-	var response map[string]interface{}
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, "success", response["status"])
+	w := performJSON(router, "POST", "/api/time/entries", map[string]interface{}{
+		"client":     "Acme",
+		"project":    "Website",
+		"start_time": "2026-03-02T09:00:00Z",
+		"end_time":   "2026-03-02T10:30:00Z",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	body := InvoiceFromTimeRequest{
+		Client:      "Acme",
+		ClientEmail: "billing@acme.test",
+		From:        "2026-03-01",
+		To:          "2026-03-31",
+		GroupBy:     "entry",
+		Rate:        100,
+	}
+	w = performJSON(router, "POST", "/api/invoices/from-time", body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var generated struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &generated))
+	assert.Equal(t, 150.0, generated.Data["total"])
+
+	w = performJSON(router, "GET", "/api/time/entries/1", nil)
+	var entry timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	if assert.NotNil(t, entry.Data.InvoiceID) {
+		assert.Equal(t, int(generated.Data["invoice_id"].(float64)), *entry.Data.InvoiceID)
+	}
+
+	// The entry is billed, so there is nothing left to invoice
+	w = performJSON(router, "POST", "/api/invoices/from-time", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	body.From = "March"
+	w = performJSON(router, "POST", "/api/invoices/from-time", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestClientEndpoints(t *testing.T) {
+	router := setupStoreRouter(t)
+
+	w := performJSON(router, "POST", "/api/clients", map[string]interface{}{
+		"name":               "Acme",
+		"legal_name":         "Acme Corporation Ltd",
+		"emails":             []string{"billing@acme.test"},
+		"billing_address":    "1 Main Street\nSpringfield",
+		"currency":           "gbp",
+		"payment_terms_days": 14,
+		"hourly_rate":        80,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Data services.Client `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "GBP", created.Data.Currency)
+	clientID := created.Data.ID
+
+	w = performJSON(router, "POST", "/api/clients", map[string]interface{}{"name": "Acme"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "client_exists", decodeError(t, w).Code)
 
-	mockTimeTracker.AssertExpectations(t)
+	w = performJSON(router, "POST", "/api/clients", map[string]interface{}{"name": "Globex", "currency": "pounds"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_client", decodeError(t, w).Code)
+
+	w = performJSON(router, "PATCH", fmt.Sprintf("/api/clients/%d", clientID), map[string]interface{}{"hourly_rate": 100})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = performJSON(router, "GET", "/api/clients", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data []services.Client `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Data, 1) {
+		assert.Equal(t, 100.0, list.Data[0].HourlyRate)
+		assert.Equal(t, 14, *list.Data[0].PaymentTermsDays)
+	}
+
+	// Time entries record the registered client's name
+	w = performJSON(router, "POST", "/api/time/entries", map[string]interface{}{
+		"client_id":  clientID,
+		"project":    "Website",
+		"start_time": "2026-03-02T09:00:00Z",
+		"end_time":   "2026-03-02T10:30:00Z",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var entry timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	assert.Equal(t, "Acme", entry.Data.Client)
+
+	w = performJSON(router, "POST", "/api/time/start", map[string]interface{}{"client_id": 999, "project": "Website"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "client_not_found", decodeError(t, w).Code)
+
+	// The client's rate, terms and currency fill in the invoice
+	w = performJSON(router, "POST", "/api/invoices/from-time", map[string]interface{}{"client_id": clientID, "date": "2026-03-31"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var generated struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &generated))
+	assert.Equal(t, 150.0, generated.Data["total"])
+	assert.Equal(t, "GBP", generated.Data["currency"])
+	assert.Equal(t, "2026-04-14", generated.Data["due_date"])
+
+	w = performJSON(router, "POST", "/api/invoice/preview", map[string]interface{}{
+		"client_id":  clientID,
+		"line_items": []map[string]interface{}{{"description": "Support", "hours": 2}},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var preview struct {
+		Data services.InvoicePreview `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Equal(t, "Acme Corporation Ltd", preview.Data.ClientName)
+	assert.Equal(t, "billing@acme.test", preview.Data.ClientEmail)
+	assert.Equal(t, 200.0, preview.Data.Total)
+
+	w = performJSON(router, "DELETE", fmt.Sprintf("/api/clients/%d", clientID), nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "client_in_use", decodeError(t, w).Code)
 }
 
-func TestGetStatusEndpoint(t *testing.T) {
-	router, mockTimeTracker, _ := setupTestRouter()
+func TestProjectEndpoints(t *testing.T) {
+	router := setupStoreRouter(t)
 
-	// Mock the service call
-	expectedStatus := &services.TimerStatus{
-		IsRunning:       true,
-		Client:          "Test Client",
-		Project:         "Test Project",
-		Description:     "Test Description",
-		DurationMinutes: 30,
+	w := performJSON(router, "POST", "/api/clients", map[string]interface{}{"name": "Acme"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var client struct {
+		Data services.Client `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &client))
+
+	w = performJSON(router, "POST", "/api/projects", map[string]interface{}{
+		"name":          "Website",
+		"client_id":     client.Data.ID,
+		"hourly_rate":   120,
+		"budget_hours":  40,
+		"budget_amount": 4800,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Data services.Project `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, services.BillingHourly, created.Data.BillingMode)
+	projectID := created.Data.ID
+
+	w = performJSON(router, "POST", "/api/projects", map[string]interface{}{"name": "Launch", "billing_mode": "fixed"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_project", decodeError(t, w).Code)
+	w = performJSON(router, "POST", "/api/projects", map[string]interface{}{"name": "Launch", "client_id": 99})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "client_not_found", decodeError(t, w).Code)
+
+	// Typos are turned away unless explicitly allowed
+	w = performJSON(router, "POST", "/api/time/start", map[string]interface{}{"client": "Acme", "project": "Websight"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	body := decodeError(t, w)
+	assert.Equal(t, "unknown_project", body.Code)
+	assert.Equal(t, "Websight", body.Details["project"])
+	w = performJSON(router, "POST", "/api/time/start", map[string]interface{}{"client": "Acme", "project": "Websight", "allow_any_project": true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, performJSON(router, "POST", "/api/time/stop", nil).Code)
+
+	// Surrounding whitespace is dropped before the check, not after it
+	for _, path := range []string{"/api/time/start", "/api/time/switch"} {
+		w = performJSON(router, "POST", path, map[string]interface{}{"client": "Acme", "project": " Website "})
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	w = performJSON(router, "GET", "/api/time/entries", nil)
+	assert.NotContains(t, w.Body.String(), `" Website "`)
+	assert.Equal(t, http.StatusOK, performJSON(router, "POST", "/api/time/stop", nil).Code)
+
+	w = performJSON(router, "PATCH", fmt.Sprintf("/api/projects/%d", projectID), map[string]interface{}{"archived": true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(router, "POST", "/api/time/start", map[string]interface{}{"client": "Acme", "project": "Website"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "project_archived", decodeError(t, w).Code)
+
+	var list struct {
+		Data []services.Project `json:"data"`
+	}
+	w = performJSON(router, "GET", "/api/projects", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Empty(t, list.Data)
+	w = performJSON(router, "GET", "/api/projects?archived=true", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Data, 1) {
+		assert.True(t, list.Data[0].Archived)
 	}
-	mockTimeTracker.On("GetStatus").Return(expectedStatus, nil)
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/api/time/status", nil)
-	router.ServeHTTP(w, req)
+	// Clients with projects are kept
+	w = performJSON(router, "DELETE", fmt.Sprintf("/api/clients/%d", client.Data.ID), nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
 
-	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, http.StatusOK, performJSON(router, "DELETE", fmt.Sprintf("/api/projects/%d", projectID), nil).Code)
+	assert.Equal(t, http.StatusNotFound, performJSON(router, "GET", fmt.Sprintf("/api/projects/%d", projectID), nil).Code)
+}
 
-	var response services.TimerStatus
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.True(t, response.IsRunning)
-	assert.Equal(t, "Test Client", response.Client)
-	assert.Equal(t, "Test Project", response.Project)
-
-	mockTimeTracker.AssertExpectations(t)
-}
-
-func TestGetTodaySummaryEndpoint(t *testing.T) {
-	router, mockTimeTracker, _ := setupTestRouter()
-
-	// Mock the service call
-	expectedSummary := &services.TodaySummary{
-		TotalHours:   2.5,
-		TotalMinutes: 150,
-		EntryCount:   2,
-		Breakdown: []services.Breakdown{
-			{
-				ClientProject: "Client A/Project A",
-				Hours:         1.5,
-				Minutes:       90,
-			},
-			{
-				ClientProject: "Client B/Project B",
-				Hours:         1.0,
-				Minutes:       60,
-			},
-		},
+func TestProjectBudgetEndpoint(t *testing.T) {
+	router := setupStoreRouter(t)
+
+	w := performJSON(router, "POST", "/api/projects", map[string]interface{}{"name": "Website", "hourly_rate": 100, "budget_hours": 10})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var project struct {
+		Data services.Project `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &project))
+
+	// Logging eight of ten hours crosses the 80% threshold
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	w = performJSON(router, "POST", "/api/time/entries", map[string]interface{}{
+		"client":     "Acme",
+		"project":    "Website",
+		"start_time": start,
+		"end_time":   start.Add(8 * time.Hour),
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var entry struct {
+		Data services.TimeEntry `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	if assert.Len(t, entry.Data.BudgetEvents, 1) {
+		assert.Equal(t, services.MeasureHours, entry.Data.BudgetEvents[0].Measure)
+		assert.Equal(t, 80.0, entry.Data.BudgetEvents[0].Threshold)
 	}
-	mockTimeTracker.On("GetTodaySummary").Return(expectedSummary, nil)
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/api/time/today", nil)
-	router.ServeHTTP(w, req)
+	w = performJSON(router, "GET", fmt.Sprintf("/api/projects/%d/budget", project.Data.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var budget struct {
+		Data services.ProjectBudget `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &budget))
+	assert.Equal(t, 8.0, budget.Data.HoursConsumed)
+	assert.Equal(t, 800.0, budget.Data.AmountConsumed)
+	assert.Equal(t, 80.0, budget.Data.HoursPercent)
+	assert.Equal(t, []float64{80}, budget.Data.ThresholdsReached)
+	assert.NotEmpty(t, budget.Data.ProjectedExhaustion)
+
+	// Stretching the entry to the whole budget crosses 100%
+	end := start.Add(10 * time.Hour)
+	w = performJSON(router, "PATCH", fmt.Sprintf("/api/time/entries/%d", entry.Data.ID), map[string]interface{}{"end_time": end})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	if assert.Len(t, entry.Data.BudgetEvents, 1) {
+		assert.Equal(t, 100.0, entry.Data.BudgetEvents[0].Threshold)
+	}
 
-	assert.Equal(t, 200, w.Code)
+	w = performJSON(router, "GET", "/api/projects/99/budget", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "project_not_found", decodeError(t, w).Code)
+}
 
-	var response services.TodaySummary
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	assert.NoError(t, err)
-	assert.Equal(t, 2.5, response.TotalHours)
-	assert.Equal(t, 150, response.TotalMinutes)
-	assert.Equal(t, 2, response.EntryCount)
-	assert.Len(t, response.Breakdown, 2)
+func TestRateEndpoints(t *testing.T) {
+	router := setupStoreRouter(t)
+
+	w := performJSON(router, "POST", "/api/projects", map[string]interface{}{"name": "Website", "hourly_rate": 100})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var project struct {
+		Data services.Project `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &project))
 
-	mockTimeTracker.AssertExpectations(t)
+	w = performJSON(router, "POST", "/api/rates", map[string]interface{}{
+		"project_id":     project.Data.ID,
+		"hourly_rate":    120,
+		"effective_from": "2026-03-03",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var change struct {
+		Data services.RateChange `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &change))
+
+	w = performJSON(router, "POST", "/api/rates", map[string]interface{}{"hourly_rate": 120, "effective_from": "March"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_rate_change", decodeError(t, w).Code)
+
+	// Entries report the rate in effect when they started
+	start := time.Date(2026, 3, 3, 9, 0, 0, 0, time.Local)
+	w = performJSON(router, "POST", "/api/time/entries", map[string]interface{}{
+		"client":     "Acme",
+		"project":    "Website",
+		"start_time": start,
+		"end_time":   start.Add(90 * time.Minute),
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var entry timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	assert.Equal(t, 120.0, entry.Data.HourlyRate)
+	assert.Equal(t, services.RateSourceProject, entry.Data.RateSource)
+	assert.Equal(t, 180.0, entry.Data.BillableAmount)
+
+	w = performJSON(router, "PATCH", fmt.Sprintf("/api/time/entries/%d", entry.Data.ID), map[string]interface{}{"hourly_rate": 90})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	assert.Equal(t, services.RateSourceEntry, entry.Data.RateSource)
+	assert.Equal(t, 135.0, entry.Data.BillableAmount)
+
+	var list struct {
+		Data []services.RateChange `json:"data"`
+	}
+	w = performJSON(router, "GET", "/api/rates", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Data, 1) {
+		assert.Equal(t, "2026-03-03", list.Data[0].EffectiveFrom)
+	}
+
+	path := fmt.Sprintf("/api/rates/%d", change.Data.ID)
+	assert.Equal(t, http.StatusOK, performJSON(router, "DELETE", path, nil).Code)
+	w = performJSON(router, "DELETE", path, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "rate_change_not_found", decodeError(t, w).Code)
 }
 
-func TestGenerateInvoiceEndpoint(t *testing.T) {
-	router, _, mockInvoice := setupTestRouter()
+// setupCLIRouter returns the real routes of a server that uses the Python
+// CLIs, which are answered by the returned runner.
+func setupCLIRouter(t *testing.T) (*gin.Engine, *services.ScriptedRunner, *config.Config) {
+	gin.SetMode(gin.TestMode)
 
-	// Mock the service call
-	expectedResult := map[string]interface{}{
-		"status":  "success",
-		"message": "Invoice generated successfully",
+	cfg := &config.Config{
+		PythonExecPath:    "python3",
+		TimeTrackerPath:   "/opt/kb-tt-cli",
+		InvoiceGenPath:    t.TempDir(),
+		InvoiceOutputPath: t.TempDir(),
+		InvoiceDueDays:    30,
 	}
+	runner := &services.ScriptedRunner{}
+	return newServer(cfg, nil, runner, slog.New(slog.DiscardHandler)).routes(), runner, cfg
+}
 
-	lineItems := []services.InvoiceLineItem{
-		{
-			Description: "Test Work",
-			Hours:       2.0,
-			Rate:        75.0,
-		},
+const (
+	runningEntryJSON = `{"id": 7, "client": "Acme", "project": "Website", "description": "Design", "start_time": "2026-03-02T09:00:00", "duration_minutes": 0, "is_running": true}`
+	stoppedEntryJSON = `{"id": 7, "client": "Acme", "project": "Website", "description": "Design", "start_time": "2026-03-02T09:00:00", "end_time": "2026-03-02T10:30:00", "duration_minutes": 90, "is_running": false}`
+)
+
+func TestTimerEndpointsWithCLI(t *testing.T) {
+	router, runner, cfg := setupCLIRouter(t)
+	runner.On("-m", "tt.cli", "status", "--json").Return("null", nil).Once()
+	runner.On("-m", "tt.cli", "start").Return("Started timer for Acme/Website\n", nil)
+	runner.On("-m", "tt.cli", "status", "--json").Return(runningEntryJSON, nil)
+	runner.On("-m", "tt.cli", "stop").Return("Stopped timer\n", nil)
+	runner.On("-m", "tt.cli", "list", "--json").Return("["+stoppedEntryJSON+"]", nil)
+
+	w := performJSON(router, "GET", "/api/time/current", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"success": true, "data": null}`, w.Body.String())
+
+	w = performJSON(router, "POST", "/api/time/start", map[string]interface{}{
+		"client":      "Acme",
+		"project":     "Website",
+		"description": "Design",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var started timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	assert.Equal(t, 7, started.Data.ID)
+	assert.True(t, started.Data.IsRunning)
+
+	w = performJSON(router, "POST", "/api/time/stop", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stopped timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stopped))
+	assert.Equal(t, 90, stopped.Data.DurationMinutes)
+	assert.NotNil(t, stopped.Data.EndTime)
+
+	calls := runner.Calls()
+	if assert.Len(t, calls, 6) {
+		assert.Equal(t, []string{"-m", "tt.cli", "start", "Acme", "Website", "--desc", "Design"}, calls[1].Args)
+		assert.Equal(t, "python3", calls[1].Name)
+		assert.Equal(t, cfg.TimeTrackerPath, calls[1].Dir)
+		assert.Equal(t, []string{"-m", "tt.cli", "stop"}, calls[4].Args)
 	}
+}
 
-	mockInvoice.On("GenerateInvoice", "Test Client", "test@example.com", lineItems, "Test notes", "2024-01-01").Return(expectedResult, nil)
+func TestTimeReportEndpointsWithCLI(t *testing.T) {
+	router, runner, _ := setupCLIRouter(t)
+	runner.On("-m", "tt.cli", "list", "--json").Return("["+stoppedEntryJSON+"]", nil)
+	runner.On("-m", "tt.cli", "today", "--json").Return(`{"total_hours": 1.5, "total_minutes": 90, "entry_count": 1, "breakdown": [{"client": "Acme", "project": "Website", "duration_minutes": 90}]}`, nil)
 
-	// Create request
-	requestBody := GenerateInvoiceRequest{
-		ClientName:  "Test Client",
-		ClientEmail: "test@example.com",
-		LineItems: []InvoiceLineItemRequest{
-			{
-				Description: "Test Work",
-				Hours:       2.0,
-				Rate:        75.0,
-			},
-		},
-		Notes: "Test notes",
-		Date:  "2024-01-01",
+	w := performJSON(router, "GET", "/api/time/entries?client=Acme", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var entries struct {
+		Data []services.TimeEntry `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	if assert.Len(t, entries.Data, 1) {
+		assert.Equal(t, "Website", entries.Data[0].Project)
 	}
-	jsonBody, _ := json.Marshal(requestBody)
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/api/invoice/generate", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	router.ServeHTTP(w, req)
+	w = performJSON(router, "GET", "/api/time/today", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var today struct {
+		Data services.TodaySummary `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &today))
+	assert.Equal(t, 1.5, today.Data.TotalHours)
+	if assert.Len(t, today.Data.Breakdown, 1) {
+		assert.Equal(t, "Acme - Website", today.Data.Breakdown[0].ClientProject)
+	}
+}
+
+func TestTimerEndpointCLIFailure(t *testing.T) {
+	router, runner, _ := setupCLIRouter(t)
+	runner.On("-m", "tt.cli", "status", "--json").Return(`Traceback (most recent call last):
+  File "/home/kb/kb-tt-cli/tt/db.py", line 12, in connect
+sqlite3.OperationalError: database is locked
+`, fmt.Errorf("exit status 1"))
+
+	w := performJSON(router, "GET", "/api/time/current", nil)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	body := decodeError(t, w)
+	assert.Equal(t, "time_tracker_failed", body.Code)
+	assert.Equal(t, "the time tracker failed", body.Message)
+
+	// Neither the traceback nor the paths in it reach the client
+	assert.NotContains(t, w.Body.String(), "database is locked")
+	assert.NotContains(t, w.Body.String(), "/home/kb")
+}
 
-	assert.Equal(t, 200, w.Code)
+func TestGenerateInvoiceEndpointWithCLI(t *testing.T) {
+	router, runner, cfg := setupCLIRouter(t)
+	runner.On("--version").Return("Python 3.12.0\n", nil)
+	runner.On("-m", "src.main").Do(func(ctx context.Context, cmd services.Command) ([]byte, error) {
+		// kb-invoice-gen-cli writes output/invoice.pdf in its own directory
+		outputDir := filepath.Join(cmd.Dir, "output")
+		if err := os.MkdirAll(outputDir, 0o755); err != nil {
+			return nil, err
+		}
+		return []byte("Invoice created\n"), os.WriteFile(filepath.Join(outputDir, "invoice.pdf"), []byte("%PDF-1.4"), 0o644)
+	})
+
+	w := performJSON(router, "POST", "/api/invoice/generate", GenerateInvoiceRequest{
+		ClientName:  "Acme",
+		ClientEmail: "billing@acme.test",
+		LineItems:   []InvoiceLineItemRequest{{Description: "Design", Hours: 2, Rate: 80}},
+		Date:        "2026-03-01",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
 
-	var response map[string]interface{}
-	err := json.Unmarshal(w.Body.Bytes(), &response)
+	var generated struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &generated))
+	assert.Equal(t, 160.0, generated.Data["total"])
+	assert.NotContains(t, generated.Data, "output")
+	assert.NotContains(t, generated.Data, "pdf_path")
+	_, err := os.Stat(filepath.Join(cfg.InvoiceOutputDir(), generated.Data["filename"].(string)))
 	assert.NoError(t, err)
-	assert.Equal(t, "success", response["status"])
 
-	mockInvoice.AssertExpectations(t)
+	calls := runner.Calls()
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, []string{"-m", "src.main",
+			"-c", "Acme",
+			"-e", "billing@acme.test",
+			"-d", "Design",
+			"-h", "2.00",
+			"-r", "80.00",
+			"--notes", "Generated via API",
+			"--date", "2026-03-01",
+		}, calls[1].Args)
+		assert.Equal(t, cfg.InvoiceGenPath, calls[1].Dir)
+	}
 }
 
-func TestInvalidJSONRequest(t *testing.T) {
-	router, _, _ := setupTestRouter()
+func TestTimerEndpointCLITimeout(t *testing.T) {
+	router, runner, cfg := setupCLIRouter(t)
+	cfg.CommandTimeout = 50 * time.Millisecond
+	runner.On("-m", "tt.cli", "status", "--json").Do(func(ctx context.Context, cmd services.Command) ([]byte, error) {
+		// Hang like a CLI stuck on a locked database until it is killed
+		<-ctx.Done()
+		return []byte("waiting for database lock"), ctx.Err()
+	})
+
+	w := performJSON(router, "GET", "/api/time/current", nil)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	body := decodeError(t, w)
+	assert.Equal(t, "command_timeout", body.Code)
+	assert.Equal(t, 0.05, body.Details["timeout_seconds"])
+	assert.NotContains(t, w.Body.String(), "waiting for database lock")
+}
 
+func TestErrorEnvelope(t *testing.T) {
+	router := setupStoreRouter(t)
+
+	w := performJSON(router, "POST", "/api/time/entries", map[string]interface{}{"project": "Website"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	body := decodeError(t, w)
+	assert.Equal(t, "invalid_request", body.Code)
+	assert.Equal(t, map[string]interface{}{"client": "required_without", "start_time": "required", "end_time": "required"}, body.Details["fields"])
+
+	w = performJSON(router, "GET", "/api/time/entries/42", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	body = decodeError(t, w)
+	assert.Equal(t, "time_entry_not_found", body.Code)
+	assert.Equal(t, 42.0, body.Details["id"])
+
+	assert.Equal(t, http.StatusCreated, performJSON(router, "POST", "/api/projects", map[string]interface{}{"name": "Website"}).Code)
+	w = performJSON(router, "POST", "/api/time/start", map[string]interface{}{"client": "Acme", "project": "Website"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = performJSON(router, "POST", "/api/time/start", map[string]interface{}{"client": "Acme", "project": "Website"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "timer_running", decodeError(t, w).Code)
+
+	w = performJSON(router, "GET", "/api/nothing-here", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "route_not_found", decodeError(t, w).Code)
+}
+
+func TestRequestLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	cfg := &config.Config{
+		PythonExecPath:    "python3",
+		InvoiceGenPath:    t.TempDir(),
+		InvoiceOutputPath: t.TempDir(),
+	}
+	runner := &services.ScriptedRunner{}
+	runner.On("--version").Return("Python 3.12.0\n", nil)
+	runner.On("-m", "src.main").Return("Sending to billing@acme.test\n", fmt.Errorf("exit status 1"))
+	router := newServer(cfg, nil, runner, logging.New(&logs, "debug", "json")).routes()
+
+	jsonBody, _ := json.Marshal(GenerateInvoiceRequest{
+		ClientName:  "Acme",
+		ClientEmail: "billing@acme.test",
+		LineItems:   []InvoiceLineItemRequest{{Description: "Design", Hours: 2, Rate: 80}},
+		Notes:       "Door code 1234",
+	})
+	req, _ := http.NewRequest("POST", "/api/invoice/generate", bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "req-42")
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/api/time/start", bytes.NewBufferString("invalid json"))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "req-42", w.Header().Get("X-Request-ID"))
+
+	// Every record, including those of the service, carries the request ID
+	messages := map[string]bool{}
+	for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+		var record map[string]interface{}
+		if assert.NoError(t, json.Unmarshal(line, &record)) {
+			assert.Equal(t, "req-42", record["request_id"], "record %s", line)
+			messages[record["msg"].(string)] = true
+		}
+	}
+	assert.True(t, messages["running command"])
+	assert.True(t, messages["request failed"])
+	assert.NotContains(t, logs.String(), "billing@acme.test")
+	assert.NotContains(t, logs.String(), "Door code")
+
+	// Requests without a usable ID get a new one
+	req, _ = http.NewRequest("GET", "/health", nil)
+	req.Header.Set("X-Request-ID", "not a valid id\n")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Regexp(t, `^[0-9a-f]{16}$`, w.Header().Get("X-Request-ID"))
+}
+
+// performWithKey is like performJSON, authenticating with key as a bearer
+// token.
+func performWithKey(router *gin.Engine, method, path, key string, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	if body == nil {
+		jsonBody = nil
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewReader(jsonBody))
 	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st, err := store.Open(filepath.Join(t.TempDir(), "time_tracker.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	cfg := &config.Config{
+		TimeTrackerBackend: "sqlite",
+		InvoiceRenderer:    "native",
+		InvoiceOutputPath:  t.TempDir(),
+		AuthRequired:       true,
+	}
+	server := newServer(cfg, st, &services.ScriptedRunner{}, slog.New(slog.DiscardHandler))
+	router := server.routes()
+	admin, err := server.apiKeyService.CreateKey(context.Background(), store.DefaultUserID, "admin", []string{services.ScopeAdmin})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(cfg.InvoiceOutputPath, "invoice_Acme_2026-0001.pdf"), []byte("%PDF-1.4"), 0o644))
+
+	// Health checks stay open; everything else needs a key
+	assert.Equal(t, http.StatusOK, performWithKey(router, "GET", "/health", "", nil).Code)
+	assert.Equal(t, http.StatusOK, performWithKey(router, "GET", "/api/health", "", nil).Code)
+	for _, path := range []string{"/api/time/entries", "/files/invoice_Acme_2026-0001.pdf"} {
+		w := performWithKey(router, "GET", path, "", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+		assert.Equal(t, "unauthenticated", decodeError(t, w).Code)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	}
+	assert.Equal(t, http.StatusUnauthorized, performWithKey(router, "GET", "/api/time/entries", "kb_guessed", nil).Code)
+
+	// The admin creates a read-only key, which is only shown once
+	w := performWithKey(router, "POST", "/api/keys", admin.Key, CreateAPIKeyRequest{Name: "dashboard", Scopes: []string{services.ScopeTimeRead}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Data services.NewAPIKey `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Data.Key)
+
+	w = performWithKey(router, "GET", "/api/keys", admin.Key, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Data.Key)
+
+	assert.Equal(t, http.StatusOK, performWithKey(router, "GET", "/api/time/entries", created.Data.Key, nil).Code)
+	w = performWithKey(router, "POST", "/api/time/start", created.Data.Key, StartTimerRequest{Client: "Acme", Project: "Website"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	body := decodeError(t, w)
+	assert.Equal(t, "insufficient_scope", body.Code)
+	assert.Equal(t, services.ScopeTimeWrite, body.Details["scope"])
+	assert.Equal(t, http.StatusForbidden, performWithKey(router, "GET", "/files/invoice_Acme_2026-0001.pdf", created.Data.Key, nil).Code)
+	assert.Equal(t, http.StatusForbidden, performWithKey(router, "GET", "/api/keys", created.Data.Key, nil).Code)
+
+	// Keys are also accepted in the X-API-Key header
+	req, _ := http.NewRequest("GET", "/files/invoice_Acme_2026-0001.pdf", nil)
+	req.Header.Set("X-API-Key", admin.Key)
+	w = httptest.NewRecorder()
 	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "%PDF-1.4", w.Body.String())
+
+	// Revoked keys stop working at once
+	w = performWithKey(router, "DELETE", fmt.Sprintf("/api/keys/%d", created.Data.ID), admin.Key, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, performWithKey(router, "GET", "/api/time/entries", created.Data.Key, nil).Code)
+	assert.Equal(t, http.StatusNotFound, performWithKey(router, "DELETE", "/api/keys/99", admin.Key, nil).Code)
+}
 
-	assert.Equal(t, 400, w.Code)
+func TestUsersAreIsolated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	st, err := store.Open(filepath.Join(t.TempDir(), "time_tracker.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	cfg := &config.Config{
+		TimeTrackerBackend:  "sqlite",
+		InvoiceRenderer:     "native",
+		InvoiceOutputPath:   t.TempDir(),
+		InvoiceNumberFormat: "{year}-{seq:4}",
+		InvoiceDueDays:      30,
+		AuthRequired:        true,
+	}
+	server := newServer(cfg, st, &services.ScriptedRunner{}, slog.New(slog.DiscardHandler))
+	router := server.routes()
+	admin, err := server.apiKeyService.CreateKey(context.Background(), store.DefaultUserID, "admin", []string{services.ScopeAdmin})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
 
-	var response map[string]interface{}
-	err := json.Unmarshal(w.Body.Bytes(), &response)
+	// The admin adds a user and gives them a key of their own
+	w := performWithKey(router, "POST", "/api/users", admin.Key, CreateUserRequest{Name: "alice"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var user struct {
+		Data services.User `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, http.StatusConflict, performWithKey(router, "POST", "/api/users", admin.Key, CreateUserRequest{Name: "alice"}).Code)
+
+	scopes := []string{services.ScopeTimeRead, services.ScopeTimeWrite, services.ScopeInvoiceRead, services.ScopeInvoiceWrite}
+	w = performWithKey(router, "POST", "/api/keys", admin.Key, CreateAPIKeyRequest{Name: "alice", Scopes: scopes, UserID: user.Data.ID})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var key struct {
+		Data services.NewAPIKey `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &key))
+	assert.Equal(t, user.Data.ID, key.Data.UserID)
+	assert.Equal(t, http.StatusNotFound, performWithKey(router, "POST", "/api/keys", admin.Key,
+		CreateAPIKeyRequest{Name: "nobody", Scopes: scopes, UserID: 99}).Code)
+	assert.Equal(t, http.StatusForbidden, performWithKey(router, "GET", "/api/users", key.Data.Key, nil).Code)
+
+	// Both run a timer at once, each on a project of their own
+	assert.Equal(t, http.StatusCreated, performWithKey(router, "POST", "/api/projects", admin.Key, CreateProjectRequest{Name: "Website"}).Code)
+	assert.Equal(t, http.StatusCreated, performWithKey(router, "POST", "/api/projects", key.Data.Key, CreateProjectRequest{Name: "App"}).Code)
+	assert.Equal(t, http.StatusBadRequest, performWithKey(router, "POST", "/api/time/start", key.Data.Key, StartTimerRequest{Client: "Globex", Project: "Website"}).Code)
+	assert.Equal(t, http.StatusOK, performWithKey(router, "POST", "/api/time/start", admin.Key, StartTimerRequest{Client: "Acme", Project: "Website"}).Code)
+	assert.Equal(t, http.StatusOK, performWithKey(router, "POST", "/api/time/start", key.Data.Key, StartTimerRequest{Client: "Globex", Project: "App"}).Code)
+	w = performWithKey(router, "POST", "/api/time/stop", key.Data.Key, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stopped timeEntryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stopped))
+	assert.Equal(t, "Globex", stopped.Data.Client)
+	assert.Contains(t, performWithKey(router, "GET", "/api/time/current", admin.Key, nil).Body.String(), "Acme")
+	assert.Equal(t, http.StatusNotFound, performWithKey(router, "GET", fmt.Sprintf("/api/time/entries/%d", stopped.Data.ID), admin.Key, nil).Code)
+
+	// Invoice numbers, records and files are per user
+	invoice := GenerateInvoiceRequest{
+		ClientName:  "Acme",
+		ClientEmail: "billing@acme.test",
+		LineItems:   []InvoiceLineItemRequest{{Description: "Design", Hours: 2, Rate: 80}},
+		Date:        "2026-03-01",
+	}
+	var generated [2]struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	for i, apiKey := range []string{admin.Key, key.Data.Key} {
+		w = performWithKey(router, "POST", "/api/invoice/generate", apiKey, invoice)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &generated[i]))
+		assert.Equal(t, "2026-0001", generated[i].Data["invoice_number"])
+	}
+	_, err = os.Stat(filepath.Join(cfg.InvoiceOutputPath, "users", strconv.Itoa(user.Data.ID), generated[1].Data["filename"].(string)))
 	assert.NoError(t, err)
-	assert.Contains(t, response["error"], "invalid character")
+
+	theirs := fmt.Sprintf("/api/invoices/%v", generated[1].Data["invoice_id"])
+	assert.Equal(t, http.StatusOK, performWithKey(router, "GET", theirs, key.Data.Key, nil).Code)
+	assert.Equal(t, http.StatusNotFound, performWithKey(router, "GET", theirs, admin.Key, nil).Code)
+
+	download := generated[1].Data["download_url"].(string)
+	assert.Equal(t, http.StatusOK, performWithKey(router, "GET", download, key.Data.Key, nil).Code)
+	// Both files have the same name, so the default user gets their own
+	w = performWithKey(router, "GET", download, admin.Key, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, generated[0].Data["download_url"], download)
+	w = performWithKey(router, "GET", fmt.Sprintf("/files/users/%d/%s", user.Data.ID, generated[1].Data["filename"]), admin.Key, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "file_not_found", decodeError(t, w).Code)
+	assert.Equal(t, http.StatusNotFound, performWithKey(router, "GET", "/files/../time_tracker.db", key.Data.Key, nil).Code)
 }
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -47,7 +48,8 @@ func TestAPIHandlersIntegration(t *testing.T) {
 	}
 
 	// Create real server with real services
-	server := NewServer(cfg)
+	server := NewServer(cfg, slog.New(slog.DiscardHandler))
+	t.Cleanup(func() { server.Close() })
 
 	// Set Gin to test mode
 	gin.SetMode(gin.TestMode)
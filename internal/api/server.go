@@ -1,10 +1,21 @@
 package api
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
 
 	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/logging"
 	"kb-freelance-api/internal/services"
+	"kb-freelance-api/internal/store"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -12,34 +23,143 @@ import (
 
 type Server struct {
 	config             *config.Config
+	logger             *slog.Logger
 	timeTrackerService *services.TimeTrackerService
 	invoiceService     *services.InvoiceService
+	apiKeyService      *services.APIKeyService
+	userService        *services.UserService
+	clientService      *services.ClientService
+	projectService     *services.ProjectService
+	budgetService      *services.BudgetService
+	rateService        *services.RateService
+
+	// closers are released by Close, e.g. the Python workers.
+	closers []io.Closer
 }
 
-func NewServer(cfg *config.Config) *Server {
-	return &Server{
+// NewServer creates a server that logs through logger. Every request gets
+// a copy of it that records the request ID, which the services log with.
+func NewServer(cfg *config.Config, logger *slog.Logger) *Server {
+	st, err := store.Open(cfg.DatabasePath)
+	if err != nil {
+		logger.Warn("Failed to open database, features that need it are disabled", "error", err)
+		st = nil
+	}
+
+	var runner services.CommandRunner = services.ExecRunner{}
+	var workers *services.WorkerPool
+	if cfg.PythonWorkers > 0 {
+		workers = services.NewWorkerPool(cfg.PythonExecPath, cfg.PythonWorkers, services.ExecRunner{})
+		runner = workers
+	}
+
+	s := newServer(cfg, st, runner, logger)
+	if workers != nil {
+		s.closers = append(s.closers, workers)
+	}
+	if st != nil {
+		s.closers = append(s.closers, st)
+	}
+	return s
+}
+
+// Close stops the server's Python workers and closes its database.
+func (s *Server) Close() error {
+	var errs []error
+	for _, closer := range s.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// newServer creates a server whose services use st, which may be nil, and
+// run the Python CLIs through runner.
+func newServer(cfg *config.Config, st *store.SQLiteStore, runner services.CommandRunner, logger *slog.Logger) *Server {
+	if st == nil && cfg.AuthRequired {
+		logger.Error("Database unavailable, every request needing an API key will be rejected")
+	}
+
+	s := &Server{
 		config:             cfg,
-		timeTrackerService: services.NewTimeTrackerService(cfg),
-		invoiceService:     services.NewInvoiceService(cfg),
+		logger:             logger,
+		timeTrackerService: newTimeTrackerService(cfg, st, runner, logger),
+		invoiceService:     services.NewInvoiceServiceWithStore(cfg, st, runner),
+		apiKeyService:      services.NewAPIKeyService(st),
+		userService:        services.NewUserService(st),
+		clientService:      services.NewClientService(st),
+		projectService:     services.NewProjectService(st),
+		budgetService:      services.NewBudgetService(cfg, st),
+		rateService:        services.NewRateService(cfg, st),
+	}
+	s.timeTrackerService.WatchBudgets(s.budgetService)
+	s.timeTrackerService.UseRates(s.rateService)
+	s.invoiceService.UseRates(s.rateService)
+	return s
+}
+
+// newTimeTrackerService uses the SQLite database directly when configured,
+// falling back to kb-tt-cli if it cannot be opened.
+func newTimeTrackerService(cfg *config.Config, st *store.SQLiteStore, runner services.CommandRunner, logger *slog.Logger) *services.TimeTrackerService {
+	if cfg.TimeTrackerBackend != "sqlite" {
+		return services.NewTimeTrackerServiceWithRunner(cfg, runner)
+	}
+
+	if st == nil {
+		logger.Warn("Time tracker database unavailable, falling back to kb-tt-cli")
+		return services.NewTimeTrackerServiceWithRunner(cfg, runner)
 	}
+
+	return services.NewTimeTrackerServiceWithStore(cfg, st)
 }
 
-func (s *Server) Start(addr string) error {
+// shutdownTimeout is how long requests in flight get to finish once the
+// server is stopped.
+const shutdownTimeout = 30 * time.Second
+
+// Start serves requests on addr until ctx is done, then waits for the
+// requests in flight and closes the server.
+func (s *Server) Start(ctx context.Context, addr string) error {
+	defer s.Close()
+
 	// Set Gin mode
 	gin.SetMode(gin.ReleaseMode)
 
+	httpServer := &http.Server{Addr: addr, Handler: s.routes()}
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.ListenAndServe()
+	}()
+
+	s.logger.Info("Server starting", "addr", addr)
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("Server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+// routes creates the router with every middleware and endpoint.
+func (s *Server) routes() *gin.Engine {
 	// Create router
 	router := gin.New()
 
 	// Add middleware
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	router.Use(s.requestLogger())
+	router.Use(gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		respondError(c, fmt.Errorf("panic: %v", recovered))
+	}))
+	// API keys are sent as headers, so CORS requests never need cookies
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://127.0.0.1:3000", "http://localhost:5173", "http://127.0.0.1:5173"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", apiKeyHeader, requestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", requestIDHeader},
+		AllowCredentials: false,
 	}))
 
 	// Health check endpoints
@@ -52,30 +172,140 @@ func (s *Server) Start(addr string) error {
 		c.JSON(200, gin.H{"success": true, "data": gin.H{"status": "ok", "service": "kb-freelance-api", "timestamp": "2024-01-01T00:00:00Z"}})
 	})
 
-	// Static file serving for PDFs
-	router.Static("/files", s.config.InvoiceGenPath+"/output")
+	// Unknown endpoints get the same error envelope as failed requests
+	router.NoRoute(func(c *gin.Context) {
+		respondError(c, errRouteNotFound)
+	})
+
+	timeRead := s.requireScope(services.ScopeTimeRead)
+	timeWrite := s.requireScope(services.ScopeTimeWrite)
+	invoiceRead := s.requireScope(services.ScopeInvoiceRead)
+	invoiceWrite := s.requireScope(services.ScopeInvoiceWrite)
+	admin := s.requireScope(services.ScopeAdmin)
+
+	// Invoice PDFs, from the directory of the caller's user
+	files := router.Group("/files", s.authenticate(), invoiceRead)
+	files.GET("/*filepath", s.serveInvoiceFile)
+	files.HEAD("/*filepath", s.serveInvoiceFile)
 
 	// API routes
-	api := router.Group("/api")
+	api := router.Group("/api", s.authenticate())
 	{
 		// Time tracking routes
 		time := api.Group("/time")
 		{
-			time.POST("/start", s.startTimer)
-			time.POST("/stop", s.stopTimer)
-			time.GET("/current", s.getTimerStatus) // Changed from /status to /current
-			time.GET("/entries", s.getTimeEntries)
-			time.GET("/today", s.getTodaySummary)
+			time.POST("/start", timeWrite, s.startTimer)
+			time.POST("/stop", timeWrite, s.stopTimer)
+			time.POST("/pause", timeWrite, s.pauseTimer)
+			time.POST("/resume", timeWrite, s.resumeTimer)
+			time.POST("/switch", timeWrite, s.switchTimer)
+			time.GET("/current", timeRead, s.getTimerStatus) // Changed from /status to /current
+			time.GET("/entries", timeRead, s.getTimeEntries)
+			time.POST("/entries", timeWrite, s.createTimeEntry)
+			time.GET("/entries/:id", timeRead, s.getTimeEntry)
+			time.PATCH("/entries/:id", timeWrite, s.updateTimeEntry)
+			time.DELETE("/entries/:id", timeWrite, s.deleteTimeEntry)
+			time.GET("/today", timeRead, s.getTodaySummary)
 		}
 
 		// Invoice routes
 		invoice := api.Group("/invoice")
 		{
-			invoice.POST("/generate", s.generateInvoice)
-			invoice.GET("/preview", s.previewInvoice)
+			invoice.POST("/generate", invoiceWrite, s.generateInvoice)
+			// POST as well, since browsers cannot send a body with GET
+			invoice.GET("/preview", invoiceRead, s.previewInvoice)
+			invoice.POST("/preview", invoiceRead, s.previewInvoice)
+		}
+
+		invoices := api.Group("/invoices")
+		{
+			invoices.GET("", invoiceRead, s.listInvoices)
+			invoices.POST("/from-time", invoiceWrite, s.generateInvoiceFromTime)
+			invoices.GET("/:id", invoiceRead, s.getInvoice)
+			invoices.POST("/:id/issue", invoiceWrite, s.issueInvoice)
+			invoices.POST("/:id/send", invoiceWrite, s.sendInvoice)
+			invoices.POST("/:id/void", invoiceWrite, s.voidInvoice)
+			invoices.POST("/:id/payments", invoiceWrite, s.recordPayment)
+		}
+
+		clients := api.Group("/clients")
+		{
+			clients.GET("", invoiceRead, s.listClients)
+			clients.POST("", invoiceWrite, s.createClient)
+			clients.GET("/:id", invoiceRead, s.getClient)
+			clients.PATCH("/:id", invoiceWrite, s.updateClient)
+			clients.DELETE("/:id", invoiceWrite, s.deleteClient)
+		}
+
+		projects := api.Group("/projects")
+		{
+			projects.GET("", timeRead, s.listProjects)
+			projects.POST("", timeWrite, s.createProject)
+			projects.GET("/:id", timeRead, s.getProject)
+			projects.GET("/:id/budget", timeRead, s.getProjectBudget)
+			projects.PATCH("/:id", timeWrite, s.updateProject)
+			projects.DELETE("/:id", timeWrite, s.deleteProject)
+		}
+
+		rates := api.Group("/rates")
+		{
+			rates.GET("", invoiceRead, s.listRateChanges)
+			rates.POST("", invoiceWrite, s.createRateChange)
+			rates.DELETE("/:id", invoiceWrite, s.deleteRateChange)
+		}
+
+		// API key management
+		keys := api.Group("/keys", admin)
+		{
+			keys.GET("", s.listAPIKeys)
+			keys.POST("", s.createAPIKey)
+			keys.DELETE("/:id", s.revokeAPIKey)
+		}
+
+		users := api.Group("/users", admin)
+		{
+			users.GET("", s.listUsers)
+			users.POST("", s.createUser)
 		}
 	}
 
-	log.Printf("Server starting on %s", addr)
-	return router.Run(addr)
+	return router
+}
+
+// requestIDHeader carries the ID of a request. A client-supplied ID is
+// kept so requests can be traced across services; otherwise one is made up.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits client-supplied request IDs to what is safe to log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestLogger gives every request a logger carrying its request ID and
+// logs the request once it is answered.
+func (s *Server) requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Header(requestIDHeader, id)
+
+		logger := s.logger.With("request_id", id)
+		c.Request = c.Request.WithContext(logging.NewContext(c.Request.Context(), logger))
+
+		started := time.Now()
+		c.Next()
+
+		logger.Info("request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(started),
+		)
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
@@ -1,11 +1,15 @@
 package api
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -19,7 +23,8 @@ func TestNewServer(t *testing.T) {
 		Port:            "8080",
 	}
 
-	server := NewServer(cfg)
+	server := NewServer(cfg, slog.New(slog.DiscardHandler))
+	t.Cleanup(func() { server.Close() })
 
 	assert.NotNil(t, server)
 	assert.Equal(t, cfg, server.config)
@@ -35,7 +40,7 @@ func TestServerRoutes(t *testing.T) {
 		Port:            "8080",
 	}
 
-	_ = NewServer(cfg)
+	_ = NewServer(cfg, slog.New(slog.DiscardHandler))
 
 	// Create a test router
 	gin.SetMode(gin.TestMode)
@@ -103,7 +108,7 @@ func TestCORSConfiguration(t *testing.T) {
 		Port:            "8080",
 	}
 
-	_ = NewServer(cfg)
+	_ = NewServer(cfg, slog.New(slog.DiscardHandler))
 
 	// Create a test router with CORS
 	gin.SetMode(gin.TestMode)
@@ -150,7 +155,7 @@ func TestServerMiddleware(t *testing.T) {
 		Port:            "8080",
 	}
 
-	_ = NewServer(cfg)
+	_ = NewServer(cfg, slog.New(slog.DiscardHandler))
 
 	// Create a test router
 	gin.SetMode(gin.TestMode)
@@ -185,3 +190,32 @@ func TestServerMiddleware(t *testing.T) {
 
 	assert.Equal(t, 200, w.Code)
 }
+
+type recordingCloser struct {
+	closed bool
+}
+
+func (c *recordingCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestServerStartClosesOnShutdown(t *testing.T) {
+	cfg := &config.Config{InvoiceOutputPath: t.TempDir()}
+	server := newServer(cfg, nil, &services.ScriptedRunner{}, slog.New(slog.DiscardHandler))
+	workers := &recordingCloser{}
+	server.closers = append(server.closers, workers)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.Start(ctx, "127.0.0.1:0") }()
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the server to stop once its context is done")
+	}
+	assert.True(t, workers.closed, "Expected the server to close its workers")
+}
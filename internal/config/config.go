@@ -1,9 +1,11 @@
 package config
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +14,42 @@ type Config struct {
 	DatabasePath    string
 	Port            string
 	PythonExecPath  string
+	// TimeTrackerBackend selects how time entries are read and written:
+	// "cli" shells out to kb-tt-cli, "sqlite" uses DatabasePath directly.
+	TimeTrackerBackend string
+	// InvoiceRenderer selects how invoice PDFs are produced: "python" runs
+	// kb-invoice-gen-cli, "native" renders them in-process.
+	InvoiceRenderer string
+	// InvoiceOutputPath is where generated PDFs are kept and served from.
+	InvoiceOutputPath string
+	// InvoiceNumberFormat is the template for invoice numbers, e.g.
+	// "{year}-{seq:4}" for 2026-0042.
+	InvoiceNumberFormat string
+	// InvoiceDueDays is the number of days between issue and due date.
+	InvoiceDueDays int
+	// InvoiceTaxRate is the tax added to invoice subtotals, in percent.
+	InvoiceTaxRate float64
+	// InvoiceHourlyRate is the default rate tracked time is billed at.
+	InvoiceHourlyRate float64
+	// InvoiceQueueSize is how many generations may wait while the Python
+	// generator is busy before further requests are turned away.
+	InvoiceQueueSize int
+	// CommandTimeout limits how long a single Python CLI command may run;
+	// zero means no limit.
+	CommandTimeout time.Duration
+	// PythonWorkers is how many persistent Python workers answer CLI
+	// commands; zero starts a new interpreter for every command.
+	PythonWorkers int
+	// LogLevel is the least severe level logged: "debug", "info", "warn"
+	// or "error".
+	LogLevel string
+	// LogFormat is "text" or "json".
+	LogFormat string
+	// AuthRequired makes /api and /files require an API key.
+	AuthRequired bool
+	// BudgetThresholds are the percentages of a project budget at which
+	// an event is emitted once time tracked against it crosses them.
+	BudgetThresholds []float64
 }
 
 func Load() *Config {
@@ -21,26 +59,89 @@ func Load() *Config {
 	freelanceToolsDir := filepath.Dir(currentDir) // Go up one level from kb-freelance-api
 
 	config := &Config{
-		TimeTrackerPath: getEnv("TIME_TRACKER_PATH", filepath.Join(freelanceToolsDir, "kb-tt-cli")),
-		InvoiceGenPath:  getEnv("INVOICE_GEN_PATH", filepath.Join(freelanceToolsDir, "kb-invoice-gen-cli")),
-		DatabasePath:    getEnv("DATABASE_PATH", filepath.Join(os.Getenv("HOME"), ".kb-tt-cli", "time_tracker.db")),
-		Port:            getEnv("PORT", "8080"),
-		PythonExecPath:  getEnv("PYTHON_EXEC_PATH", "/Users/kevinbinder/anaconda3/envs/kb-freelance/bin/python"),
+		TimeTrackerPath:     getEnv("TIME_TRACKER_PATH", filepath.Join(freelanceToolsDir, "kb-tt-cli")),
+		InvoiceGenPath:      getEnv("INVOICE_GEN_PATH", filepath.Join(freelanceToolsDir, "kb-invoice-gen-cli")),
+		DatabasePath:        getEnv("DATABASE_PATH", filepath.Join(os.Getenv("HOME"), ".kb-tt-cli", "time_tracker.db")),
+		Port:                getEnv("PORT", "8080"),
+		PythonExecPath:      getEnv("PYTHON_EXEC_PATH", "/Users/kevinbinder/anaconda3/envs/kb-freelance/bin/python"),
+		TimeTrackerBackend:  getEnv("TIME_TRACKER_BACKEND", "cli"),
+		InvoiceRenderer:     getEnv("INVOICE_RENDERER", "python"),
+		InvoiceNumberFormat: getEnv("INVOICE_NUMBER_FORMAT", "{year}-{seq:4}"),
+		InvoiceDueDays:      getEnvInt("INVOICE_DUE_DAYS", 30),
+		InvoiceTaxRate:      getEnvFloat("INVOICE_TAX_RATE", 0),
+		InvoiceHourlyRate:   getEnvFloat("INVOICE_HOURLY_RATE", 0),
+		InvoiceQueueSize:    getEnvInt("INVOICE_QUEUE_SIZE", 8),
+		CommandTimeout:      getEnvDuration("COMMAND_TIMEOUT", 30*time.Second),
+		PythonWorkers:       getEnvInt("PYTHON_WORKERS", 0),
+		LogLevel:            getEnv("LOG_LEVEL", "info"),
+		LogFormat:           getEnv("LOG_FORMAT", "text"),
+		AuthRequired:        getEnvBool("AUTH_REQUIRED", true),
+		BudgetThresholds:    getEnvFloats("BUDGET_THRESHOLDS", []float64{80, 100}),
 	}
-
-	// Debug: log the paths
-	fmt.Printf("DEBUG: Current directory: %s\n", currentDir)
-	fmt.Printf("DEBUG: Freelance tools directory: %s\n", freelanceToolsDir)
-	fmt.Printf("DEBUG: Time tracker path: %s\n", config.TimeTrackerPath)
-	fmt.Printf("DEBUG: Invoice gen path: %s\n", config.InvoiceGenPath)
-	fmt.Printf("DEBUG: Python executable: %s\n", config.PythonExecPath)
+	config.InvoiceOutputPath = getEnv("INVOICE_OUTPUT_PATH", filepath.Join(config.InvoiceGenPath, "output"))
 
 	return config
 }
 
+// InvoiceOutputDir returns the directory generated PDFs are written to,
+// defaulting to the output directory of kb-invoice-gen-cli.
+func (c *Config) InvoiceOutputDir() string {
+	if c.InvoiceOutputPath != "" {
+		return c.InvoiceOutputPath
+	}
+	return filepath.Join(c.InvoiceGenPath, "output")
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvFloats parses a comma-separated list of numbers, falling back to
+// defaultValue if any of them is malformed.
+func getEnvFloats(key string, defaultValue []float64) []float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var values []float64
+	for _, field := range strings.Split(value, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return defaultValue
+		}
+		values = append(values, f)
+	}
+	return values
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
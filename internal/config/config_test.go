@@ -44,6 +44,24 @@ func TestLoad(t *testing.T) {
 	if cfg.Port == "" {
 		t.Error("Port should have a default value")
 	}
+
+	// API keys are required unless turned off explicitly
+	if !cfg.AuthRequired {
+		t.Error("AuthRequired should default to true")
+	}
+	t.Setenv("AUTH_REQUIRED", "false")
+	if Load().AuthRequired {
+		t.Error("AUTH_REQUIRED=false should turn authentication off")
+	}
+
+	// Budget events fire at 80% and 100% unless configured otherwise
+	if len(cfg.BudgetThresholds) != 2 || cfg.BudgetThresholds[0] != 80 || cfg.BudgetThresholds[1] != 100 {
+		t.Errorf("BudgetThresholds should default to 80 and 100, got %v", cfg.BudgetThresholds)
+	}
+	t.Setenv("BUDGET_THRESHOLDS", "50, 90")
+	if thresholds := Load().BudgetThresholds; len(thresholds) != 2 || thresholds[0] != 50 || thresholds[1] != 90 {
+		t.Errorf("BUDGET_THRESHOLDS=50,90 should set the thresholds, got %v", thresholds)
+	}
 }
 
 func TestGetEnv(t *testing.T) {
@@ -78,5 +96,14 @@ func TestConfigPaths(t *testing.T) {
 	}
 }
 
+func TestInvoiceOutputDir(t *testing.T) {
+	cfg := &Config{InvoiceGenPath: "/tools/kb-invoice-gen-cli"}
+	if dir := cfg.InvoiceOutputDir(); dir != "/tools/kb-invoice-gen-cli/output" {
+		t.Errorf("Expected the generator output directory, got %s", dir)
+	}
 
-
+	cfg.InvoiceOutputPath = "/var/invoices"
+	if dir := cfg.InvoiceOutputDir(); dir != "/var/invoices" {
+		t.Errorf("Expected /var/invoices, got %s", dir)
+	}
+}
@@ -0,0 +1,124 @@
+// Package logging sets up the API's structured logger and carries
+// request-scoped loggers through contexts.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces client data in log records.
+const Redacted = "[REDACTED]"
+
+// New creates a logger writing to w. level is "debug", "info", "warn" or
+// "error" and defaults to info; format is "json" or "text". Client emails
+// and notes are redacted from every record.
+func New(w io.Writer, level, format string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(redactingHandler{handler})
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, which for API requests
+// includes the request ID, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// emailPattern matches email addresses anywhere in a string, e.g. in CLI
+// output or error messages.
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// sensitiveKey reports whether attributes named key hold client data.
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	return key == "email" || key == "notes" || strings.HasSuffix(key, "_email") || strings.HasSuffix(key, "_notes")
+}
+
+// redactingHandler removes client emails and notes from records before
+// passing them on.
+type redactingHandler struct {
+	slog.Handler
+}
+
+func (h redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, redactString(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return redactingHandler{h.Handler.WithAttrs(redacted)}
+}
+
+func (h redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{h.Handler.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redactString(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		a.Value = slog.GroupValue(redacted...)
+	case slog.KindAny:
+		switch value := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(redactString(value.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(redactString(value.String()))
+		case []string:
+			redacted := make([]string, len(value))
+			for i, s := range value {
+				redacted[i] = redactString(s)
+			}
+			a.Value = slog.AnyValue(redacted)
+		}
+	}
+	return a
+}
+
+func redactString(s string) string {
+	return emailPattern.ReplaceAllString(s, Redacted)
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "warn", "json")
+
+	logger.Info("dropped")
+	logger.Warn("kept", "client", "Acme")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "kept" || record["level"] != "WARN" || record["client"] != "Acme" {
+		t.Errorf("Unexpected record: %v", record)
+	}
+}
+
+func TestNewDefaultsToInfo(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "verbose", "text")
+
+	logger.Debug("dropped")
+	logger.Info("kept")
+
+	if strings.Contains(buf.String(), "dropped") || !strings.Contains(buf.String(), "msg=kept") {
+		t.Errorf("Expected only the info record as text, got %q", buf.String())
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "debug", "json").With("client_email", "billing@acme.test")
+
+	logger.Info("sending invoice to billing@acme.test",
+		"notes", "Door code 1234",
+		"args", []string{"-e", "billing@acme.test"},
+		"error", errors.New("smtp rejected billing@acme.test"),
+		slog.Group("request", "email", "billing@acme.test", "client", "Acme"),
+	)
+
+	output := buf.String()
+	for _, secret := range []string{"billing@acme.test", "Door code"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, output)
+		}
+	}
+	if !strings.Contains(output, `"client":"Acme"`) {
+		t.Errorf("Expected other attributes to be kept, got %s", output)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("Expected the default logger without a logger in the context")
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	if FromContext(NewContext(context.Background(), logger)) != logger {
+		t.Error("Expected the logger carried by the context")
+	}
+}
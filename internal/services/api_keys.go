@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"kb-freelance-api/internal/logging"
+	"kb-freelance-api/internal/store"
+)
+
+// Scopes grant API keys access to groups of endpoints. ScopeAdmin grants
+// every scope.
+const (
+	ScopeTimeRead     = "time:read"
+	ScopeTimeWrite    = "time:write"
+	ScopeInvoiceRead  = "invoice:read"
+	ScopeInvoiceWrite = "invoice:write"
+	ScopeAdmin        = "admin"
+)
+
+// Scopes lists every scope a key can be given.
+var Scopes = []string{ScopeTimeRead, ScopeTimeWrite, ScopeInvoiceRead, ScopeInvoiceWrite, ScopeAdmin}
+
+// apiKeyPrefix starts every key, so leaked keys are easy to recognise.
+const apiKeyPrefix = "kb_"
+
+var (
+	ErrUnauthenticated = &Error{Kind: KindUnauthorized, Code: "unauthenticated", Message: "a valid API key is required"}
+	ErrForbidden       = &Error{Kind: KindForbidden, Code: "insufficient_scope", Message: "the API key lacks the required scope"}
+	ErrAPIKeyNotFound  = &Error{Kind: KindNotFound, Code: "api_key_not_found", Message: "API key not found"}
+	ErrInvalidAPIKey   = &Error{Kind: KindValidation, Code: "invalid_api_key", Message: "invalid API key"}
+)
+
+// APIKey describes an API key. The key itself is only known when it is
+// created.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// NewAPIKey is a newly created key together with the key itself.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyService creates, checks and revokes API keys. Keys are stored as
+// SHA-256 hashes; they are random, so a salted slow hash adds nothing.
+type APIKeyService struct {
+	store store.APIKeyStore
+}
+
+// NewAPIKeyService creates a service keeping keys in st. Without a store
+// every key is rejected.
+func NewAPIKeyService(st *store.SQLiteStore) *APIKeyService {
+	service := &APIKeyService{}
+	if st != nil {
+		service.store = st
+	}
+	return service
+}
+
+// CreateKey creates a key named name with the given scopes, acting on
+// behalf of the user with the given ID.
+func (s *APIKeyService) CreateKey(ctx context.Context, userID int, name string, scopes []string) (*NewAPIKey, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidAPIKey)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, WithDetails(fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, scope),
+				map[string]interface{}{"scopes": Scopes})
+		}
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+
+	row, err := s.store.CreateAPIKey(store.APIKey{
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		Hash:      hashAPIKey(key),
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, WithDetails(fmt.Errorf("%w: %d", ErrUserNotFound, userID), map[string]interface{}{"user_id": userID})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &NewAPIKey{APIKey: newAPIKey(*row), Key: key}, nil
+}
+
+// Authenticate returns the key matching key, or ErrUnauthenticated if
+// there is none or it was revoked.
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*APIKey, error) {
+	if s.store == nil || !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrUnauthenticated
+	}
+
+	row, err := s.store.GetAPIKeyByHash(hashAPIKey(key))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+	if row.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: key %s was revoked", ErrUnauthenticated, row.Prefix)
+	}
+
+	// Recording the last use is only informational
+	if err := s.store.TouchAPIKey(row.ID, time.Now()); err != nil {
+		logging.FromContext(ctx).Warn("Failed to record API key use", "key_id", row.ID, "error", err)
+	}
+
+	apiKey := newAPIKey(*row)
+	return &apiKey, nil
+}
+
+// ListKeys returns every key, including revoked ones.
+func (s *APIKeyService) ListKeys(ctx context.Context) ([]APIKey, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	rows, err := s.store.ListAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, newAPIKey(row))
+	}
+	return keys, nil
+}
+
+// RevokeKey revokes the key with the given ID. Revoked keys stop working
+// immediately.
+func (s *APIKeyService) RevokeKey(ctx context.Context, id int) (*APIKey, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	row, err := s.store.RevokeAPIKey(id, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, WithDetails(fmt.Errorf("%w: %d", ErrAPIKeyNotFound, id), map[string]interface{}{"id": id})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := newAPIKey(*row)
+	return &key, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func newAPIKey(row store.APIKey) APIKey {
+	return APIKey{
+		ID:         row.ID,
+		UserID:     row.UserID,
+		Name:       row.Name,
+		Prefix:     row.Prefix,
+		Scopes:     row.Scopes,
+		CreatedAt:  row.CreatedAt,
+		LastUsedAt: row.LastUsedAt,
+		RevokedAt:  row.RevokedAt,
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kb-freelance-api/internal/store"
+)
+
+func newTestAPIKeyService(t *testing.T) *APIKeyService {
+	t.Helper()
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "time_tracker.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return NewAPIKeyService(st)
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	service := newTestAPIKeyService(t)
+	ctx := context.Background()
+
+	created, err := service.CreateKey(ctx, store.DefaultUserID, " ci ", []string{ScopeTimeWrite, ScopeInvoiceRead, ScopeTimeWrite})
+	if err != nil {
+		t.Fatalf("CreateKey failed: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, "kb_") || !strings.HasPrefix(created.Key, created.Prefix) || created.Name != "ci" || created.UserID != store.DefaultUserID {
+		t.Errorf("Unexpected key: %+v", created)
+	}
+	if strings.Join(created.Scopes, ",") != "invoice:read,time:write" {
+		t.Errorf("Expected sorted, unique scopes, got %v", created.Scopes)
+	}
+
+	key, err := service.Authenticate(ctx, created.Key)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if key.ID != created.ID || !key.HasScope(ScopeTimeWrite) || key.HasScope(ScopeInvoiceWrite) {
+		t.Errorf("Unexpected key or scopes: %+v", key)
+	}
+
+	for _, wrong := range []string{"", "kb_wrong", created.Key[:len(created.Key)-1], strings.TrimPrefix(created.Key, "kb_")} {
+		if _, err := service.Authenticate(ctx, wrong); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("Expected ErrUnauthenticated for %q, got %v", wrong, err)
+		}
+	}
+
+	if _, err := service.RevokeKey(ctx, created.ID); err != nil {
+		t.Fatalf("RevokeKey failed: %v", err)
+	}
+	if _, err := service.Authenticate(ctx, created.Key); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Expected a revoked key to be rejected, got %v", err)
+	}
+	if _, err := service.RevokeKey(ctx, 99); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Expected ErrAPIKeyNotFound, got %v", err)
+	}
+
+	keys, err := service.ListKeys(ctx)
+	if err != nil {
+		t.Fatalf("ListKeys failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].RevokedAt == nil || keys[0].LastUsedAt == nil {
+		t.Errorf("Expected the used, revoked key, got %+v", keys)
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	service := newTestAPIKeyService(t)
+
+	for _, test := range []struct {
+		name   string
+		scopes []string
+	}{
+		{"", []string{ScopeAdmin}},
+		{"ci", nil},
+		{"ci", []string{"time:delete"}},
+	} {
+		if _, err := service.CreateKey(context.Background(), store.DefaultUserID, test.name, test.scopes); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("Expected ErrInvalidAPIKey for %q %v, got %v", test.name, test.scopes, err)
+		}
+	}
+
+	if _, err := service.CreateKey(context.Background(), 99, "ci", []string{ScopeTimeRead}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := NewAPIKeyService(nil).Authenticate(context.Background(), "kb_anything"); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Expected keys to be rejected without a store, got %v", err)
+	}
+}
+
+func TestAdminScopeGrantsEverything(t *testing.T) {
+	key := &APIKey{Scopes: []string{ScopeAdmin}}
+	for _, scope := range Scopes {
+		if !key.HasScope(scope) {
+			t.Errorf("Expected admin to grant %s", scope)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/logging"
+	"kb-freelance-api/internal/store"
+)
+
+// burnRateWindow is how far back the burn rate of a budget looks.
+const burnRateWindow = 30 * 24 * time.Hour
+
+// Budget measures.
+const (
+	MeasureHours  = "hours"
+	MeasureAmount = "amount"
+)
+
+// BudgetStore is what budget tracking reads: projects, the rates they bill
+// and the time tracked against them.
+type BudgetStore interface {
+	RateStore
+	store.TimeEntryStore
+}
+
+// ProjectBudget is how much of a project's budgets has been used. Consumed
+// figures include the running timer, and amounts value each entry at its
+// resolved rate. HourlyRate is the rate of time tracked now.
+type ProjectBudget struct {
+	ProjectID      int     `json:"project_id"`
+	Project        string  `json:"project"`
+	HourlyRate     float64 `json:"hourly_rate"`
+	HoursConsumed  float64 `json:"hours_consumed"`
+	HoursBudget    float64 `json:"hours_budget,omitempty"`
+	HoursPercent   float64 `json:"hours_percent,omitempty"`
+	AmountConsumed float64 `json:"amount_consumed"`
+	AmountBudget   float64 `json:"amount_budget,omitempty"`
+	AmountPercent  float64 `json:"amount_percent,omitempty"`
+	// RunningHours is the part of HoursConsumed on the running timer.
+	RunningHours float64 `json:"running_hours,omitempty"`
+	// The burn rate is the average tracked per day over the last 30 days,
+	// or since the project's first entry if that is more recent.
+	BurnRateHoursPerDay  float64 `json:"burn_rate_hours_per_day"`
+	BurnRateAmountPerDay float64 `json:"burn_rate_amount_per_day"`
+	// ProjectedExhaustion is the date, YYYY-MM-DD, the first budget runs
+	// out at the burn rate. It is empty once a budget is exhausted or if
+	// nothing is being burnt.
+	ProjectedExhaustion string `json:"projected_exhaustion,omitempty"`
+	Exhausted           bool   `json:"exhausted"`
+	// ThresholdsReached are the configured thresholds, in percent, that
+	// either budget has reached.
+	ThresholdsReached []float64 `json:"thresholds_reached"`
+}
+
+// BudgetEvent reports that the time tracked against a project crossed one
+// of the configured budget thresholds.
+type BudgetEvent struct {
+	ProjectID int    `json:"project_id"`
+	Project   string `json:"project"`
+	// Measure is MeasureHours or MeasureAmount.
+	Measure   string  `json:"measure"`
+	Threshold float64 `json:"threshold"`
+	Consumed  float64 `json:"consumed"`
+	Budget    float64 `json:"budget"`
+}
+
+// BudgetService reports project budgets and emits threshold events as time
+// is tracked against them.
+type BudgetService struct {
+	config *config.Config
+	store  BudgetStore
+	rates  *RateService
+}
+
+// NewBudgetService creates a service reading budgets from st. Without a
+// store there are no budgets to track.
+func NewBudgetService(cfg *config.Config, st *store.SQLiteStore) *BudgetService {
+	service := &BudgetService{config: cfg, rates: NewRateService(cfg, nil)}
+	if st != nil {
+		service.store = st
+		service.rates = NewRateService(cfg, st)
+	}
+	return service
+}
+
+// ProjectBudget reports the budgets of the project with the given ID.
+func (s *BudgetService) ProjectBudget(ctx context.Context, id int) (*ProjectBudget, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	userID := UserID(ctx)
+	project, err := s.store.GetProject(userID, id)
+	if err != nil {
+		return nil, storeProjectError(id, nil, err)
+	}
+	rates, err := s.rates.Rates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve hourly rates: %w", err)
+	}
+	entries, err := s.store.ListEntries(userID, store.EntryFilter{Project: project.Name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time entries of project %d: %w", id, err)
+	}
+
+	now := time.Now()
+	consumed, amount := trackedTime(entries, rates, now, time.Time{}, false)
+	completed, _ := trackedTime(entries, rates, now, time.Time{}, true)
+	budget := &ProjectBudget{
+		ProjectID:      project.ID,
+		Project:        project.Name,
+		HoursConsumed:  minutesToHours(int(consumed.Minutes())),
+		HoursBudget:    project.BudgetHours,
+		AmountConsumed: roundCents(amount),
+		AmountBudget:   project.BudgetAmount,
+		RunningHours:   minutesToHours(int((consumed - completed).Minutes())),
+	}
+	budget.HourlyRate, _ = rates.EntryRate(store.TimeEntry{Project: project.Name, StartTime: now})
+
+	// The burn rate window starts no earlier than the first entry, so new
+	// projects are not diluted by days before they began
+	windowStart := now.Add(-burnRateWindow)
+	if first := firstStart(entries); first.After(windowStart) {
+		windowStart = first
+	}
+	days := now.Sub(windowStart).Hours() / 24
+	if days < 1 {
+		days = 1
+	}
+	burnt, burntAmount := trackedTime(entries, rates, now, windowStart, false)
+	budget.BurnRateHoursPerDay = roundCents(burnt.Hours() / days)
+	budget.BurnRateAmountPerDay = roundCents(burntAmount / days)
+
+	reached := map[float64]bool{}
+	var exhaustion time.Time
+	for _, measure := range []struct {
+		budget, consumed, burnRate float64
+		percent                    *float64
+	}{
+		{project.BudgetHours, consumed.Hours(), burnt.Hours() / days, &budget.HoursPercent},
+		{project.BudgetAmount, amount, burntAmount / days, &budget.AmountPercent},
+	} {
+		if measure.budget <= 0 {
+			continue
+		}
+		*measure.percent = roundCents(measure.consumed / measure.budget * 100)
+		for _, threshold := range s.config.BudgetThresholds {
+			if *measure.percent >= threshold {
+				reached[threshold] = true
+			}
+		}
+
+		remaining := measure.budget - measure.consumed
+		switch {
+		case remaining <= 0:
+			budget.Exhausted = true
+		case measure.burnRate > 0:
+			at := now.Add(time.Duration(remaining / measure.burnRate * 24 * float64(time.Hour)))
+			if exhaustion.IsZero() || at.Before(exhaustion) {
+				exhaustion = at
+			}
+		}
+	}
+	if !budget.Exhausted && !exhaustion.IsZero() {
+		budget.ProjectedExhaustion = exhaustion.Format("2006-01-02")
+	}
+
+	budget.ThresholdsReached = []float64{}
+	for _, threshold := range s.config.BudgetThresholds {
+		if reached[threshold] {
+			budget.ThresholdsReached = append(budget.ThresholdsReached, threshold)
+		}
+	}
+	return budget, nil
+}
+
+// EntryChanged emits an event for every budget threshold that the change
+// of an entry from old to updated pushes a project's completed time past,
+// and returns the events. old is nil for new entries and running timers.
+// Failures are logged rather than returned, since the change itself has
+// already been saved.
+func (s *BudgetService) EntryChanged(ctx context.Context, old, updated *store.TimeEntry) []BudgetEvent {
+	if s == nil || s.store == nil {
+		return nil
+	}
+
+	var events []BudgetEvent
+	seen := map[string]bool{}
+	for _, entry := range []*store.TimeEntry{old, updated} {
+		if entry == nil || seen[entry.Project] {
+			continue
+		}
+		seen[entry.Project] = true
+
+		crossed, err := s.crossings(ctx, entry.Project, old, updated)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to check project budget", "project", entry.Project, "error", err)
+			continue
+		}
+		events = append(events, crossed...)
+	}
+
+	for _, event := range events {
+		logging.FromContext(ctx).Warn("budget threshold crossed",
+			"project_id", event.ProjectID,
+			"project", event.Project,
+			"measure", event.Measure,
+			"threshold", event.Threshold,
+			"consumed", event.Consumed,
+			"budget", event.Budget)
+	}
+	return events
+}
+
+// crossings returns the thresholds of the named project crossed by the
+// change of an entry from old to updated.
+func (s *BudgetService) crossings(ctx context.Context, name string, old, updated *store.TimeEntry) ([]BudgetEvent, error) {
+	userID := UserID(ctx)
+	project, err := s.store.GetProjectByName(userID, name)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if project.BudgetHours <= 0 && project.BudgetAmount <= 0 {
+		return nil, nil
+	}
+
+	rates, err := s.rates.Rates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.store.ListEntries(userID, store.EntryFilter{Project: name})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	after, afterAmount := trackedTime(entries, rates, now, time.Time{}, true)
+	before, beforeAmount := after, afterAmount
+	if updated != nil && updated.Project == name {
+		duration, amount := trackedTime([]store.TimeEntry{*updated}, rates, now, time.Time{}, true)
+		before, beforeAmount = before-duration, beforeAmount-amount
+	}
+	if old != nil && old.Project == name {
+		duration, amount := trackedTime([]store.TimeEntry{*old}, rates, now, time.Time{}, true)
+		before, beforeAmount = before+duration, beforeAmount+amount
+	}
+
+	var events []BudgetEvent
+	for _, measure := range []struct {
+		name                  string
+		budget, before, after float64
+	}{
+		{MeasureHours, project.BudgetHours, before.Hours(), after.Hours()},
+		{MeasureAmount, project.BudgetAmount, beforeAmount, afterAmount},
+	} {
+		if measure.budget <= 0 {
+			continue
+		}
+		for _, threshold := range s.config.BudgetThresholds {
+			limit := measure.budget * threshold / 100
+			if measure.before < limit && measure.after >= limit {
+				events = append(events, BudgetEvent{
+					ProjectID: project.ID,
+					Project:   project.Name,
+					Measure:   measure.name,
+					Threshold: threshold,
+					Consumed:  roundCents(measure.after),
+					Budget:    measure.budget,
+				})
+			}
+		}
+	}
+	return events, nil
+}
+
+// trackedTime adds up the time tracked in entries since since and what it
+// is worth at rates, counting running entries up to now unless
+// completedOnly is set. Paused time is not tracked, and time on fixed-fee
+// projects is worth nothing by the hour.
+func trackedTime(entries []store.TimeEntry, rates *Rates, now, since time.Time, completedOnly bool) (time.Duration, float64) {
+	var total time.Duration
+	var amount float64
+	for _, entry := range entries {
+		if entry.EndTime == nil && completedOnly {
+			continue
+		}
+
+		if active := entry.ActiveTime(since, now); active > 0 {
+			rate, _ := rates.EntryRate(entry)
+			total += active
+			amount += active.Hours() * rate
+		}
+	}
+	return total, amount
+}
+
+// firstStart returns the earliest start time of entries.
+func firstStart(entries []store.TimeEntry) time.Time {
+	var first time.Time
+	for _, entry := range entries {
+		if first.IsZero() || entry.StartTime.Before(first) {
+			first = entry.StartTime
+		}
+	}
+	return first
+}
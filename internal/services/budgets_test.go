@@ -0,0 +1,134 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/logging"
+	"kb-freelance-api/internal/store"
+)
+
+// newBudgetTestServices returns a time tracker watching the budgets of a
+// project with a budget of 4 hours or 400 at its client's rate of 100.
+func newBudgetTestServices(t *testing.T) (*TimeTrackerService, *BudgetService, *store.SQLiteStore, *Project) {
+	t.Helper()
+
+	st := openUserTestStore(t)
+	cfg := &config.Config{BudgetThresholds: []float64{50, 100}}
+	ctx := context.Background()
+
+	client, err := NewClientService(st).CreateClient(ctx, Client{Name: "Acme", HourlyRate: 100})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	project, err := NewProjectService(st).CreateProject(ctx, Project{Name: "Website", ClientID: &client.ID, BudgetHours: 4, BudgetAmount: 400})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+
+	budgets := NewBudgetService(cfg, st)
+	tracker := NewTimeTrackerServiceWithStore(cfg, st)
+	tracker.WatchBudgets(budgets)
+	return tracker, budgets, st, project
+}
+
+func TestBudgetEvents(t *testing.T) {
+	tracker, _, st, _ := newBudgetTestServices(t)
+	var logs bytes.Buffer
+	ctx := logging.NewContext(context.Background(), slog.New(slog.NewTextHandler(&logs, nil)))
+	start := time.Now().Add(-72 * time.Hour)
+
+	// Two of four hours cross the 50% threshold of both budgets
+	entry, err := tracker.CreateEntry(ctx, "Acme", "Website", "", start, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	if len(entry.BudgetEvents) != 2 || entry.BudgetEvents[0].Measure != MeasureHours || entry.BudgetEvents[0].Threshold != 50 ||
+		entry.BudgetEvents[1].Measure != MeasureAmount || entry.BudgetEvents[1].Consumed != 200 {
+		t.Errorf("Expected both budgets to cross 50%%, got %+v", entry.BudgetEvents)
+	}
+	if !strings.Contains(logs.String(), "budget threshold crossed") {
+		t.Errorf("Expected the events to be logged, got %q", logs.String())
+	}
+
+	// Thresholds already crossed are not reported again
+	if other, err := tracker.CreateEntry(ctx, "Acme", "Website", "", start.Add(24*time.Hour), start.Add(25*time.Hour)); err != nil || len(other.BudgetEvents) != 0 {
+		t.Errorf("Expected no events below 100%%, got %+v, %v", other, err)
+	}
+
+	// Stopping a timer that reaches the budget crosses 100%
+	if _, err := st.StartEntry(store.DefaultUserID, "Acme", "Website", "", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("StartEntry failed: %v", err)
+	}
+	stopped, err := tracker.StopTimer(ctx)
+	if err != nil {
+		t.Fatalf("StopTimer failed: %v", err)
+	}
+	if len(stopped.BudgetEvents) != 2 || stopped.BudgetEvents[0].Threshold != 100 {
+		t.Errorf("Expected both budgets to cross 100%%, got %+v", stopped.BudgetEvents)
+	}
+
+	// Moving time off the project and back crosses the threshold again
+	project := "Other"
+	if _, err := tracker.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{Project: &project}); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	project = "Website"
+	moved, err := tracker.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{Project: &project})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if len(moved.BudgetEvents) != 2 || moved.BudgetEvents[0].Threshold != 100 {
+		t.Errorf("Expected the edit to cross 100%% again, got %+v", moved.BudgetEvents)
+	}
+
+	// Unregistered projects have no budgets
+	if unknown, err := tracker.CreateEntry(ctx, "Acme", "Unregistered", "", start, start.Add(8*time.Hour)); err != nil || len(unknown.BudgetEvents) != 0 {
+		t.Errorf("Expected no events without a registered project, got %+v, %v", unknown, err)
+	}
+}
+
+func TestProjectBudget(t *testing.T) {
+	tracker, budgets, st, project := newBudgetTestServices(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	start := now.Add(-48 * time.Hour)
+	if _, err := tracker.CreateEntry(ctx, "Acme", "Website", "", start, start.Add(90*time.Minute)); err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	if _, err := st.StartEntry(store.DefaultUserID, "Acme", "Website", "", now.Add(-30*time.Minute)); err != nil {
+		t.Fatalf("StartEntry failed: %v", err)
+	}
+
+	budget, err := budgets.ProjectBudget(ctx, project.ID)
+	if err != nil {
+		t.Fatalf("ProjectBudget failed: %v", err)
+	}
+	if budget.HoursConsumed != 2 || budget.RunningHours != 0.5 || budget.AmountConsumed != 200 || budget.HourlyRate != 100 {
+		t.Errorf("Expected 2 hours worth 200 including the running timer, got %+v", budget)
+	}
+	if budget.HoursPercent != 50 || budget.AmountPercent != 50 || len(budget.ThresholdsReached) != 1 || budget.ThresholdsReached[0] != 50 {
+		t.Errorf("Expected half of both budgets used, got %+v", budget)
+	}
+	// Two hours over two days burn a budget of four hours in two more days
+	if budget.BurnRateHoursPerDay != 1 || budget.BurnRateAmountPerDay != 100 {
+		t.Errorf("Expected a burn rate of 1 hour a day, got %+v", budget)
+	}
+	if want := now.AddDate(0, 0, 2).Format("2006-01-02"); budget.ProjectedExhaustion != want || budget.Exhausted {
+		t.Errorf("Expected the budget to run out on %s, got %+v", want, budget)
+	}
+
+	if _, err := budgets.ProjectBudget(ctx, 99); !errors.Is(err, ErrProjectNotFound) {
+		t.Errorf("Expected ErrProjectNotFound, got %v", err)
+	}
+	if _, err := NewBudgetService(&config.Config{}, nil).ProjectBudget(ctx, project.ID); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+}
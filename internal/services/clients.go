@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"kb-freelance-api/internal/store"
+)
+
+var (
+	ErrClientNotFound = &Error{Kind: KindNotFound, Code: "client_not_found", Message: "client not found"}
+	ErrClientExists   = &Error{Kind: KindConflict, Code: "client_exists", Message: "a client with this name already exists"}
+	ErrClientInUse    = &Error{Kind: KindConflict, Code: "client_in_use", Message: "client has invoices or projects and cannot be deleted"}
+	ErrInvalidClient  = &Error{Kind: KindValidation, Code: "invalid_client", Message: "invalid client"}
+)
+
+// Client is a registered client. Name is what time entries record; the
+// rest fills in invoices generated for the client.
+type Client struct {
+	ID             int      `json:"id"`
+	Name           string   `json:"name"`
+	LegalName      string   `json:"legal_name,omitempty"`
+	Emails         []string `json:"emails"`
+	BillingAddress string   `json:"billing_address,omitempty"`
+	TaxID          string   `json:"tax_id,omitempty"`
+	Currency       string   `json:"currency,omitempty"`
+	// PaymentTermsDays is how many days after issue invoices are due;
+	// nil uses INVOICE_DUE_DAYS.
+	PaymentTermsDays *int `json:"payment_terms_days,omitempty"`
+	// HourlyRate is the default rate for the client's work; zero means
+	// none.
+	HourlyRate float64   `json:"hourly_rate,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// InvoiceName is the name invoices are addressed to: the legal name, if
+// the client has one.
+func (c *Client) InvoiceName() string {
+	if c.LegalName != "" {
+		return c.LegalName
+	}
+	return c.Name
+}
+
+// InvoiceEmail is the address invoices are sent to: the first of the
+// client's emails.
+func (c *Client) InvoiceEmail() string {
+	if len(c.Emails) == 0 {
+		return ""
+	}
+	return c.Emails[0]
+}
+
+// ClientUpdate holds the fields to change on a client. Nil fields are left
+// untouched; ClearPaymentTerms removes the client's payment terms.
+type ClientUpdate struct {
+	Name              *string
+	LegalName         *string
+	Emails            *[]string
+	BillingAddress    *string
+	TaxID             *string
+	Currency          *string
+	PaymentTermsDays  *int
+	ClearPaymentTerms bool
+	HourlyRate        *float64
+}
+
+// ClientService keeps the registry of each user's clients.
+type ClientService struct {
+	store store.ClientStore
+}
+
+// NewClientService creates a service keeping clients in st. Without a
+// store there are no clients.
+func NewClientService(st *store.SQLiteStore) *ClientService {
+	service := &ClientService{}
+	if st != nil {
+		service.store = st
+	}
+	return service
+}
+
+// currencyPattern matches ISO 4217 currency codes.
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// maxPaymentTermsDays bounds payment terms to something plausible.
+const maxPaymentTermsDays = 365
+
+// normalizeClient trims the client's fields and checks them.
+func normalizeClient(client *store.Client) error {
+	client.Name = strings.TrimSpace(client.Name)
+	client.LegalName = strings.TrimSpace(client.LegalName)
+	client.BillingAddress = strings.TrimSpace(client.BillingAddress)
+	client.TaxID = strings.TrimSpace(client.TaxID)
+	client.Currency = strings.ToUpper(strings.TrimSpace(client.Currency))
+
+	if client.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidClient)
+	}
+
+	emails := make([]string, 0, len(client.Emails))
+	for _, email := range client.Emails {
+		address, err := mail.ParseAddress(strings.TrimSpace(email))
+		if err != nil {
+			return WithDetails(fmt.Errorf("%w: invalid email %q", ErrInvalidClient, email),
+				map[string]interface{}{"field": "emails"})
+		}
+		emails = append(emails, address.Address)
+	}
+	client.Emails = emails
+
+	if client.Currency != "" && !currencyPattern.MatchString(client.Currency) {
+		return WithDetails(fmt.Errorf("%w: currency must be a three-letter ISO 4217 code", ErrInvalidClient),
+			map[string]interface{}{"field": "currency"})
+	}
+	if terms := client.PaymentTermsDays; terms != nil && (*terms < 0 || *terms > maxPaymentTermsDays) {
+		return WithDetails(fmt.Errorf("%w: payment terms must be between 0 and %d days", ErrInvalidClient, maxPaymentTermsDays),
+			map[string]interface{}{"field": "payment_terms_days"})
+	}
+	if client.HourlyRate < 0 {
+		return WithDetails(fmt.Errorf("%w: hourly rate cannot be negative", ErrInvalidClient),
+			map[string]interface{}{"field": "hourly_rate"})
+	}
+	return nil
+}
+
+// CreateClient registers a client. Names are unique per user.
+func (s *ClientService) CreateClient(ctx context.Context, client Client) (*Client, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	row := storeClient(client)
+	if err := normalizeClient(&row); err != nil {
+		return nil, err
+	}
+
+	created, err := s.store.CreateClient(UserID(ctx), row)
+	if err != nil {
+		return nil, storeClientError(0, row.Name, err)
+	}
+
+	result := newClient(*created)
+	return &result, nil
+}
+
+// GetClient returns a single client by ID.
+func (s *ClientService) GetClient(ctx context.Context, id int) (*Client, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	row, err := s.store.GetClient(UserID(ctx), id)
+	if err != nil {
+		return nil, storeClientError(id, "", err)
+	}
+
+	client := newClient(*row)
+	return &client, nil
+}
+
+// ListClients returns every client, ordered by name.
+func (s *ClientService) ListClients(ctx context.Context) ([]Client, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	rows, err := s.store.ListClients(UserID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make([]Client, 0, len(rows))
+	for _, row := range rows {
+		clients = append(clients, newClient(row))
+	}
+	return clients, nil
+}
+
+// UpdateClient applies update to an existing client. Renaming a client
+// does not change the client recorded on its past time entries.
+func (s *ClientService) UpdateClient(ctx context.Context, id int, update ClientUpdate) (*Client, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	var name string
+	row, err := s.store.UpdateClient(UserID(ctx), id, func(client *store.Client) error {
+		if update.Name != nil {
+			client.Name = *update.Name
+		}
+		if update.LegalName != nil {
+			client.LegalName = *update.LegalName
+		}
+		if update.Emails != nil {
+			client.Emails = *update.Emails
+		}
+		if update.BillingAddress != nil {
+			client.BillingAddress = *update.BillingAddress
+		}
+		if update.TaxID != nil {
+			client.TaxID = *update.TaxID
+		}
+		if update.Currency != nil {
+			client.Currency = *update.Currency
+		}
+		if update.ClearPaymentTerms {
+			client.PaymentTermsDays = nil
+		}
+		if update.PaymentTermsDays != nil {
+			days := *update.PaymentTermsDays
+			client.PaymentTermsDays = &days
+		}
+		if update.HourlyRate != nil {
+			client.HourlyRate = *update.HourlyRate
+		}
+		name = client.Name
+		return normalizeClient(client)
+	})
+	if err != nil {
+		return nil, storeClientError(id, name, err)
+	}
+
+	client := newClient(*row)
+	return &client, nil
+}
+
+// DeleteClient removes a client that has no invoices or projects.
+func (s *ClientService) DeleteClient(ctx context.Context, id int) error {
+	if s.store == nil {
+		return ErrStoreRequired
+	}
+
+	if err := s.store.DeleteClient(UserID(ctx), id); err != nil {
+		return storeClientError(id, "", err)
+	}
+	return nil
+}
+
+func storeClientError(id int, name string, err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return WithDetails(fmt.Errorf("%w: %d", ErrClientNotFound, id), map[string]interface{}{"id": id})
+	case errors.Is(err, store.ErrClientExists):
+		return WithDetails(fmt.Errorf("%w: %s", ErrClientExists, name), map[string]interface{}{"name": name})
+	case errors.Is(err, store.ErrClientInUse):
+		return WithDetails(fmt.Errorf("%w: %d", ErrClientInUse, id), map[string]interface{}{"id": id})
+	case errors.Is(err, ErrInvalidClient):
+		return err
+	}
+	return fmt.Errorf("failed to access client %d: %w", id, err)
+}
+
+func storeClient(client Client) store.Client {
+	return store.Client{
+		Name:             client.Name,
+		LegalName:        client.LegalName,
+		Emails:           client.Emails,
+		BillingAddress:   client.BillingAddress,
+		TaxID:            client.TaxID,
+		Currency:         client.Currency,
+		PaymentTermsDays: client.PaymentTermsDays,
+		HourlyRate:       client.HourlyRate,
+	}
+}
+
+func newClient(row store.Client) Client {
+	return Client{
+		ID:               row.ID,
+		Name:             row.Name,
+		LegalName:        row.LegalName,
+		Emails:           row.Emails,
+		BillingAddress:   row.BillingAddress,
+		TaxID:            row.TaxID,
+		Currency:         row.Currency,
+		PaymentTermsDays: row.PaymentTermsDays,
+		HourlyRate:       row.HourlyRate,
+		CreatedAt:        row.CreatedAt,
+		UpdatedAt:        row.UpdatedAt,
+	}
+}
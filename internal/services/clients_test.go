@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/store"
+)
+
+func TestClientService(t *testing.T) {
+	service := NewClientService(openUserTestStore(t))
+	ctx := context.Background()
+
+	terms := 30
+	client, err := service.CreateClient(ctx, Client{
+		Name:             " Acme ",
+		LegalName:        "Acme Corporation Ltd",
+		Emails:           []string{"Billing <billing@acme.test>", "cto@acme.test"},
+		Currency:         "eur",
+		PaymentTermsDays: &terms,
+		HourlyRate:       90,
+	})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	if client.Name != "Acme" || client.Currency != "EUR" || client.InvoiceEmail() != "billing@acme.test" {
+		t.Errorf("Unexpected client: %+v", client)
+	}
+	if client.InvoiceName() != "Acme Corporation Ltd" {
+		t.Errorf("Expected the legal name on invoices, got %s", client.InvoiceName())
+	}
+
+	if _, err := service.CreateClient(ctx, Client{Name: "Acme"}); !errors.Is(err, ErrClientExists) {
+		t.Errorf("Expected ErrClientExists, got %v", err)
+	}
+
+	invalid := []Client{
+		{Name: " "},
+		{Name: "Bad email", Emails: []string{"not an address"}},
+		{Name: "Bad currency", Currency: "euro"},
+		{Name: "Bad terms", PaymentTermsDays: new(int)},
+		{Name: "Bad rate", HourlyRate: -1},
+	}
+	*invalid[3].PaymentTermsDays = -1
+	for _, test := range invalid {
+		if _, err := service.CreateClient(ctx, test); !errors.Is(err, ErrInvalidClient) {
+			t.Errorf("%s: expected ErrInvalidClient, got %v", test.Name, err)
+		}
+	}
+
+	name, rate := "Acme Inc", 100.0
+	updated, err := service.UpdateClient(ctx, client.ID, ClientUpdate{Name: &name, HourlyRate: &rate, ClearPaymentTerms: true})
+	if err != nil {
+		t.Fatalf("UpdateClient failed: %v", err)
+	}
+	if updated.Name != name || updated.HourlyRate != rate || updated.PaymentTermsDays != nil || updated.Currency != "EUR" {
+		t.Errorf("Unexpected updated client: %+v", updated)
+	}
+
+	other, err := service.CreateClient(ctx, Client{Name: "Globex"})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	if _, err := service.UpdateClient(ctx, other.ID, ClientUpdate{Name: &name}); !errors.Is(err, ErrClientExists) {
+		t.Errorf("Expected ErrClientExists renaming onto another client, got %v", err)
+	}
+
+	clients, err := service.ListClients(ctx)
+	if err != nil {
+		t.Fatalf("ListClients failed: %v", err)
+	}
+	if len(clients) != 2 || clients[0].Name != "Acme Inc" || clients[1].Name != "Globex" {
+		t.Errorf("Expected clients ordered by name, got %+v", clients)
+	}
+
+	if err := service.DeleteClient(ctx, other.ID); err != nil {
+		t.Fatalf("DeleteClient failed: %v", err)
+	}
+	if _, err := service.GetClient(ctx, other.ID); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+
+	if _, err := NewClientService(nil).ListClients(ctx); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+}
+
+func TestGenerateClientInvoice(t *testing.T) {
+	renderer := &recordingRenderer{}
+	service := newRecordingInvoiceService(t, renderer)
+	clients := NewClientService(service.store.(*store.SQLiteStore))
+	ctx := context.Background()
+
+	terms := 30
+	client, err := clients.CreateClient(ctx, Client{
+		Name:             "Acme",
+		LegalName:        "Acme Corporation Ltd",
+		Emails:           []string{"billing@acme.test"},
+		BillingAddress:   "1 Main Street\nSpringfield",
+		TaxID:            "GB123456789",
+		Currency:         "GBP",
+		PaymentTermsDays: &terms,
+		HourlyRate:       90,
+	})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+
+	result, err := service.GenerateClientInvoice(ctx, *client, []InvoiceLineItem{
+		{Description: "Design", Hours: 2},
+		{Description: "Hosting", Hours: 1, Rate: 20},
+	}, "", "2026-03-01")
+	if err != nil {
+		t.Fatalf("GenerateClientInvoice failed: %v", err)
+	}
+	if result["total"] != 200.0 || result["currency"] != "GBP" || result["due_date"] != "2026-03-31" {
+		t.Errorf("Unexpected result: %v", result)
+	}
+	if renderer.req.ClientName != "Acme Corporation Ltd" || renderer.req.ClientAddress != client.BillingAddress ||
+		renderer.req.ClientTaxID != "GB123456789" {
+		t.Errorf("Expected the renderer to receive the client's details, got %+v", renderer.req)
+	}
+
+	invoice, err := service.GetInvoice(ctx, result["invoice_id"].(int))
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if invoice.ClientID == nil || *invoice.ClientID != client.ID || invoice.Currency != "GBP" {
+		t.Errorf("Expected the invoice to reference client %d in GBP, got %+v", client.ID, invoice)
+	}
+
+	if err := clients.DeleteClient(ctx, client.ID); !errors.Is(err, ErrClientInUse) {
+		t.Errorf("Expected ErrClientInUse, got %v", err)
+	}
+}
+
+func TestGenerateClientInvoiceRejectsAddressForCLI(t *testing.T) {
+	service := NewInvoiceService(&config.Config{InvoiceGenPath: t.TempDir()})
+	client := Client{Name: "Acme", Emails: []string{"billing@acme.test"}, BillingAddress: "1 Main Street"}
+
+	_, err := service.GenerateClientInvoice(context.Background(), client, []InvoiceLineItem{
+		{Description: "Design", Hours: 1, Rate: 50},
+	}, "", "")
+	if !errors.Is(err, ErrInvoiceNotRepresentable) {
+		t.Errorf("Expected ErrInvoiceNotRepresentable, got %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"kb-freelance-api/internal/logging"
+)
+
+// ErrCommandTimeout means a CLI did not finish within the configured
+// timeout and was killed.
+var ErrCommandTimeout = &Error{Kind: KindTimeout, Code: "command_timeout", Message: "command timed out"}
+
+// Command describes an external program run on behalf of a service.
+type Command struct {
+	Name string
+	Args []string
+	// Dir is the working directory; empty means the current one.
+	Dir string
+	// Env is added to the environment the API itself runs with.
+	Env   []string
+	Stdin io.Reader
+}
+
+// redactedFlags are the CLI flags whose values are left out of logs
+// because they hold client data.
+var redactedFlags = []string{"--notes"}
+
+// String formats the command line for logs, leaving out client notes.
+func (c Command) String() string {
+	words := append([]string{c.Name}, c.Args...)
+	for i := 1; i < len(words); i++ {
+		if slices.Contains(redactedFlags, words[i-1]) {
+			words[i] = logging.Redacted
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// CommandRunner runs external programs. Services use it for every call to
+// the Python CLIs so tests can script the CLIs instead of installing them.
+type CommandRunner interface {
+	// Run runs cmd to completion and returns its combined stdout and
+	// stderr. A non-zero exit status is returned as an error alongside
+	// whatever the command printed.
+	Run(ctx context.Context, cmd Command) ([]byte, error)
+}
+
+// runCommand runs cmd through runner, killing it once timeout passes if
+// timeout is positive. A command that runs out of time returns whatever it
+// printed and an error wrapping ErrCommandTimeout.
+func runCommand(ctx context.Context, runner CommandRunner, cmd Command, timeout time.Duration) ([]byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Debug("running command", "command", cmd, "dir", cmd.Dir)
+	started := time.Now()
+	output, err := runner.Run(ctx, cmd)
+	// The output may hold client data, so only its size is logged
+	logger.Debug("command finished", "command", cmd, "duration", time.Since(started), "error", err, "output_bytes", len(output))
+
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %s did not finish within %s", ErrCommandTimeout, cmd, timeout)
+		return output, WithDetails(err, map[string]interface{}{"timeout_seconds": timeout.Seconds()})
+	}
+	return output, err
+}
+
+// commandError describes a failed CLI command as an upstream error, or as
+// a timeout if it ran out of time. The output is kept for the logs.
+func commandError(upstream *Error, action string, err error, output []byte) error {
+	if errors.Is(err, ErrCommandTimeout) {
+		return fmt.Errorf("failed to %s: %w, output: %s", action, err, output)
+	}
+	return fmt.Errorf("%w: failed to %s: %w, output: %s", upstream, action, err, output)
+}
+
+// ExecRunner runs commands as child processes. When the context is done the
+// whole process group is killed, so processes the CLIs start do not outlive
+// them.
+type ExecRunner struct{}
+
+// execWaitDelay is how long Run waits for the output of a killed command
+// before giving up on it.
+const execWaitDelay = time.Second
+
+func (ExecRunner) Run(ctx context.Context, cmd Command) ([]byte, error) {
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	c.Dir = cmd.Dir
+	if len(cmd.Env) > 0 {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+	c.Stdin = cmd.Stdin
+	c.WaitDelay = execWaitDelay
+	killProcessGroupOnCancel(c)
+	return c.CombinedOutput()
+}
+
+// ScriptedRunner is a CommandRunner that answers from a script instead of
+// running anything. It lets tests exercise code that shells out to the
+// Python CLIs without Python installed.
+type ScriptedRunner struct {
+	mu      sync.Mutex
+	replies []*ScriptedReply
+	calls   []Command
+}
+
+// ScriptedReply is the answer to commands whose arguments start with a
+// given prefix.
+type ScriptedReply struct {
+	args   []string
+	once   bool
+	used   bool
+	handle func(ctx context.Context, cmd Command) ([]byte, error)
+}
+
+// On scripts the reply to commands whose arguments start with args.
+// Replies are matched in the order they were added.
+func (r *ScriptedRunner) On(args ...string) *ScriptedReply {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reply := &ScriptedReply{args: args}
+	r.replies = append(r.replies, reply)
+	return reply
+}
+
+// Return makes the command print output and fail with err, if it is not nil.
+func (s *ScriptedReply) Return(output string, err error) *ScriptedReply {
+	return s.Do(func(context.Context, Command) ([]byte, error) {
+		return []byte(output), err
+	})
+}
+
+// Do answers the command by calling fn, e.g. to write the files a real
+// command would or to hang until ctx is done.
+func (s *ScriptedReply) Do(fn func(ctx context.Context, cmd Command) ([]byte, error)) *ScriptedReply {
+	s.handle = fn
+	return s
+}
+
+// Once limits the reply to the first matching command, so later commands
+// fall through to the replies added after it.
+func (s *ScriptedReply) Once() *ScriptedReply {
+	s.once = true
+	return s
+}
+
+// Calls returns every command run so far.
+func (r *ScriptedRunner) Calls() []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.calls)
+}
+
+func (r *ScriptedRunner) Run(ctx context.Context, cmd Command) ([]byte, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, cmd)
+	var reply *ScriptedReply
+	for _, candidate := range r.replies {
+		if candidate.used || len(cmd.Args) < len(candidate.args) || !slices.Equal(cmd.Args[:len(candidate.args)], candidate.args) {
+			continue
+		}
+		reply = candidate
+		reply.used = reply.once
+		break
+	}
+	r.mu.Unlock()
+
+	if reply == nil || reply.handle == nil {
+		return nil, fmt.Errorf("unexpected command: %s", cmd)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return reply.handle(ctx, cmd)
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package services
+
+import "os/exec"
+
+// startInProcessGroup leaves c in the API's process group.
+func startInProcessGroup(c *exec.Cmd) {}
+
+// killProcessGroup kills only the process itself.
+func killProcessGroup(c *exec.Cmd) error {
+	return c.Process.Kill()
+}
+
+// killProcessGroupOnCancel leaves c with the default cancellation, which
+// kills only the process itself.
+func killProcessGroupOnCancel(c *exec.Cmd) {}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"kb-freelance-api/internal/logging"
+)
+
+func TestExecRunner(t *testing.T) {
+	dir := t.TempDir()
+	output, err := ExecRunner{}.Run(context.Background(), Command{
+		Name:  "sh",
+		Args:  []string{"-c", `pwd; echo "$KB_TEST_VALUE"; cat`},
+		Dir:   dir,
+		Env:   []string{"KB_TEST_VALUE=from env"},
+		Stdin: strings.NewReader("from stdin"),
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v, output: %s", err, output)
+	}
+
+	expected := dir + "\nfrom env\nfrom stdin"
+	if string(output) != expected {
+		t.Errorf("Expected output %q, got %q", expected, output)
+	}
+}
+
+func TestExecRunnerReportsExitStatus(t *testing.T) {
+	output, err := ExecRunner{}.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", "echo failed >&2; exit 3"}})
+	if err == nil {
+		t.Fatal("Expected an error for a non-zero exit status")
+	}
+	if string(output) != "failed\n" {
+		t.Errorf("Expected stderr in the output, got %q", output)
+	}
+}
+
+func TestRunCommandTimesOut(t *testing.T) {
+	// The background sleep keeps the output open, so the command only
+	// returns early if its whole process group is killed
+	cmd := Command{Name: "sh", Args: []string{"-c", "echo started; sleep 10 & wait"}}
+
+	begin := time.Now()
+	output, err := runCommand(context.Background(), ExecRunner{}, cmd, 100*time.Millisecond)
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Fatalf("Expected ErrCommandTimeout, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed >= execWaitDelay {
+		t.Errorf("Expected the process group to be killed promptly, took %s", elapsed)
+	}
+	if string(output) != "started\n" {
+		t.Errorf("Expected the output printed before the timeout, got %q", output)
+	}
+}
+
+func TestRunCommandCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := runCommand(ctx, ExecRunner{}, Command{Name: "sh", Args: []string{"-c", "sleep 10"}}, time.Minute)
+	if err == nil || errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("Expected a cancellation error other than a timeout, got %v", err)
+	}
+}
+
+func TestScriptedRunner(t *testing.T) {
+	runner := &ScriptedRunner{}
+	runner.On("status").Return("first", nil).Once()
+	runner.On("status").Return("later", nil)
+	runner.On("stop").Return("", errors.New("exit status 1"))
+
+	for _, expected := range []string{"first", "later", "later"} {
+		output, err := runner.Run(context.Background(), Command{Name: "tt", Args: []string{"status", "--json"}})
+		if err != nil || string(output) != expected {
+			t.Errorf("Expected %q, got %q, %v", expected, output, err)
+		}
+	}
+	if _, err := runner.Run(context.Background(), Command{Name: "tt", Args: []string{"stop"}}); err == nil {
+		t.Error("Expected the scripted error")
+	}
+	if _, err := runner.Run(context.Background(), Command{Name: "tt", Args: []string{"start"}}); err == nil {
+		t.Error("Expected an error for an unscripted command")
+	}
+
+	if calls := runner.Calls(); len(calls) != 5 || calls[4].Args[0] != "start" {
+		t.Errorf("Expected every command to be recorded, got %+v", calls)
+	}
+}
+
+func TestRunCommandLogsOnlyOutputSize(t *testing.T) {
+	var logs bytes.Buffer
+	ctx := logging.NewContext(context.Background(), logging.New(&logs, "debug", "text"))
+	runner := &ScriptedRunner{}
+	runner.On("status").Return("Acme Corp: 2h on the redesign\n", nil)
+
+	if _, err := runCommand(ctx, runner, Command{Name: "tt", Args: []string{"status"}}, 0); err != nil {
+		t.Fatalf("runCommand failed: %v", err)
+	}
+	if strings.Contains(logs.String(), "Acme") {
+		t.Errorf("Expected the command's output not to be logged, got %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "output_bytes=30") {
+		t.Errorf("Expected the size of the output to be logged, got %s", logs.String())
+	}
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package services
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startInProcessGroup makes c start in a process group of its own, so it
+// can be killed along with the processes it starts.
+func startInProcessGroup(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills the process group of c, which must have been
+// started with startInProcessGroup.
+func killProcessGroup(c *exec.Cmd) error {
+	return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+}
+
+// killProcessGroupOnCancel starts c in its own process group and kills the
+// group when c's context is done.
+func killProcessGroupOnCancel(c *exec.Cmd) {
+	startInProcessGroup(c)
+	c.Cancel = func() error {
+		return killProcessGroup(c)
+	}
+}
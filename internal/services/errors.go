@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"maps"
+)
+
+// ErrorKind classifies service errors. The API maps each kind to an HTTP
+// status code.
+type ErrorKind string
+
+const (
+	// KindValidation means the request itself is wrong.
+	KindValidation ErrorKind = "validation"
+	// KindUnauthorized means the request did not carry a valid API key.
+	KindUnauthorized ErrorKind = "unauthorized"
+	// KindForbidden means the API key lacks the scope the request needs.
+	KindForbidden ErrorKind = "forbidden"
+	// KindNotFound means a referenced record does not exist.
+	KindNotFound ErrorKind = "not_found"
+	// KindConflict means the request clashes with the current state, e.g.
+	// starting a timer while one is running.
+	KindConflict ErrorKind = "conflict"
+	// KindUnprocessable means the request is valid but cannot be carried
+	// out as given.
+	KindUnprocessable ErrorKind = "unprocessable"
+	// KindUpstream means one of the Python CLIs failed.
+	KindUpstream ErrorKind = "upstream"
+	// KindTimeout means one of the Python CLIs did not answer in time.
+	KindTimeout ErrorKind = "timeout"
+	// KindUnavailable means the service is too busy to take the request.
+	KindUnavailable ErrorKind = "unavailable"
+	// KindNotImplemented means the configured backend cannot do this.
+	KindNotImplemented ErrorKind = "not_implemented"
+)
+
+// Error is a service error of a known kind. Services return the Err*
+// values, usually wrapped with fmt.Errorf to add context.
+type Error struct {
+	Kind ErrorKind
+	// Code identifies the error for API clients, e.g. "timer_running".
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	// ErrTimerRunning means a timer was started while another is running.
+	ErrTimerRunning = &Error{Kind: KindConflict, Code: "timer_running", Message: "a timer is already running"}
+	// ErrNoTimerRunning means the timer was stopped while none is running.
+	ErrNoTimerRunning = &Error{Kind: KindConflict, Code: "no_timer_running", Message: "no timer is running"}
+	// ErrTimerPaused means the timer was paused while already paused.
+	ErrTimerPaused = &Error{Kind: KindConflict, Code: "timer_paused", Message: "the timer is already paused"}
+	// ErrTimerNotPaused means the timer was resumed while not paused.
+	ErrTimerNotPaused = &Error{Kind: KindConflict, Code: "timer_not_paused", Message: "the timer is not paused"}
+	// ErrTimeTrackerFailed means a kb-tt-cli command failed.
+	ErrTimeTrackerFailed = &Error{Kind: KindUpstream, Code: "time_tracker_failed", Message: "the time tracker failed"}
+	// ErrInvoiceGeneratorFailed means kb-invoice-gen-cli failed.
+	ErrInvoiceGeneratorFailed = &Error{Kind: KindUpstream, Code: "invoice_generator_failed", Message: "the invoice generator failed"}
+)
+
+// ClientMessage returns the description of err that is safe to show to
+// API clients. Upstream and timeout errors carry CLI output and file paths
+// in their context, so only their summary is returned; errors of no known
+// kind are not described at all.
+func ClientMessage(err error) string {
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) {
+		return "internal server error"
+	}
+	switch serviceErr.Kind {
+	case KindUpstream, KindTimeout:
+		return serviceErr.Message
+	default:
+		return err.Error()
+	}
+}
+
+// detailedError attaches details for API clients to an error.
+type detailedError struct {
+	err     error
+	details map[string]interface{}
+}
+
+func (e *detailedError) Error() string { return e.err.Error() }
+func (e *detailedError) Unwrap() error { return e.err }
+
+// WithDetails attaches details to err that are safe to show to clients,
+// such as the ID that was not found.
+func WithDetails(err error, details map[string]interface{}) error {
+	return &detailedError{err: err, details: details}
+}
+
+// ErrorDetails returns the client-safe details of err, including the exit
+// code of a failed command. It never returns nil.
+func ErrorDetails(err error) map[string]interface{} {
+	details := map[string]interface{}{}
+	var detailed *detailedError
+	if errors.As(err, &detailed) {
+		maps.Copy(details, detailed.details)
+	}
+	var exit interface{ ExitCode() int }
+	if errors.As(err, &exit) {
+		details["exit_code"] = exit.ExitCode()
+	}
+	return details
+}
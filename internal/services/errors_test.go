@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClientMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"validation context is kept", fmt.Errorf("%w: hours must be positive", ErrInvalidInvoice), "invalid invoice: hours must be positive"},
+		{"upstream context is dropped", commandError(ErrTimeTrackerFailed, "get status", errors.New("exit status 1"), []byte("Traceback ... /home/kb/tt/db.py")), "the time tracker failed"},
+		{"timeouts are not upstream failures", commandError(ErrTimeTrackerFailed, "get status", fmt.Errorf("%w: tt.cli", ErrCommandTimeout), nil), "command timed out"},
+		{"unknown errors are not described", errors.New("open /var/lib/kb/invoices.db: permission denied"), "internal server error"},
+	}
+
+	for _, test := range tests {
+		if message := ClientMessage(test.err); message != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, message)
+		}
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	_, err := ExecRunner{}.Run(context.Background(), Command{Name: "sh", Args: []string{"-c", "exit 3"}})
+	err = WithDetails(commandError(ErrInvoiceGeneratorFailed, "generate invoice", err, nil), map[string]interface{}{"client": "Acme"})
+
+	details := ErrorDetails(err)
+	if details["exit_code"] != 3 || details["client"] != "Acme" {
+		t.Errorf("Expected the exit code and attached details, got %v", details)
+	}
+	if !errors.Is(err, ErrInvoiceGeneratorFailed) {
+		t.Errorf("Expected the error to wrap ErrInvoiceGeneratorFailed, got %v", err)
+	}
+
+	if details := ErrorDetails(ErrTimerRunning); details == nil || len(details) != 0 {
+		t.Errorf("Expected empty details, got %v", details)
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -44,7 +45,7 @@ func TestTimeTrackerServiceIntegration(t *testing.T) {
 
 	// Test GetTodaySummary (this should work if Python tools are available)
 	t.Run("GetTodaySummary", func(t *testing.T) {
-		summary, err := service.GetTodaySummary()
+		summary, err := service.GetTodaySummary(context.Background())
 		if err != nil {
 			t.Logf("GetTodaySummary failed (expected if Python tools not available): %v", err)
 			return
@@ -59,7 +60,7 @@ func TestTimeTrackerServiceIntegration(t *testing.T) {
 
 	// Test GetStatus
 	t.Run("GetStatus", func(t *testing.T) {
-		status, err := service.GetStatus()
+		status, err := service.GetStatus(context.Background())
 		if err != nil {
 			t.Logf("GetStatus failed (expected if Python tools not available): %v", err)
 			return
@@ -115,7 +116,7 @@ func TestInvoiceServiceIntegration(t *testing.T) {
 			},
 		}
 
-		result, err := service.GenerateInvoice("Test Client", "test@example.com", lineItems, "Test notes", "2024-01-01")
+		result, err := service.GenerateInvoice(context.Background(), "Test Client", "test@example.com", lineItems, "Test notes", "2024-01-01")
 		if err != nil {
 			t.Logf("GenerateInvoice failed (expected if Python tools not available): %v", err)
 			return
@@ -1,22 +1,92 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/store"
 )
 
 type InvoiceService struct {
-	config *config.Config
+	config   *config.Config
+	renderer InvoiceRenderer
+	// store, when set, keeps a record of every generated invoice.
+	store store.InvoiceStore
+	// rates, when set, resolves the rates of time billed from the store.
+	rates *RateService
 }
 
+// NewInvoiceService creates a service using the renderer selected by
+// cfg.InvoiceRenderer.
 func NewInvoiceService(cfg *config.Config) *InvoiceService {
-	return &InvoiceService{config: cfg}
+	return NewInvoiceServiceWithRunner(cfg, ExecRunner{})
+}
+
+// NewInvoiceServiceWithRunner is like NewInvoiceService, but the Python
+// renderer runs kb-invoice-gen-cli through runner.
+func NewInvoiceServiceWithRunner(cfg *config.Config, runner CommandRunner) *InvoiceService {
+	var renderer InvoiceRenderer = NewPythonInvoiceRenderer(cfg, runner)
+	if cfg.InvoiceRenderer == "native" {
+		renderer = NewNativeInvoiceRenderer()
+	}
+	return &InvoiceService{config: cfg, renderer: renderer}
+}
+
+// NewInvoiceServiceWithStore creates a service that records generated
+// invoices in st and numbers them sequentially. Without a store invoices
+// are only rendered. The Python renderer, if selected, runs through runner.
+func NewInvoiceServiceWithStore(cfg *config.Config, st *store.SQLiteStore, runner CommandRunner) *InvoiceService {
+	service := NewInvoiceServiceWithRunner(cfg, runner)
+	if st != nil {
+		service.store = st
+	}
+	return service
+}
+
+// UseRates makes invoices generated from tracked time bill each entry at
+// the rate rates resolves for it. Without rates they bill
+// INVOICE_HOURLY_RATE.
+func (s *InvoiceService) UseRates(rates *RateService) {
+	s.rates = rates
+}
+
+// loadRates returns the rates invoices are billed at.
+func (s *InvoiceService) loadRates(ctx context.Context) (*Rates, error) {
+	rateService := s.rates
+	if rateService == nil {
+		rateService = NewRateService(s.config, nil)
+	}
+	return rateService.Rates(ctx)
+}
+
+// NewInvoiceServiceWithRenderer creates a service that renders PDFs with r.
+func NewInvoiceServiceWithRenderer(cfg *config.Config, r InvoiceRenderer) *InvoiceService {
+	return &InvoiceService{config: cfg, renderer: r}
+}
+
+// InvoiceRenderer produces the PDF for an invoice.
+type InvoiceRenderer interface {
+	// Render writes the invoice to pdfPath, giving up when ctx is done.
+	Render(ctx context.Context, req InvoiceRequest, totals *InvoiceTotals, pdfPath string) (*RenderedInvoice, error)
+}
+
+// RenderedInvoice describes the result of a Render call.
+type RenderedInvoice struct {
+	// Output is diagnostic output from the renderer, if it has any.
+	Output string
 }
 
 type InvoiceLineItem struct {
@@ -31,126 +101,378 @@ type InvoiceRequest struct {
 	LineItems   []InvoiceLineItem `json:"line_items"`
 	Notes       string            `json:"notes"`
 	Date        string            `json:"date"`
+	// Number and DueDate are filled in by the service before rendering.
+	Number  string `json:"number,omitempty"`
+	DueDate string `json:"due_date,omitempty"`
+	// ClientAddress, ClientTaxID and Currency are only known for
+	// registered clients.
+	ClientAddress string `json:"client_address,omitempty"`
+	ClientTaxID   string `json:"client_tax_id,omitempty"`
+	Currency      string `json:"currency,omitempty"`
+}
+
+var (
+	ErrInvalidInvoice = &Error{Kind: KindValidation, Code: "invalid_invoice", Message: "invalid invoice"}
+	// ErrInvoiceNotRepresentable means the generator cannot render the
+	// request as given, e.g. more line items than it supports.
+	ErrInvoiceNotRepresentable = &Error{Kind: KindUnprocessable, Code: "invoice_not_representable", Message: "invoice cannot be represented by the generator"}
+)
+
+// InvoiceLine is a line item with its computed amount.
+type InvoiceLine struct {
+	Description string  `json:"description"`
+	Hours       float64 `json:"hours"`
+	Rate        float64 `json:"rate"`
+	Amount      float64 `json:"amount"`
 }
 
-func (s *InvoiceService) GenerateInvoice(clientName, clientEmail string, lineItems []InvoiceLineItem, notes, date string) (map[string]interface{}, error) {
-	// For now, we'll use the first line item only since the Python CLI doesn't support multiple items
-	// TODO: Implement proper multiple line items support
+// InvoiceTotals holds the amounts for every line of an invoice.
+type InvoiceTotals struct {
+	Lines    []InvoiceLine `json:"line_items"`
+	Subtotal float64       `json:"subtotal"`
+	// TaxRate is in percent; Tax is the subtotal times TaxRate.
+	TaxRate float64 `json:"tax_rate"`
+	Tax     float64 `json:"tax"`
+	Total   float64 `json:"total"`
+}
+
+// CalculateInvoice validates the line items and computes per-line amounts,
+// the subtotal, tax at taxRate percent and the total, rounded to cents.
+func CalculateInvoice(lineItems []InvoiceLineItem, taxRate float64) (*InvoiceTotals, error) {
 	if len(lineItems) == 0 {
-		return nil, fmt.Errorf("at least one line item is required")
+		return nil, fmt.Errorf("%w: at least one line item is required", ErrInvalidInvoice)
+	}
+	if taxRate < 0 || taxRate > 100 {
+		return nil, fmt.Errorf("%w: tax rate must be between 0 and 100 percent", ErrInvalidInvoice)
+	}
+
+	totals := &InvoiceTotals{Lines: make([]InvoiceLine, 0, len(lineItems))}
+	for i, item := range lineItems {
+		if item.Description == "" {
+			return nil, fmt.Errorf("%w: line item %d has no description", ErrInvalidInvoice, i+1)
+		}
+		if item.Hours <= 0 || item.Rate <= 0 {
+			return nil, fmt.Errorf("%w: line item %d must have positive hours and rate", ErrInvalidInvoice, i+1)
+		}
+
+		amount := roundCents(item.Hours * item.Rate)
+		totals.Lines = append(totals.Lines, InvoiceLine{
+			Description: item.Description,
+			Hours:       item.Hours,
+			Rate:        item.Rate,
+			Amount:      amount,
+		})
+		totals.Subtotal += amount
 	}
 
-	// Use the first line item
-	item := lineItems[0]
+	totals.Subtotal = roundCents(totals.Subtotal)
+	totals.TaxRate = taxRate
+	totals.Tax = roundCents(totals.Subtotal * taxRate / 100)
+	totals.Total = roundCents(totals.Subtotal + totals.Tax)
+	return totals, nil
+}
 
-	// Build command to generate invoice using the original Python CLI
-	cmd := exec.Command(s.config.PythonExecPath, "-m", "src.main",
-		"-c", clientName,
-		"-e", clientEmail,
-		"-d", item.Description,
-		"-h", fmt.Sprintf("%.2f", item.Hours),
-		"-r", fmt.Sprintf("%.2f", item.Rate),
-	)
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
 
-	// Set working directory to invoice generator path
-	cmd.Dir = s.config.InvoiceGenPath
+// formatTaxRate formats a percentage without trailing zeros, e.g. 7.5.
+func formatTaxRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64)
+}
 
-	// Add optional parameters
-	// Always provide notes parameter to avoid interactive prompts
-	notesValue := notes
-	if notesValue == "" {
-		notesValue = "Generated via API"
+// InvoicePreview is an invoice as it would be generated, without a number.
+type InvoicePreview struct {
+	ClientName    string `json:"client_name"`
+	ClientEmail   string `json:"client_email"`
+	ClientAddress string `json:"client_address,omitempty"`
+	ClientTaxID   string `json:"client_tax_id,omitempty"`
+	Currency      string `json:"currency,omitempty"`
+	Notes         string `json:"notes,omitempty"`
+	IssueDate     string `json:"issue_date"`
+	DueDate       string `json:"due_date"`
+	InvoiceTotals
+}
+
+// preparedInvoice is a validated request with its computed amounts.
+type preparedInvoice struct {
+	req       InvoiceRequest
+	totals    *InvoiceTotals
+	issueDate time.Time
+	dueDate   time.Time
+	// clientID is set for invoices to registered clients.
+	clientID *int
+}
+
+// unregisteredClient describes a client given only by name and email.
+func unregisteredClient(name, email string) Client {
+	return Client{Name: name, Emails: []string{email}}
+}
+
+// prepareInvoice validates a request and computes what generating it would
+// produce. It is shared by generation and previews so the preview always
+// matches the generated invoice. Line items without a rate are billed at
+// the client's hourly rate on the issue date, and the client's payment
+// terms override INVOICE_DUE_DAYS.
+func (s *InvoiceService) prepareInvoice(ctx context.Context, client Client, lineItems []InvoiceLineItem, notes, date string) (*preparedInvoice, error) {
+	if client.InvoiceEmail() == "" {
+		return nil, fmt.Errorf("%w: client %s has no email address", ErrInvalidInvoice, client.Name)
 	}
-	cmd.Args = append(cmd.Args, "--notes", notesValue)
+
+	issueDate := time.Now()
 	if date != "" {
-		cmd.Args = append(cmd.Args, "--date", date)
+		var err error
+		issueDate, err = time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidInvoice)
+		}
 	}
 
-	// Execute command
-	fmt.Printf("DEBUG: Running invoice command: %v\n", cmd.Args)
-	fmt.Printf("DEBUG: Working directory: %s\n", cmd.Dir)
-	fmt.Printf("DEBUG: Python executable: %s\n", s.config.PythonExecPath)
-
-	// Check if the invoice generator directory exists
-	if _, err := os.Stat(s.config.InvoiceGenPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("invoice generator path does not exist: %s", s.config.InvoiceGenPath)
-	}
+	if slices.ContainsFunc(lineItems, func(item InvoiceLineItem) bool { return item.Rate == 0 }) {
+		rate := client.HourlyRate
+		if client.ID != 0 {
+			rates, err := s.loadRates(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve hourly rates: %w", err)
+			}
+			if resolved := rates.ClientRate(client.ID, issueDate); resolved > 0 {
+				rate = resolved
+			}
+		}
 
-	// Clean up any existing PDF files to avoid conflicts BEFORE running the Python script
-	outputDir := filepath.Join(s.config.InvoiceGenPath, "output")
-	if files, err := os.ReadDir(outputDir); err == nil {
-		for _, file := range files {
-			if filepath.Ext(file.Name()) == ".pdf" {
-				oldPdfPath := filepath.Join(outputDir, file.Name())
-				fmt.Printf("DEBUG: Removing old PDF file: %s\n", oldPdfPath)
-				os.Remove(oldPdfPath)
+		withRates := make([]InvoiceLineItem, len(lineItems))
+		for i, item := range lineItems {
+			if item.Rate == 0 {
+				item.Rate = rate
 			}
+			withRates[i] = item
 		}
+		lineItems = withRates
+	}
+
+	totals, err := CalculateInvoice(lineItems, s.config.InvoiceTaxRate)
+	if err != nil {
+		return nil, err
+	}
+	dueDays := s.config.InvoiceDueDays
+	if client.PaymentTermsDays != nil {
+		dueDays = *client.PaymentTermsDays
 	}
+	dueDate := issueDate.AddDate(0, 0, dueDays)
 
-	// First, test if Python is working
-	testCmd := exec.Command(s.config.PythonExecPath, "--version")
-	testOutput, testErr := testCmd.CombinedOutput()
-	if testErr != nil {
-		return nil, fmt.Errorf("Python executable not working: %s, output: %s", testErr.Error(), string(testOutput))
+	prepared := &preparedInvoice{
+		req: InvoiceRequest{
+			ClientName:    client.InvoiceName(),
+			ClientEmail:   client.InvoiceEmail(),
+			ClientAddress: client.BillingAddress,
+			ClientTaxID:   client.TaxID,
+			Currency:      client.Currency,
+			LineItems:     lineItems,
+			Notes:         notes,
+			Date:          date,
+			DueDate:       dueDate.Format("2006-01-02"),
+		},
+		totals:    totals,
+		issueDate: issueDate,
+		dueDate:   dueDate,
+	}
+	if client.ID != 0 {
+		id := client.ID
+		prepared.clientID = &id
 	}
-	fmt.Printf("DEBUG: Python test successful: %s", string(testOutput))
+	return prepared, nil
+}
+
+// PreviewInvoice computes an invoice without rendering a PDF or allocating
+// an invoice number.
+func (s *InvoiceService) PreviewInvoice(ctx context.Context, clientName, clientEmail string, lineItems []InvoiceLineItem, notes, date string) (*InvoicePreview, error) {
+	return s.PreviewClientInvoice(ctx, unregisteredClient(clientName, clientEmail), lineItems, notes, date)
+}
 
-	output, err := cmd.CombinedOutput()
-	fmt.Printf("DEBUG: Command output: %s\n", string(output))
+// PreviewClientInvoice is PreviewInvoice for a registered client.
+func (s *InvoiceService) PreviewClientInvoice(ctx context.Context, client Client, lineItems []InvoiceLineItem, notes, date string) (*InvoicePreview, error) {
+	prepared, err := s.prepareInvoice(ctx, client, lineItems, notes, date)
 	if err != nil {
-		fmt.Printf("DEBUG: Command error: %v\n", err)
-		fmt.Printf("DEBUG: Command exit code: %d\n", cmd.ProcessState.ExitCode())
+		return nil, err
+	}
 
-		// Check if the error is due to interactive prompts
-		if strings.Contains(string(output), "Aborted!") {
-			return nil, fmt.Errorf("invoice generation failed due to interactive prompts. This usually means the Python script is expecting user input. Output: %s", string(output))
-		}
+	req := prepared.req
+	return &InvoicePreview{
+		ClientName:    req.ClientName,
+		ClientEmail:   req.ClientEmail,
+		ClientAddress: req.ClientAddress,
+		ClientTaxID:   req.ClientTaxID,
+		Currency:      req.Currency,
+		Notes:         notes,
+		IssueDate:     prepared.issueDate.Format("2006-01-02"),
+		DueDate:       req.DueDate,
+		InvoiceTotals: *prepared.totals,
+	}, nil
+}
+
+func (s *InvoiceService) GenerateInvoice(ctx context.Context, clientName, clientEmail string, lineItems []InvoiceLineItem, notes, date string) (map[string]interface{}, error) {
+	return s.GenerateClientInvoice(ctx, unregisteredClient(clientName, clientEmail), lineItems, notes, date)
+}
 
-		return nil, fmt.Errorf("failed to generate invoice: %s, output: %s", err.Error(), string(output))
+// GenerateClientInvoice is GenerateInvoice for a registered client, which
+// supplies the recipient, currency, payment terms and the rate of line
+// items without one.
+func (s *InvoiceService) GenerateClientInvoice(ctx context.Context, client Client, lineItems []InvoiceLineItem, notes, date string) (map[string]interface{}, error) {
+	prepared, err := s.prepareInvoice(ctx, client, lineItems, notes, date)
+	if err != nil {
+		return nil, err
 	}
+	return s.generate(ctx, prepared, nil)
+}
 
-	// Generate a unique filename for this invoice
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("invoice_%s_%s.pdf", clientName, timestamp)
-	// Replace spaces and special characters in filename
-	filename = strings.ReplaceAll(filename, " ", "_")
-	filename = strings.ReplaceAll(filename, "/", "_")
+// generate renders a prepared invoice and, when a store is available,
+// records it as billing entries, which must not change until it is stored.
+func (s *InvoiceService) generate(ctx context.Context, prepared *preparedInvoice, entries []store.TimeEntry) (map[string]interface{}, error) {
+	req, totals := prepared.req, prepared.totals
 
-	// The PDF should be generated in the output directory
-	pdfPath := filepath.Join(outputDir, "invoice.pdf")
-	fmt.Printf("DEBUG: Looking for PDF at: %s\n", pdfPath)
+	outputDir := UserInvoiceDir(s.config, UserID(ctx))
+	result := map[string]interface{}{
+		"status":     "success",
+		"message":    "Invoice generated successfully",
+		"line_items": totals.Lines,
+		"subtotal":   totals.Subtotal,
+		"tax_rate":   totals.TaxRate,
+		"tax":        totals.Tax,
+		"total":      totals.Total,
+		"due_date":   req.DueDate,
+	}
+	if req.Currency != "" {
+		result["currency"] = req.Currency
+	}
 
-	// Check if the PDF was actually created
-	if _, err := os.Stat(pdfPath); os.IsNotExist(err) {
-		// List files in output directory for debugging
-		if files, err := os.ReadDir(outputDir); err == nil {
-			fmt.Printf("DEBUG: Files in output directory: %v\n", files)
+	if s.store == nil {
+		// Without invoice numbers, a timestamp and random suffix keep
+		// concurrent generations apart
+		suffix, err := randomSuffix()
+		if err != nil {
+			return nil, err
 		}
+		filename := invoiceFilename(req.ClientName, time.Now().Format("20060102_150405")+"_"+suffix)
+		pdfPath := filepath.Join(outputDir, filename)
 
-		// Try to find any PDF file in the output directory
-		if files, err := os.ReadDir(outputDir); err == nil {
-			for _, file := range files {
-				if filepath.Ext(file.Name()) == ".pdf" {
-					fmt.Printf("DEBUG: Found PDF file: %s\n", file.Name())
-					pdfPath = filepath.Join(outputDir, file.Name())
-					break
-				}
-			}
+		if _, err := s.renderer.Render(ctx, req, totals, pdfPath); err != nil {
+			return nil, err
 		}
+		addFileResult(result, pdfPath)
+		return result, nil
+	}
+
+	numbers, err := NewInvoiceNumberScheme(s.config.InvoiceNumberFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	// Render while the number is reserved so a failed render does not use it
+	// up. The store reserves it without holding a transaction open. The PDF
+	// only gets its own name once the invoice is stored, as the number may
+	// be handed out again until then.
+	var timeEntryIDs []int
+	for _, entry := range entries {
+		timeEntryIDs = append(timeEntryIDs, entry.ID)
+	}
+	var tmpPath string
+	record, err := s.store.CreateInvoice(UserID(ctx), store.Invoice{
+		ClientName:    req.ClientName,
+		ClientEmail:   req.ClientEmail,
+		LineItems:     storeInvoiceLines(totals.Lines),
+		Subtotal:      totals.Subtotal,
+		TaxRate:       totals.TaxRate,
+		Tax:           totals.Tax,
+		Total:         totals.Total,
+		Notes:         req.Notes,
+		IssueDate:     prepared.issueDate,
+		DueDate:       prepared.dueDate,
+		Status:        InvoiceDraft,
+		ClientID:      prepared.clientID,
+		Currency:      req.Currency,
+		TimeEntryIDs:  timeEntryIDs,
+		BilledEntries: entries,
+	}, numbers, func(invoice *store.Invoice) error {
+		// Invoice numbers are unique per user, and so are file names within
+		// the user's directory
+		req.Number = invoice.Number
+		invoice.PDFPath = filepath.Join(outputDir, invoiceFilename(req.ClientName, invoice.Number))
+		var err error
+		tmpPath, err = renderTemp(ctx, s.renderer, req, totals, invoice.PDFPath)
+		return err
+	})
+	if err != nil && tmpPath != "" {
+		os.Remove(tmpPath)
+	}
+	if errors.Is(err, store.ErrAlreadyBilled) {
+		return nil, fmt.Errorf("%w: another invoice was generated for some of these entries", ErrTimeEntryBilled)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: some of these entries were deleted", ErrTimeEntryNotFound)
+	}
+	if errors.Is(err, store.ErrEntryChanged) {
+		return nil, fmt.Errorf("%w: some of these entries were edited while the invoice was generated", ErrTimeEntryChanged)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, record.PDFPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("invoice %s was stored but its PDF could not be moved into place: %w", record.Number, err)
+	}
 
-		// If still no PDF found, return error with more details
-		if _, err := os.Stat(pdfPath); os.IsNotExist(err) {
-			return nil, fmt.Errorf("PDF file was not created at %s. Python command may have failed. Check server logs for details.", pdfPath)
+	addFileResult(result, record.PDFPath)
+	result["invoice_id"] = record.ID
+	result["invoice_number"] = record.Number
+	result["invoice_status"] = record.Status
+	if record.ClientID != nil {
+		result["client_id"] = *record.ClientID
+	}
+	return result, nil
+}
+
+// renderTemp renders the invoice to a temporary file next to pdfPath and
+// returns its path, so a partial PDF is never served under pdfPath. The
+// file is removed if rendering fails.
+func renderTemp(ctx context.Context, renderer InvoiceRenderer, req InvoiceRequest, totals *InvoiceTotals, pdfPath string) (string, error) {
+	suffix, err := randomSuffix()
+	if err != nil {
+		return "", err
+	}
+	tmpPath := filepath.Join(filepath.Dir(pdfPath), "tmp_"+suffix+"_"+filepath.Base(pdfPath))
+
+	if _, err := renderer.Render(ctx, req, totals, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return tmpPath, nil
+}
+
+// invoiceFilename builds a PDF file name from the client name and a tag
+// that makes it unique, using only characters that are safe in URLs.
+func invoiceFilename(clientName, tag string) string {
+	name := fmt.Sprintf("invoice_%s_%s", clientName, tag)
+	name = strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_') {
+			return r
 		}
+		return '_'
+	}, name)
+	return name + ".pdf"
+}
+
+func randomSuffix() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate file name: %w", err)
 	}
+	return hex.EncodeToString(b), nil
+}
 
-	return map[string]interface{}{
-		"status":       "success",
-		"message":      "Invoice generated successfully",
-		"pdf_path":     pdfPath,
-		"filename":     filename,
-		"download_url": "/files/invoice.pdf",
-		"output":       string(output),
-	}, nil
+// addFileResult adds the name and download URL of the rendered PDF to a
+// generation result. Its path on the server is not exposed.
+func addFileResult(result map[string]interface{}, pdfPath string) {
+	filename := filepath.Base(pdfPath)
+	result["filename"] = filename
+	result["download_url"] = "/files/" + filename
 }
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"kb-freelance-api/internal/store"
+)
+
+var (
+	// ErrTimeEntryBilled means a time entry is already on an invoice.
+	ErrTimeEntryBilled = &Error{Kind: KindConflict, Code: "time_entry_billed", Message: "time entry already billed"}
+	// ErrTimeEntryChanged means a time entry was edited while an invoice
+	// billing it was generated.
+	ErrTimeEntryChanged = &Error{Kind: KindConflict, Code: "time_entry_changed", Message: "time entry changed"}
+)
+
+// Groupings of time entries into invoice line items.
+const (
+	GroupByEntry   = "entry"
+	GroupByProject = "project"
+	GroupByDay     = "day"
+)
+
+// TimeInvoiceRequest selects the tracked time to bill on a new invoice.
+type TimeInvoiceRequest struct {
+	// Client matches the client of the time entries and names the invoice.
+	Client      string
+	ClientEmail string
+	// Registered, when set, is the registered client to bill. It replaces
+	// Client and ClientEmail and supplies the payment terms.
+	Registered *Client
+	// From and To bound the entry start times, inclusive and exclusive.
+	From *time.Time
+	To   *time.Time
+	// GroupBy is GroupByEntry, GroupByProject (the default) or GroupByDay.
+	GroupBy string
+	// Rate is the hourly rate for every entry; zero bills each entry at its
+	// resolved rate, see Rates.EntryRate. Entries of fixed-fee projects are
+	// never billed by the hour and stay unbilled.
+	Rate  float64
+	Notes string
+	Date  string
+}
+
+// GenerateInvoiceFromTime bills the client's unbilled, completed time
+// entries in the requested range on a new invoice and marks them billed.
+func (s *InvoiceService) GenerateInvoiceFromTime(ctx context.Context, req TimeInvoiceRequest) (map[string]interface{}, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	client := unregisteredClient(req.Client, req.ClientEmail)
+	if req.Registered != nil {
+		client = *req.Registered
+	}
+	if client.Name == "" {
+		return nil, fmt.Errorf("%w: client is required", ErrInvalidInvoice)
+	}
+	if req.From != nil && req.To != nil && !req.To.After(*req.From) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidInvoice)
+	}
+	groupBy := req.GroupBy
+	if groupBy == "" {
+		groupBy = GroupByProject
+	}
+	if groupBy != GroupByEntry && groupBy != GroupByProject && groupBy != GroupByDay {
+		return nil, fmt.Errorf("%w: group_by must be entry, project or day", ErrInvalidInvoice)
+	}
+	if req.Rate < 0 {
+		return nil, fmt.Errorf("%w: rate cannot be negative", ErrInvalidInvoice)
+	}
+
+	entries, err := s.store.UnbilledEntries(UserID(ctx), client.Name, req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := s.loadRates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve hourly rates: %w", err)
+	}
+	var hourly []store.TimeEntry
+	for _, entry := range entries {
+		if _, source := rates.EntryRate(entry); source != RateSourceFixed {
+			hourly = append(hourly, entry)
+		}
+	}
+	rate := func(entry store.TimeEntry) float64 {
+		if req.Rate > 0 {
+			return req.Rate
+		}
+		resolved, _ := rates.EntryRate(entry)
+		return resolved
+	}
+	for _, entry := range hourly {
+		if entry.EndTime != nil && rate(entry) <= 0 {
+			return nil, WithDetails(fmt.Errorf("%w: no hourly rate given or configured for time entry %d", ErrInvalidInvoice, entry.ID),
+				map[string]interface{}{"time_entry_id": entry.ID})
+		}
+	}
+
+	lineItems, entryIDs := timeLineItems(hourly, groupBy, rate)
+	if len(lineItems) == 0 {
+		return nil, fmt.Errorf("%w: no unbilled time for %s in this range", ErrInvalidInvoice, client.Name)
+	}
+
+	prepared, err := s.prepareInvoice(ctx, client, lineItems, req.Notes, req.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	billed := map[int]bool{}
+	for _, id := range entryIDs {
+		billed[id] = true
+	}
+	var billedEntries []store.TimeEntry
+	for _, entry := range hourly {
+		if billed[entry.ID] {
+			billedEntries = append(billedEntries, entry)
+		}
+	}
+
+	result, err := s.generate(ctx, prepared, billedEntries)
+	if err != nil {
+		return nil, err
+	}
+	result["time_entry_ids"] = entryIDs
+	return result, nil
+}
+
+// timeLineGroup collects the entries billed on one line item.
+type timeLineGroup struct {
+	description string
+	rate        float64
+	duration    time.Duration
+	entryIDs    []int
+	// projects are the projects of a day's entries.
+	projects []string
+}
+
+// timeLineItems groups entries into line items, in order of their first
+// entry. Entries are billed at rate(entry), and entries of a group with
+// different rates get a line item per rate. Paused time is not billed.
+// Groups that round to zero hours are left out and their entries stay
+// unbilled.
+func timeLineItems(entries []store.TimeEntry, groupBy string, rate func(store.TimeEntry) float64) ([]InvoiceLineItem, []int) {
+	var groups []*timeLineGroup
+	byKey := map[string]*timeLineGroup{}
+
+	for _, entry := range entries {
+		if entry.EndTime == nil {
+			continue
+		}
+
+		day := entry.StartTime.Format("2006-01-02")
+		var key, description string
+		switch groupBy {
+		case GroupByEntry:
+			key = fmt.Sprint(entry.ID)
+			description = day + " " + entry.Project
+			if entry.Description != "" {
+				description += ": " + entry.Description
+			}
+		case GroupByProject:
+			key = entry.Project
+			description = entry.Project
+		case GroupByDay:
+			key = day
+			description = day
+		}
+
+		entryRate := rate(entry)
+		key = fmt.Sprint(key, "@", entryRate)
+		group, ok := byKey[key]
+		if !ok {
+			group = &timeLineGroup{description: description, rate: entryRate}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.duration += entry.ActiveTime(time.Time{}, *entry.EndTime)
+		group.entryIDs = append(group.entryIDs, entry.ID)
+		if !slices.Contains(group.projects, entry.Project) {
+			group.projects = append(group.projects, entry.Project)
+		}
+	}
+
+	if groupBy == GroupByDay {
+		for _, group := range groups {
+			group.description = fmt.Sprintf("%s (%s)", group.description, strings.Join(group.projects, ", "))
+		}
+	}
+
+	var lineItems []InvoiceLineItem
+	var entryIDs []int
+	for _, group := range groups {
+		hours := roundCents(group.duration.Hours())
+		if hours <= 0 {
+			continue
+		}
+		lineItems = append(lineItems, InvoiceLineItem{Description: group.description, Hours: hours, Rate: group.rate})
+		entryIDs = append(entryIDs, group.entryIDs...)
+	}
+	return lineItems, entryIDs
+}
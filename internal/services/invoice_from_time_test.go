@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kb-freelance-api/internal/store"
+)
+
+func TestTimeLineItems(t *testing.T) {
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	entry := func(id int, project, description string, start time.Time, minutes int) store.TimeEntry {
+		end := start.Add(time.Duration(minutes) * time.Minute)
+		return store.TimeEntry{ID: id, Client: "Acme", Project: project, Description: description, StartTime: start, EndTime: &end}
+	}
+	entries := []store.TimeEntry{
+		entry(1, "Website", "Layout", day, 90),
+		entry(2, "App", "", day.Add(2*time.Hour), 20),
+		entry(3, "Website", "Fixes", day.AddDate(0, 0, 1), 45),
+		entry(4, "App", "Too short", day.AddDate(0, 0, 2), 0),
+		{ID: 5, Client: "Acme", Project: "App", StartTime: day.AddDate(0, 0, 3)},
+	}
+
+	tests := []struct {
+		groupBy      string
+		descriptions []string
+		hours        []float64
+		entryIDs     []int
+	}{
+		{
+			GroupByEntry,
+			[]string{"2026-03-02 Website: Layout", "2026-03-02 App", "2026-03-03 Website: Fixes"},
+			[]float64{1.5, 0.33, 0.75},
+			[]int{1, 2, 3},
+		},
+		{
+			GroupByProject,
+			[]string{"Website", "App"},
+			[]float64{2.25, 0.33},
+			[]int{1, 3, 2, 4},
+		},
+		{
+			GroupByDay,
+			[]string{"2026-03-02 (Website, App)", "2026-03-03 (Website)"},
+			[]float64{1.83, 0.75},
+			[]int{1, 2, 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.groupBy, func(t *testing.T) {
+			lineItems, entryIDs := timeLineItems(entries, test.groupBy, func(store.TimeEntry) float64 { return 100 })
+			if len(lineItems) != len(test.descriptions) {
+				t.Fatalf("Expected %d line items, got %+v", len(test.descriptions), lineItems)
+			}
+			for i, item := range lineItems {
+				if item.Description != test.descriptions[i] || item.Hours != test.hours[i] || item.Rate != 100 {
+					t.Errorf("Line %d: expected %s %.2fh, got %+v", i+1, test.descriptions[i], test.hours[i], item)
+				}
+			}
+			if len(entryIDs) != len(test.entryIDs) {
+				t.Fatalf("Expected entries %v, got %v", test.entryIDs, entryIDs)
+			}
+			for i := range entryIDs {
+				if entryIDs[i] != test.entryIDs[i] {
+					t.Errorf("Expected entries %v, got %v", test.entryIDs, entryIDs)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateInvoiceFromTime(t *testing.T) {
+	service := newRecordingInvoiceService(t, &recordingRenderer{})
+	service.config.InvoiceHourlyRate = 80
+	st := service.store.(*store.SQLiteStore)
+
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	end := start.Add(2 * time.Hour)
+	entry, err := st.CreateEntry(store.DefaultUserID, store.TimeEntry{Client: "Acme", Project: "Website", StartTime: start, EndTime: &end})
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+
+	req := TimeInvoiceRequest{Client: "Acme", ClientEmail: "billing@acme.test", Date: "2026-03-31"}
+	result, err := service.GenerateInvoiceFromTime(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GenerateInvoiceFromTime failed: %v", err)
+	}
+	if result["total"] != 160.0 || result["invoice_number"] != "2026-0001" {
+		t.Errorf("Unexpected result: %v", result)
+	}
+
+	invoice, err := service.GetInvoice(context.Background(), result["invoice_id"].(int))
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if len(invoice.LineItems) != 1 || invoice.LineItems[0].Description != "Website" {
+		t.Errorf("Unexpected line items: %+v", invoice.LineItems)
+	}
+
+	billed, err := st.GetEntry(store.DefaultUserID, entry.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if billed.InvoiceID == nil || *billed.InvoiceID != invoice.ID {
+		t.Errorf("Expected the entry to be billed on invoice %d", invoice.ID)
+	}
+
+	if _, err := service.GenerateInvoiceFromTime(context.Background(), req); !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("Expected nothing left to bill, got %v", err)
+	}
+}
+
+// hookRenderer calls during, if set, and then renders like recordingRenderer.
+type hookRenderer struct {
+	recordingRenderer
+	during func()
+}
+
+func (r *hookRenderer) Render(ctx context.Context, req InvoiceRequest, totals *InvoiceTotals, pdfPath string) (*RenderedInvoice, error) {
+	if r.during != nil {
+		r.during()
+	}
+	return r.recordingRenderer.Render(ctx, req, totals, pdfPath)
+}
+
+func TestGenerateInvoiceFromTimeUnstoredLeavesNoPDF(t *testing.T) {
+	renderer := &hookRenderer{}
+	service := newRecordingInvoiceService(t, renderer)
+	service.config.InvoiceHourlyRate = 80
+	st := service.store.(*store.SQLiteStore)
+	ctx := context.Background()
+
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	end := start.Add(2 * time.Hour)
+	entry, err := st.CreateEntry(store.DefaultUserID, store.TimeEntry{Client: "Acme", Project: "Website", StartTime: start, EndTime: &end})
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+
+	// The entry is deleted while its invoice renders, so the invoice cannot
+	// be stored and its number is handed out again
+	renderer.during = func() {
+		renderer.during = nil
+		if err := st.DeleteEntry(store.DefaultUserID, entry.ID); err != nil {
+			t.Errorf("DeleteEntry failed: %v", err)
+		}
+	}
+	req := TimeInvoiceRequest{Client: "Acme", ClientEmail: "billing@acme.test", Date: "2026-03-31"}
+	if _, err := service.GenerateInvoiceFromTime(ctx, req); !errors.Is(err, ErrTimeEntryNotFound) {
+		t.Fatalf("Expected ErrTimeEntryNotFound, got %v", err)
+	}
+	outputDir := service.config.InvoiceOutputDir()
+	if files, _ := os.ReadDir(outputDir); len(files) != 0 {
+		t.Errorf("Expected no PDF for the unstored invoice, got %v", files)
+	}
+
+	result, err := service.GenerateInvoice(ctx, "Acme", "billing@acme.test", []InvoiceLineItem{
+		{Description: "Design", Hours: 1, Rate: 80},
+	}, "", "2026-03-31")
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	if result["invoice_number"] != "2026-0001" {
+		t.Errorf("Expected the released number 2026-0001, got %v", result["invoice_number"])
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, result["filename"].(string))); err != nil {
+		t.Errorf("Expected the PDF of the reissued number: %v", err)
+	}
+}
+
+func TestGenerateInvoiceFromTimeRejectsEntriesEditedWhileRendering(t *testing.T) {
+	renderer := &hookRenderer{}
+	service := newRecordingInvoiceService(t, renderer)
+	service.config.InvoiceHourlyRate = 80
+	st := service.store.(*store.SQLiteStore)
+	tracker := NewTimeTrackerServiceWithStore(service.config, st)
+	ctx := context.Background()
+
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	end := start.Add(2 * time.Hour)
+	entry, err := st.CreateEntry(store.DefaultUserID, store.TimeEntry{Client: "Acme", Project: "Website", StartTime: start, EndTime: &end})
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+
+	renderer.during = func() {
+		renderer.during = nil
+		later := end.Add(time.Hour)
+		if _, err := tracker.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{EndTime: &later}); err != nil {
+			t.Errorf("UpdateEntry failed: %v", err)
+		}
+	}
+	req := TimeInvoiceRequest{Client: "Acme", ClientEmail: "billing@acme.test", Date: "2026-03-31"}
+	if _, err := service.GenerateInvoiceFromTime(ctx, req); !errors.Is(err, ErrTimeEntryChanged) {
+		t.Fatalf("Expected ErrTimeEntryChanged, got %v", err)
+	}
+
+	// Generating again bills the edited hours
+	result, err := service.GenerateInvoiceFromTime(ctx, req)
+	if err != nil {
+		t.Fatalf("GenerateInvoiceFromTime failed: %v", err)
+	}
+	if result["total"] != 240.0 {
+		t.Errorf("Expected 3 hours at 80, got %v", result["total"])
+	}
+}
+
+func TestGenerateInvoiceFromTimeValidation(t *testing.T) {
+	service := newRecordingInvoiceService(t, &recordingRenderer{})
+	from := time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name string
+		req  TimeInvoiceRequest
+	}{
+		{"No client", TimeInvoiceRequest{Rate: 50}},
+		{"No rate", TimeInvoiceRequest{Client: "Acme"}},
+		{"Unknown grouping", TimeInvoiceRequest{Client: "Acme", Rate: 50, GroupBy: "week"}},
+		{"Empty range", TimeInvoiceRequest{Client: "Acme", Rate: 50, From: &from, To: &from}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := service.GenerateInvoiceFromTime(context.Background(), test.req); !errors.Is(err, ErrInvalidInvoice) {
+				t.Errorf("Expected ErrInvalidInvoice, got %v", err)
+			}
+		})
+	}
+
+	withoutStore := NewInvoiceService(service.config)
+	if _, err := withoutStore.GenerateInvoiceFromTime(context.Background(), TimeInvoiceRequest{Client: "Acme"}); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+}
+
+func TestGenerateInvoiceFromTimeResolvesRates(t *testing.T) {
+	service := newRecordingInvoiceService(t, &recordingRenderer{})
+	st := service.store.(*store.SQLiteStore)
+	rates := NewRateService(service.config, st)
+	service.UseRates(rates)
+	ctx := context.Background()
+
+	project, err := NewProjectService(st).CreateProject(ctx, Project{Name: "Website", HourlyRate: 100})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if _, err := rates.CreateRateChange(ctx, RateChange{ProjectID: &project.ID, HourlyRate: 120, EffectiveFrom: "2026-03-03"}); err != nil {
+		t.Fatalf("CreateRateChange failed: %v", err)
+	}
+
+	// One hour before the rate change and two after it
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	for _, day := range []int{0, 1, 2} {
+		begin := start.AddDate(0, 0, day)
+		end := begin.Add(time.Hour)
+		if _, err := st.CreateEntry(store.DefaultUserID, store.TimeEntry{Client: "Acme", Project: "Website", StartTime: begin, EndTime: &end}); err != nil {
+			t.Fatalf("CreateEntry failed: %v", err)
+		}
+	}
+	end := start.Add(time.Hour)
+	if _, err := st.CreateEntry(store.DefaultUserID, store.TimeEntry{Client: "Acme", Project: "Unpriced", StartTime: start, EndTime: &end}); err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+
+	req := TimeInvoiceRequest{Client: "Acme", ClientEmail: "billing@acme.test", Date: "2026-03-31"}
+	if _, err := service.GenerateInvoiceFromTime(ctx, req); !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("Expected ErrInvalidInvoice for an entry without a rate, got %v", err)
+	}
+
+	to := start.AddDate(0, 0, 3)
+	req.From, req.To = &start, &to
+	service.config.InvoiceHourlyRate = 80
+	result, err := service.GenerateInvoiceFromTime(ctx, req)
+	if err != nil {
+		t.Fatalf("GenerateInvoiceFromTime failed: %v", err)
+	}
+	if result["total"] != 420.0 {
+		t.Errorf("Expected 100 + 2 x 120 + 80, got %v", result["total"])
+	}
+
+	invoice, err := service.GetInvoice(ctx, result["invoice_id"].(int))
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if len(invoice.LineItems) != 3 || invoice.LineItems[0].Rate != 100 || invoice.LineItems[1].Rate != 80 ||
+		invoice.LineItems[2].Rate != 120 || invoice.LineItems[2].Hours != 2 {
+		t.Errorf("Expected a line item per project and rate, got %+v", invoice.LineItems)
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+var invoiceHTML = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money":   func(amount float64) string { return fmt.Sprintf("%.2f", amount) },
+	"percent": formatTaxRate,
+	"lines": func(text string) []string {
+		if text == "" {
+			return nil
+		}
+		return strings.Split(text, "\n")
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice preview for {{.ClientName}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; max-width: 800px; margin: 2em auto; color: #222; }
+h1 { margin-bottom: 0.2em; }
+.preview { color: #888; text-transform: uppercase; letter-spacing: 0.1em; }
+table { width: 100%; border-collapse: collapse; margin: 1.5em 0; }
+th { background: #e6e6e6; text-align: left; }
+th, td { padding: 0.4em 0.6em; }
+.number { text-align: right; }
+tfoot td { border-top: 1px solid #222; }
+tfoot .total td { font-weight: bold; border-top: none; }
+</style>
+</head>
+<body>
+<h1>INVOICE</h1>
+<p class="preview">Preview</p>
+<p>Date: {{.IssueDate}}<br>Due: {{.DueDate}}</p>
+<h2>Bill To</h2>
+<p>{{.ClientName}}<br>
+{{- range lines .ClientAddress}}{{.}}<br>{{end -}}
+{{.ClientEmail}}{{if .ClientTaxID}}<br>Tax ID: {{.ClientTaxID}}{{end}}</p>
+<table>
+<thead>
+<tr><th>Description</th><th class="number">Hours</th><th class="number">Rate</th><th class="number">Amount</th></tr>
+</thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{.Description}}</td><td class="number">{{money .Hours}}</td><td class="number">{{money .Rate}}</td><td class="number">{{money .Amount}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+<tr><td colspan="3" class="number">Subtotal</td><td class="number">{{money .Subtotal}}</td></tr>
+{{- if .Tax}}
+<tr><td colspan="3" class="number">Tax ({{percent .TaxRate}}%)</td><td class="number">{{money .Tax}}</td></tr>
+{{- end}}
+<tr class="total"><td colspan="3" class="number">Total{{if .Currency}} ({{.Currency}}){{end}}</td><td class="number">{{money .Total}}</td></tr>
+</tfoot>
+</table>
+{{- if .Notes}}
+<h2>Notes</h2>
+<p>{{.Notes}}</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// RenderInvoiceHTML writes preview as a standalone HTML page laid out like
+// the native PDF.
+func RenderInvoiceHTML(w io.Writer, preview *InvoicePreview) error {
+	return invoiceHTML.Execute(w, preview)
+}
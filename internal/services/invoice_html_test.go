@@ -0,0 +1,67 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPreviewInvoice(t *testing.T) {
+	renderer := &recordingRenderer{}
+	service := newRecordingInvoiceService(t, renderer)
+	service.config.InvoiceTaxRate = 20
+
+	items := []InvoiceLineItem{{Description: "Design", Hours: 2, Rate: 80}}
+	preview, err := service.PreviewInvoice(context.Background(), "Test Client", "test@example.com", items, "", "2026-03-01")
+	if err != nil {
+		t.Fatalf("PreviewInvoice failed: %v", err)
+	}
+
+	if preview.Subtotal != 160 || preview.Tax != 32 || preview.Total != 192 {
+		t.Errorf("Unexpected totals: %+v", preview.InvoiceTotals)
+	}
+	if preview.IssueDate != "2026-03-01" || preview.DueDate != "2026-03-15" {
+		t.Errorf("Unexpected dates: issued %s, due %s", preview.IssueDate, preview.DueDate)
+	}
+	if renderer.totals != nil {
+		t.Error("Expected preview not to render a PDF")
+	}
+
+	// The preview must not use up an invoice number
+	result, err := service.GenerateInvoice(context.Background(), "Test Client", "test@example.com", items, "", "2026-03-01")
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	if result["invoice_number"] != "2026-0001" || result["total"] != preview.Total {
+		t.Errorf("Expected generation to match the preview, got %v", result)
+	}
+}
+
+func TestRenderInvoiceHTML(t *testing.T) {
+	totals, err := CalculateInvoice([]InvoiceLineItem{
+		{Description: "Design <b>", Hours: 2, Rate: 80},
+	}, 7.5)
+	if err != nil {
+		t.Fatalf("CalculateInvoice failed: %v", err)
+	}
+
+	var page bytes.Buffer
+	err = RenderInvoiceHTML(&page, &InvoicePreview{
+		ClientName:    "Smith & Co",
+		ClientEmail:   "smith@example.com",
+		IssueDate:     "2026-03-01",
+		DueDate:       "2026-03-31",
+		InvoiceTotals: *totals,
+	})
+	if err != nil {
+		t.Fatalf("RenderInvoiceHTML failed: %v", err)
+	}
+
+	html := page.String()
+	for _, expected := range []string{"Smith &amp; Co", "Design &lt;b&gt;", "Tax (7.5%)", "172.00"} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected HTML to contain %q", expected)
+		}
+	}
+}
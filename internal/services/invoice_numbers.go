@@ -0,0 +1,56 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultInvoiceNumberFormat produces numbers such as 2026-0042 that restart
+// at 1 every year.
+const DefaultInvoiceNumberFormat = "{year}-{seq:4}"
+
+var sequencePlaceholder = regexp.MustCompile(`\{seq(?::(\d+))?\}`)
+
+// InvoiceNumberScheme formats invoice numbers from a template. {year} is the
+// four digit issue year and {seq} the sequence value, optionally zero padded
+// as {seq:4}. Templates containing {year} draw from a separate sequence per
+// year; all others share one sequence.
+type InvoiceNumberScheme struct {
+	format  string
+	perYear bool
+}
+
+func NewInvoiceNumberScheme(format string) (*InvoiceNumberScheme, error) {
+	if format == "" {
+		format = DefaultInvoiceNumberFormat
+	}
+	if len(sequencePlaceholder.FindAllString(format, -1)) != 1 {
+		return nil, fmt.Errorf("%w: invoice number format %q must contain {seq} exactly once", ErrInvalidInvoice, format)
+	}
+
+	return &InvoiceNumberScheme{
+		format:  format,
+		perYear: strings.Contains(format, "{year}"),
+	}, nil
+}
+
+func (n *InvoiceNumberScheme) Scope(issueDate time.Time) string {
+	if n.perYear {
+		return issueDate.Format("2006")
+	}
+	return "all"
+}
+
+func (n *InvoiceNumberScheme) Format(issueDate time.Time, sequence int) string {
+	number := strings.ReplaceAll(n.format, "{year}", issueDate.Format("2006"))
+	return sequencePlaceholder.ReplaceAllStringFunc(number, func(placeholder string) string {
+		width := 0
+		if match := sequencePlaceholder.FindStringSubmatch(placeholder); match[1] != "" {
+			width, _ = strconv.Atoi(match[1])
+		}
+		return fmt.Sprintf("%0*d", width, sequence)
+	})
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInvoiceNumberScheme(t *testing.T) {
+	issued := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		format   string
+		sequence int
+		number   string
+		scope    string
+	}{
+		{"", 42, "2026-0042", "2026"},
+		{"{year}-{seq:4}", 7, "2026-0007", "2026"},
+		{"INV-{seq}", 1234, "INV-1234", "all"},
+		{"KB{seq:6}", 3, "KB000003", "all"},
+	}
+
+	for _, test := range tests {
+		scheme, err := NewInvoiceNumberScheme(test.format)
+		if err != nil {
+			t.Fatalf("NewInvoiceNumberScheme(%q) failed: %v", test.format, err)
+		}
+
+		if number := scheme.Format(issued, test.sequence); number != test.number {
+			t.Errorf("Format(%q, %d) = %s, expected %s", test.format, test.sequence, number, test.number)
+		}
+		if scope := scheme.Scope(issued); scope != test.scope {
+			t.Errorf("Scope(%q) = %s, expected %s", test.format, scope, test.scope)
+		}
+	}
+}
+
+func TestInvoiceNumberSchemeRequiresSequence(t *testing.T) {
+	for _, format := range []string{"{year}", "{seq}-{seq}"} {
+		if _, err := NewInvoiceNumberScheme(format); !errors.Is(err, ErrInvalidInvoice) {
+			t.Errorf("Expected ErrInvalidInvoice for %q, got %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// NativeInvoiceRenderer renders invoices in-process, without Python.
+type NativeInvoiceRenderer struct {
+	// now returns the issue date used when a request has none.
+	now func() time.Time
+}
+
+func NewNativeInvoiceRenderer() *NativeInvoiceRenderer {
+	return &NativeInvoiceRenderer{now: time.Now}
+}
+
+// Column widths of the line item table, in millimetres. They add up to the
+// printable width of an A4 page with 20mm margins.
+var invoiceColumns = []float64{95, 25, 25, 25}
+
+func (r *NativeInvoiceRenderer) Render(ctx context.Context, req InvoiceRequest, totals *InvoiceTotals, pdfPath string) (*RenderedInvoice, error) {
+	date := req.Date
+	if date == "" {
+		date = r.now().Format("2006-01-02")
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.SetTitle("Invoice for "+req.ClientName, true)
+	pdf.AddPage()
+
+	// The core fonts are cp1252, so translate from UTF-8
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFont("Helvetica", "B", 24)
+	pdf.CellFormat(0, 12, "INVOICE", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	if req.Number != "" {
+		pdf.CellFormat(0, 6, "Invoice No: "+tr(req.Number), "", 1, "L", false, 0, "")
+	}
+	pdf.CellFormat(0, 6, "Date: "+date, "", 1, "L", false, 0, "")
+	if req.DueDate != "" {
+		pdf.CellFormat(0, 6, "Due: "+req.DueDate, "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 6, "Bill To", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.CellFormat(0, 6, tr(req.ClientName), "", 1, "L", false, 0, "")
+	if req.ClientAddress != "" {
+		pdf.MultiCell(0, 6, tr(req.ClientAddress), "", "L", false)
+	}
+	pdf.CellFormat(0, 6, tr(req.ClientEmail), "", 1, "L", false, 0, "")
+	if req.ClientTaxID != "" {
+		pdf.CellFormat(0, 6, "Tax ID: "+tr(req.ClientTaxID), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(8)
+
+	headers := []string{"Description", "Hours", "Rate", "Amount"}
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.SetFillColor(230, 230, 230)
+	for i, header := range headers {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(invoiceColumns[i], 8, header, "B", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 11)
+	for _, line := range totals.Lines {
+		pdf.CellFormat(invoiceColumns[0], 7, tr(line.Description), "", 0, "L", false, 0, "")
+		pdf.CellFormat(invoiceColumns[1], 7, fmt.Sprintf("%.2f", line.Hours), "", 0, "R", false, 0, "")
+		pdf.CellFormat(invoiceColumns[2], 7, fmt.Sprintf("%.2f", line.Rate), "", 0, "R", false, 0, "")
+		pdf.CellFormat(invoiceColumns[3], 7, fmt.Sprintf("%.2f", line.Amount), "", 1, "R", false, 0, "")
+	}
+
+	labelWidth := invoiceColumns[0] + invoiceColumns[1] + invoiceColumns[2]
+	pdf.Ln(2)
+	pdf.CellFormat(labelWidth, 7, "Subtotal", "T", 0, "R", false, 0, "")
+	pdf.CellFormat(invoiceColumns[3], 7, fmt.Sprintf("%.2f", totals.Subtotal), "T", 1, "R", false, 0, "")
+	if totals.Tax != 0 {
+		pdf.CellFormat(labelWidth, 7, fmt.Sprintf("Tax (%s%%)", formatTaxRate(totals.TaxRate)), "", 0, "R", false, 0, "")
+		pdf.CellFormat(invoiceColumns[3], 7, fmt.Sprintf("%.2f", totals.Tax), "", 1, "R", false, 0, "")
+	}
+	pdf.SetFont("Helvetica", "B", 12)
+	total := "Total"
+	if req.Currency != "" {
+		total += " (" + req.Currency + ")"
+	}
+	pdf.CellFormat(labelWidth, 8, total, "", 0, "R", false, 0, "")
+	pdf.CellFormat(invoiceColumns[3], 8, fmt.Sprintf("%.2f", totals.Total), "", 1, "R", false, 0, "")
+
+	if req.Notes != "" {
+		pdf.Ln(8)
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.CellFormat(0, 6, "Notes", "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.MultiCell(0, 6, tr(req.Notes), "", "L", false)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(pdfPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create invoice output directory: %w", err)
+	}
+	if err := pdf.OutputFileAndClose(pdfPath); err != nil {
+		return nil, fmt.Errorf("failed to write invoice PDF: %w", err)
+	}
+
+	return &RenderedInvoice{}, nil
+}
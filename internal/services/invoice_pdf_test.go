@@ -0,0 +1,149 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kb-freelance-api/internal/config"
+)
+
+func TestNativeInvoiceRendererWritesPDF(t *testing.T) {
+	renderer := NewNativeInvoiceRenderer()
+	renderer.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	totals, err := CalculateInvoice([]InvoiceLineItem{
+		{Description: "Design", Hours: 2, Rate: 80},
+		{Description: "Développement", Hours: 3.5, Rate: 95},
+	}, 20)
+	if err != nil {
+		t.Fatalf("CalculateInvoice failed: %v", err)
+	}
+
+	pdfPath := filepath.Join(t.TempDir(), "nested", "invoice.pdf")
+	req := InvoiceRequest{ClientName: "Test Client", ClientEmail: "test@example.com", Notes: "Thanks!"}
+	if _, err := renderer.Render(context.Background(), req, totals, pdfPath); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("Failed to read PDF: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Errorf("Expected a PDF header, got %q", data[:min(len(data), 8)])
+	}
+}
+
+func TestGenerateInvoiceWithNativeRenderer(t *testing.T) {
+	outputDir := t.TempDir()
+	cfg := &config.Config{InvoiceRenderer: "native", InvoiceOutputPath: outputDir}
+	service := NewInvoiceService(cfg)
+
+	if _, ok := service.renderer.(*NativeInvoiceRenderer); !ok {
+		t.Fatalf("Expected the native renderer, got %T", service.renderer)
+	}
+
+	result, err := service.GenerateInvoice(context.Background(), "Test Client", "test@example.com", []InvoiceLineItem{
+		{Description: "Design", Hours: 1, Rate: 50},
+		{Description: "Development", Hours: 2, Rate: 75},
+	}, "", "2024-01-01")
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+
+	if result["total"] != 200.0 {
+		t.Errorf("Expected total 200, got %v", result["total"])
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, result["filename"].(string))); err != nil {
+		t.Errorf("Expected the PDF to exist: %v", err)
+	}
+}
+
+type recordingRenderer struct {
+	req    InvoiceRequest
+	totals *InvoiceTotals
+}
+
+func (r *recordingRenderer) Render(ctx context.Context, req InvoiceRequest, totals *InvoiceTotals, pdfPath string) (*RenderedInvoice, error) {
+	r.req = req
+	r.totals = totals
+	if err := os.MkdirAll(filepath.Dir(pdfPath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(pdfPath, []byte("%PDF-1.3\n"), 0o644); err != nil {
+		return nil, err
+	}
+	return &RenderedInvoice{Output: "rendered"}, nil
+}
+
+func TestGenerateInvoicePassesRequestToRenderer(t *testing.T) {
+	renderer := &recordingRenderer{}
+	service := NewInvoiceServiceWithRenderer(&config.Config{InvoiceOutputPath: t.TempDir()}, renderer)
+
+	result, err := service.GenerateInvoice(context.Background(), "Test Client", "test@example.com", []InvoiceLineItem{
+		{Description: "Design", Hours: 1, Rate: 50},
+	}, "Notes", "2024-01-01")
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+
+	if renderer.req.ClientName != "Test Client" || renderer.req.Date != "2024-01-01" {
+		t.Errorf("Unexpected request: %+v", renderer.req)
+	}
+	if renderer.totals == nil || renderer.totals.Total != 50 {
+		t.Errorf("Unexpected totals: %+v", renderer.totals)
+	}
+	// Neither the server's paths nor the renderer's output reach clients
+	for _, key := range []string{"pdf_path", "output"} {
+		if _, ok := result[key]; ok {
+			t.Errorf("Expected no %s in result, got %v", key, result[key])
+		}
+	}
+}
+
+func TestGenerateInvoiceKeepsEachPDF(t *testing.T) {
+	outputDir := t.TempDir()
+	service := NewInvoiceService(&config.Config{InvoiceRenderer: "native", InvoiceOutputPath: outputDir})
+	items := []InvoiceLineItem{{Description: "Design", Hours: 1, Rate: 50}}
+
+	first, err := service.GenerateInvoice(context.Background(), "Test Client", "test@example.com", items, "", "")
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	second, err := service.GenerateInvoice(context.Background(), "Test Client", "test@example.com", items, "", "")
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+
+	if first["filename"] == second["filename"] {
+		t.Fatalf("Expected unique file names, got %v twice", first["filename"])
+	}
+	for _, result := range []map[string]interface{}{first, second} {
+		if result["download_url"] != "/files/"+result["filename"].(string) {
+			t.Errorf("Expected download_url to name the file, got %v", result["download_url"])
+		}
+		if _, err := os.Stat(filepath.Join(outputDir, result["filename"].(string))); err != nil {
+			t.Errorf("Expected %v to be kept: %v", result["filename"], err)
+		}
+	}
+}
+
+func TestInvoiceFilename(t *testing.T) {
+	tests := []struct {
+		client, tag, expected string
+	}{
+		{"Acme", "2026-0001", "invoice_Acme_2026-0001.pdf"},
+		{"Smith & Co/UK", "INV 7", "invoice_Smith___Co_UK_INV_7.pdf"},
+		{"../Müller", "2026-0002", "invoice____M_ller_2026-0002.pdf"},
+	}
+
+	for _, test := range tests {
+		if name := invoiceFilename(test.client, test.tag); name != test.expected {
+			t.Errorf("invoiceFilename(%q, %q) = %s, expected %s", test.client, test.tag, name, test.expected)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/logging"
+)
+
+// PythonInvoiceRenderer renders invoices by running kb-invoice-gen-cli.
+// The CLI always writes output/invoice.pdf, so runs against the same
+// generator are queued and never overlap.
+type PythonInvoiceRenderer struct {
+	config *config.Config
+	runner CommandRunner
+	queue  *generatorQueue
+}
+
+// NewPythonInvoiceRenderer creates a renderer that runs kb-invoice-gen-cli
+// through runner.
+func NewPythonInvoiceRenderer(cfg *config.Config, runner CommandRunner) *PythonInvoiceRenderer {
+	return &PythonInvoiceRenderer{
+		config: cfg,
+		runner: runner,
+		queue:  queueForGenerator(cfg.InvoiceGenPath, cfg.InvoiceQueueSize),
+	}
+}
+
+func (r *PythonInvoiceRenderer) Render(ctx context.Context, req InvoiceRequest, totals *InvoiceTotals, pdfPath string) (*RenderedInvoice, error) {
+	// kb-invoice-gen-cli takes a single description/hours/rate triple, so
+	// refuse rather than silently dropping the remaining items
+	if len(totals.Lines) > 1 {
+		return nil, fmt.Errorf("%w: kb-invoice-gen-cli supports one line item, got %d", ErrInvoiceNotRepresentable, len(totals.Lines))
+	}
+	if totals.Tax != 0 {
+		return nil, fmt.Errorf("%w: kb-invoice-gen-cli does not support tax", ErrInvoiceNotRepresentable)
+	}
+	if req.ClientAddress != "" || req.ClientTaxID != "" || req.Currency != "" {
+		return nil, fmt.Errorf("%w: kb-invoice-gen-cli does not support billing addresses, tax IDs or currencies", ErrInvoiceNotRepresentable)
+	}
+	item := totals.Lines[0]
+
+	release, err := r.queue.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Build command to generate invoice using the original Python CLI
+	cmd := Command{
+		Name: r.config.PythonExecPath,
+		Args: []string{"-m", "src.main",
+			"-c", req.ClientName,
+			"-e", req.ClientEmail,
+			"-d", item.Description,
+			"-h", fmt.Sprintf("%.2f", item.Hours),
+			"-r", fmt.Sprintf("%.2f", item.Rate),
+		},
+		// Run from the invoice generator path
+		Dir: r.config.InvoiceGenPath,
+	}
+
+	// Add optional parameters
+	// Always provide notes parameter to avoid interactive prompts
+	notesValue := req.Notes
+	if notesValue == "" {
+		notesValue = "Generated via API"
+	}
+	cmd.Args = append(cmd.Args, "--notes", notesValue)
+	if req.Date != "" {
+		cmd.Args = append(cmd.Args, "--date", req.Date)
+	}
+
+	// Check if the invoice generator directory exists
+	if _, err := os.Stat(r.config.InvoiceGenPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: invoice generator path does not exist: %s", ErrInvoiceGeneratorFailed, r.config.InvoiceGenPath)
+	}
+
+	outputDir := filepath.Join(r.config.InvoiceGenPath, "output")
+
+	// First, test if Python is working
+	testCmd := Command{Name: r.config.PythonExecPath, Args: []string{"--version"}}
+	testOutput, testErr := runCommand(ctx, r.runner, testCmd, r.config.CommandTimeout)
+	if testErr != nil {
+		return nil, commandError(ErrInvoiceGeneratorFailed, "run Python", testErr, testOutput)
+	}
+
+	// Earlier invoices are kept in the output directory, so remember when
+	// this run started to tell its PDF apart from theirs
+	started := time.Now()
+	output, err := runCommand(ctx, r.runner, cmd, r.config.CommandTimeout)
+	if err != nil {
+		// Check if the error is due to interactive prompts
+		if strings.Contains(string(output), "Aborted!") {
+			return nil, fmt.Errorf("%w: invoice generation failed due to interactive prompts. This usually means the Python script is expecting user input. Output: %s", ErrInvoiceGeneratorFailed, string(output))
+		}
+
+		return nil, commandError(ErrInvoiceGeneratorFailed, "generate invoice", err, output)
+	}
+
+	generatedPath, err := findGeneratedPDF(ctx, outputDir, started)
+	if err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx).Debug("found generated PDF", "path", generatedPath)
+
+	// Move the PDF to where the API serves invoices from
+	if generatedPath != pdfPath {
+		if err := os.MkdirAll(filepath.Dir(pdfPath), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create invoice output directory: %w", err)
+		}
+		if err := os.Rename(generatedPath, pdfPath); err != nil {
+			return nil, fmt.Errorf("failed to move generated PDF: %w", err)
+		}
+	}
+
+	return &RenderedInvoice{Output: string(output)}, nil
+}
+
+// findGeneratedPDF returns the PDF kb-invoice-gen-cli wrote to outputDir
+// since started. It normally writes invoice.pdf; otherwise the most recently
+// written PDF is used, skipping the invoice_* files the API names itself.
+func findGeneratedPDF(ctx context.Context, outputDir string, started time.Time) (string, error) {
+	// Allow for file systems that store modification times coarsely
+	since := started.Add(-time.Second)
+
+	expected := filepath.Join(outputDir, "invoice.pdf")
+	if info, err := os.Stat(expected); err == nil && !info.ModTime().Before(since) {
+		return expected, nil
+	}
+
+	files, err := os.ReadDir(outputDir)
+	if err != nil {
+		return "", fmt.Errorf("%w: PDF file was not created at %s", ErrInvoiceGeneratorFailed, expected)
+	}
+
+	var newest string
+	var newestTime time.Time
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".pdf" || strings.HasPrefix(file.Name(), "invoice_") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest = filepath.Join(outputDir, file.Name())
+			newestTime = info.ModTime()
+		}
+	}
+
+	if newest == "" {
+		names := make([]string, len(files))
+		for i, file := range files {
+			names[i] = file.Name()
+		}
+		logging.FromContext(ctx).Debug("no new PDF in the invoice generator output", "dir", outputDir, "files", names)
+		return "", fmt.Errorf("%w: PDF file was not created at %s", ErrInvoiceGeneratorFailed, expected)
+	}
+	return newest, nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"kb-freelance-api/internal/config"
+)
+
+// fakeInvoiceGenerator stands in for python running kb-invoice-gen-cli. Like
+// the real CLI it always writes output/invoice.pdf; the file holds the client
+// name and the run lingers afterwards, so overlapping runs would swap PDFs.
+const fakeInvoiceGenerator = `#!/bin/sh
+if [ "$1" = "--version" ]; then
+	echo "Python 3.12.0"
+	exit 0
+fi
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-c) client="$2"; shift ;;
+	esac
+	shift
+done
+mkdir -p output
+printf '%%PDF-1.4 %s' "$client" > output/invoice.pdf
+sleep 0.05
+echo "Invoice generated"
+`
+
+func newFakePythonConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	genPath := t.TempDir()
+	python := filepath.Join(t.TempDir(), "python")
+	if err := os.WriteFile(python, []byte(fakeInvoiceGenerator), 0o755); err != nil {
+		t.Fatalf("Failed to write fake python: %v", err)
+	}
+	return &config.Config{PythonExecPath: python, InvoiceGenPath: genPath}
+}
+
+func TestPythonRendererKeepsEarlierInvoices(t *testing.T) {
+	cfg := newFakePythonConfig(t)
+	outputDir := cfg.InvoiceOutputDir()
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	earlier := filepath.Join(outputDir, "invoice_Acme_2026-0001.pdf")
+	if err := os.WriteFile(earlier, []byte("%PDF-1.4 earlier"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewInvoiceService(cfg)
+	result, err := service.GenerateInvoice(context.Background(), "Acme", "billing@acme.test", []InvoiceLineItem{
+		{Description: "Design", Hours: 1, Rate: 50},
+	}, "", "2026-03-01")
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+
+	if _, err := os.Stat(earlier); err != nil {
+		t.Errorf("Expected the earlier invoice to be kept: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(outputDir, result["filename"].(string)))
+	if err != nil {
+		t.Fatalf("Expected the new invoice %v: %v", result["filename"], err)
+	}
+	if string(content) != "%PDF-1.4 Acme" {
+		t.Errorf("Expected the generated PDF, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "invoice.pdf")); !os.IsNotExist(err) {
+		t.Errorf("Expected invoice.pdf to be moved to its own name, got %v", err)
+	}
+}
+
+func TestFindGeneratedPDFIgnoresOlderFiles(t *testing.T) {
+	outputDir := t.TempDir()
+	stale := filepath.Join(outputDir, "invoice.pdf")
+	if err := os.WriteFile(stale, []byte("%PDF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(stale, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := findGeneratedPDF(context.Background(), outputDir, time.Now()); err == nil {
+		t.Error("Expected a stale invoice.pdf not to count as generated")
+	}
+
+	renamed := filepath.Join(outputDir, "Rechnung.pdf")
+	if err := os.WriteFile(renamed, []byte("%PDF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := findGeneratedPDF(context.Background(), outputDir, time.Now())
+	if err != nil || path != renamed {
+		t.Errorf("Expected %s, got %s (%v)", renamed, path, err)
+	}
+}
+
+func TestPythonRendererConcurrentGenerations(t *testing.T) {
+	cfg := newFakePythonConfig(t)
+	service := NewInvoiceService(cfg)
+
+	const count = 6
+	var wg sync.WaitGroup
+	results := make([]map[string]interface{}, count)
+	errs := make([]error, count)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = service.GenerateInvoice(context.Background(), fmt.Sprintf("Client %d", i), "client@example.com", []InvoiceLineItem{
+				{Description: "Work", Hours: 1, Rate: 50},
+			}, "", "2026-03-01")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < count; i++ {
+		if errs[i] != nil {
+			t.Errorf("Generation %d failed: %v", i, errs[i])
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(cfg.InvoiceOutputDir(), results[i]["filename"].(string)))
+		if err != nil {
+			t.Errorf("Generation %d: %v", i, err)
+			continue
+		}
+		if expected := fmt.Sprintf("%%PDF-1.4 Client %d", i); string(content) != expected {
+			t.Errorf("Generation %d received %q, expected %q", i, content, expected)
+		}
+	}
+}
+
+func TestGeneratorQueueTurnsAwayWhenFull(t *testing.T) {
+	queue := newGeneratorQueue(1)
+
+	release, err := queue.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		releaseWaiting, err := queue.acquire(context.Background())
+		if err != nil {
+			t.Errorf("Expected the waiting caller to be queued, got %v", err)
+			close(acquired)
+			return
+		}
+		close(acquired)
+		releaseWaiting()
+	}()
+
+	// Wait until the second caller occupies the only waiting slot
+	for len(queue.waiting) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := queue.acquire(context.Background()); !errors.Is(err, ErrGeneratorBusy) {
+		t.Errorf("Expected ErrGeneratorBusy, got %v", err)
+	}
+
+	release()
+	<-acquired
+}
+
+func TestGeneratorQueueStopsWaitingWhenCanceled(t *testing.T) {
+	queue := newGeneratorQueue(1)
+	release, err := queue.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := queue.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to end with the context, got %v", err)
+	}
+	if len(queue.waiting) != 0 {
+		t.Error("Expected the waiting slot to be given back")
+	}
+}
+
+func TestQueueForGeneratorIsShared(t *testing.T) {
+	path := t.TempDir()
+	if queueForGenerator(path, 2) != queueForGenerator(path+"/.", 5) {
+		t.Error("Expected renderers for the same generator to share a queue")
+	}
+}
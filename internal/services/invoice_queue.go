@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+)
+
+// ErrGeneratorBusy means too many invoices are already waiting for the
+// generator.
+var ErrGeneratorBusy = &Error{Kind: KindUnavailable, Code: "generator_busy", Message: "invoice generator is busy"}
+
+// DefaultInvoiceQueueSize is how many generations may wait for the generator
+// when the configuration does not say.
+const DefaultInvoiceQueueSize = 8
+
+// generatorQueue lets one run of a generator proceed at a time and turns
+// callers away once maxWaiting others are already waiting.
+type generatorQueue struct {
+	running chan struct{}
+	waiting chan struct{}
+}
+
+func newGeneratorQueue(maxWaiting int) *generatorQueue {
+	return &generatorQueue{
+		running: make(chan struct{}, 1),
+		waiting: make(chan struct{}, maxWaiting),
+	}
+}
+
+// acquire waits for the generator and returns a function that releases it.
+// It stops waiting when ctx is done.
+func (q *generatorQueue) acquire(ctx context.Context) (func(), error) {
+	release := func() { <-q.running }
+
+	select {
+	case q.running <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	select {
+	case q.waiting <- struct{}{}:
+	default:
+		return nil, ErrGeneratorBusy
+	}
+	defer func() { <-q.waiting }()
+
+	select {
+	case q.running <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// generatorQueues holds one queue per generator directory, shared by every
+// renderer using it.
+var generatorQueues = struct {
+	sync.Mutex
+	byPath map[string]*generatorQueue
+}{byPath: map[string]*generatorQueue{}}
+
+// queueForGenerator returns the queue for the generator at path. The size
+// of the first caller's queue wins.
+func queueForGenerator(path string, maxWaiting int) *generatorQueue {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if maxWaiting <= 0 {
+		maxWaiting = DefaultInvoiceQueueSize
+	}
+
+	generatorQueues.Lock()
+	defer generatorQueues.Unlock()
+
+	queue, ok := generatorQueues.byPath[path]
+	if !ok {
+		queue = newGeneratorQueue(maxWaiting)
+		generatorQueues.byPath[path] = queue
+	}
+	return queue
+}
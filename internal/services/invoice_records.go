@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"kb-freelance-api/internal/store"
+)
+
+var ErrInvoiceNotFound = &Error{Kind: KindNotFound, Code: "invoice_not_found", Message: "invoice not found"}
+
+// Invoice is a generated invoice as recorded in the database.
+type Invoice struct {
+	ID          int           `json:"id"`
+	Number      string        `json:"number"`
+	ClientName  string        `json:"client_name"`
+	ClientEmail string        `json:"client_email"`
+	ClientID    *int          `json:"client_id,omitempty"`
+	Currency    string        `json:"currency,omitempty"`
+	LineItems   []InvoiceLine `json:"line_items"`
+	Subtotal    float64       `json:"subtotal"`
+	TaxRate     float64       `json:"tax_rate"`
+	Tax         float64       `json:"tax"`
+	Total       float64       `json:"total"`
+	Notes       string        `json:"notes,omitempty"`
+	IssueDate   string        `json:"issue_date"`
+	DueDate     string        `json:"due_date"`
+	PDFPath     string        `json:"-"`
+	DownloadURL string        `json:"download_url,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	// Status is one of the Invoice* status constants, with overdue derived
+	// from the due date of issued and sent invoices.
+	Status     string     `json:"status"`
+	AmountPaid float64    `json:"amount_paid"`
+	BalanceDue float64    `json:"balance_due"`
+	IssuedAt   *time.Time `json:"issued_at,omitempty"`
+	SentAt     *time.Time `json:"sent_at,omitempty"`
+	PaidAt     *time.Time `json:"paid_at,omitempty"`
+	VoidedAt   *time.Time `json:"voided_at,omitempty"`
+	// Payments is only included for a single invoice.
+	Payments []Payment `json:"payments,omitempty"`
+}
+
+// Payment is a payment recorded against an invoice.
+type Payment struct {
+	ID        int       `json:"id"`
+	Amount    float64   `json:"amount"`
+	Date      string    `json:"date"`
+	Reference string    `json:"reference,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InvoiceFilter selects stored invoices.
+type InvoiceFilter struct {
+	// Status matches the reported status, so "issued" excludes overdue
+	// invoices and "overdue" selects issued and sent invoices past their
+	// due date.
+	Status string
+	// Limit of zero or less returns every match.
+	Limit int
+}
+
+// ListInvoices returns the invoices matching filter, most recent first.
+func (s *InvoiceService) ListInvoices(ctx context.Context, filter InvoiceFilter) ([]Invoice, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	now := time.Now()
+	storeFilter, err := storeInvoiceFilter(filter, now)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.store.ListInvoices(UserID(ctx), storeFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invoices: %w", err)
+	}
+
+	invoices := make([]Invoice, 0, len(rows))
+	for _, row := range rows {
+		invoices = append(invoices, newInvoice(row, now))
+	}
+	return invoices, nil
+}
+
+func storeInvoiceFilter(filter InvoiceFilter, now time.Time) (store.InvoiceFilter, error) {
+	storeFilter := store.InvoiceFilter{Limit: filter.Limit}
+	today := startOfDay(now)
+
+	switch filter.Status {
+	case "":
+	case InvoiceOverdue:
+		storeFilter.Statuses = outstandingStatuses
+		storeFilter.DueBefore = &today
+	case InvoiceIssued, InvoiceSent:
+		storeFilter.Statuses = []string{filter.Status}
+		storeFilter.DueFrom = &today
+	case InvoiceDraft, InvoicePaid, InvoiceVoid:
+		storeFilter.Statuses = []string{filter.Status}
+	default:
+		return storeFilter, fmt.Errorf("%w: unknown status %q", ErrInvalidInvoice, filter.Status)
+	}
+	return storeFilter, nil
+}
+
+// GetInvoice returns a single invoice by ID.
+func (s *InvoiceService) GetInvoice(ctx context.Context, id int) (*Invoice, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	row, err := s.store.GetInvoice(UserID(ctx), id)
+	if err != nil {
+		return nil, storeInvoiceError(id, err)
+	}
+
+	invoice := newInvoice(*row, time.Now())
+	return &invoice, nil
+}
+
+func storeInvoiceError(id int, err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return WithDetails(fmt.Errorf("%w: %d", ErrInvoiceNotFound, id), map[string]interface{}{"id": id})
+	}
+	if errors.Is(err, ErrInvalidInvoice) || errors.Is(err, ErrInvalidTransition) {
+		return err
+	}
+	return fmt.Errorf("failed to access invoice %d: %w", id, err)
+}
+
+func newInvoice(row store.Invoice, now time.Time) Invoice {
+	lines := make([]InvoiceLine, 0, len(row.LineItems))
+	for _, line := range row.LineItems {
+		lines = append(lines, InvoiceLine(line))
+	}
+
+	invoice := Invoice{
+		ID:          row.ID,
+		Number:      row.Number,
+		ClientName:  row.ClientName,
+		ClientEmail: row.ClientEmail,
+		ClientID:    row.ClientID,
+		Currency:    row.Currency,
+		LineItems:   lines,
+		Subtotal:    row.Subtotal,
+		TaxRate:     row.TaxRate,
+		Tax:         row.Tax,
+		Total:       row.Total,
+		Notes:       row.Notes,
+		IssueDate:   row.IssueDate.Format("2006-01-02"),
+		DueDate:     row.DueDate.Format("2006-01-02"),
+		PDFPath:     row.PDFPath,
+		CreatedAt:   row.CreatedAt,
+		Status:      invoiceStatus(row, now),
+		AmountPaid:  roundCents(row.AmountPaid),
+		BalanceDue:  roundCents(row.Total - row.AmountPaid),
+		IssuedAt:    row.IssuedAt,
+		SentAt:      row.SentAt,
+		PaidAt:      row.PaidAt,
+		VoidedAt:    row.VoidedAt,
+	}
+	if row.PDFPath != "" {
+		invoice.DownloadURL = "/files/" + filepath.Base(row.PDFPath)
+	}
+	if row.Status == InvoiceVoid {
+		invoice.BalanceDue = 0
+	}
+	for _, payment := range row.Payments {
+		invoice.Payments = append(invoice.Payments, Payment{
+			ID:        payment.ID,
+			Amount:    payment.Amount,
+			Date:      payment.PaidOn.Format("2006-01-02"),
+			Reference: payment.Reference,
+			CreatedAt: payment.CreatedAt,
+		})
+	}
+	return invoice
+}
+
+func storeInvoiceLines(lines []InvoiceLine) []store.InvoiceLine {
+	result := make([]store.InvoiceLine, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, store.InvoiceLine(line))
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/store"
+)
+
+func newRecordingInvoiceService(t *testing.T, renderer InvoiceRenderer) *InvoiceService {
+	t.Helper()
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "time_tracker.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	cfg := &config.Config{InvoiceOutputPath: t.TempDir(), InvoiceNumberFormat: "{year}-{seq:4}", InvoiceDueDays: 14}
+	service := NewInvoiceServiceWithStore(cfg, st, ExecRunner{})
+	service.renderer = renderer
+	return service
+}
+
+func TestGenerateInvoiceRecordsInvoice(t *testing.T) {
+	renderer := &recordingRenderer{}
+	service := newRecordingInvoiceService(t, renderer)
+
+	result, err := service.GenerateInvoice(context.Background(), "Test Client", "test@example.com", []InvoiceLineItem{
+		{Description: "Design", Hours: 2, Rate: 80},
+		{Description: "Development", Hours: 1, Rate: 100},
+	}, "Thanks", "2026-03-01")
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+
+	if result["invoice_number"] != "2026-0001" {
+		t.Errorf("Expected invoice number 2026-0001, got %v", result["invoice_number"])
+	}
+	if renderer.req.Number != "2026-0001" || renderer.req.DueDate != "2026-03-15" {
+		t.Errorf("Expected the renderer to receive number and due date, got %+v", renderer.req)
+	}
+
+	invoice, err := service.GetInvoice(context.Background(), result["invoice_id"].(int))
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if invoice.Total != 260 || len(invoice.LineItems) != 2 {
+		t.Errorf("Unexpected invoice: %+v", invoice)
+	}
+	if invoice.IssueDate != "2026-03-01" || invoice.DueDate != "2026-03-15" {
+		t.Errorf("Unexpected dates: issued %s, due %s", invoice.IssueDate, invoice.DueDate)
+	}
+
+	if _, err := service.GenerateInvoice(context.Background(), "Other Client", "other@example.com", []InvoiceLineItem{
+		{Description: "Support", Hours: 1, Rate: 50},
+	}, "", "2026-04-01"); err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+
+	invoices, err := service.ListInvoices(context.Background(), InvoiceFilter{})
+	if err != nil {
+		t.Fatalf("ListInvoices failed: %v", err)
+	}
+	if len(invoices) != 2 || invoices[0].Number != "2026-0002" {
+		t.Errorf("Expected newest invoice first, got %+v", invoices)
+	}
+}
+
+type failingRenderer struct{}
+
+// Render leaves a partial PDF behind, as a renderer killed midway might.
+func (failingRenderer) Render(ctx context.Context, req InvoiceRequest, totals *InvoiceTotals, pdfPath string) (*RenderedInvoice, error) {
+	if err := os.WriteFile(pdfPath, []byte("%PDF"), 0o644); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("renderer unavailable")
+}
+
+func TestGenerateInvoiceRenderFailureKeepsNumber(t *testing.T) {
+	service := newRecordingInvoiceService(t, failingRenderer{})
+	items := []InvoiceLineItem{{Description: "Work", Hours: 1, Rate: 50}}
+
+	if _, err := service.GenerateInvoice(context.Background(), "Client", "client@example.com", items, "", "2026-03-01"); err == nil {
+		t.Fatal("Expected the render error")
+	}
+	if files, err := os.ReadDir(service.config.InvoiceOutputDir()); err != nil || len(files) != 0 {
+		t.Errorf("Expected the partial PDF to be removed, got %v, %v", files, err)
+	}
+
+	service.renderer = &recordingRenderer{}
+	result, err := service.GenerateInvoice(context.Background(), "Client", "client@example.com", items, "", "2026-03-01")
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	if result["invoice_number"] != "2026-0001" {
+		t.Errorf("Expected the unused number to be reused, got %v", result["invoice_number"])
+	}
+}
+
+func TestGenerateInvoiceInvalidDate(t *testing.T) {
+	service := newRecordingInvoiceService(t, &recordingRenderer{})
+
+	_, err := service.GenerateInvoice(context.Background(), "Client", "client@example.com", []InvoiceLineItem{
+		{Description: "Work", Hours: 1, Rate: 50},
+	}, "", "01/03/2026")
+	if !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("Expected ErrInvalidInvoice, got %v", err)
+	}
+}
+
+func TestInvoiceRecordsRequireStore(t *testing.T) {
+	service := NewInvoiceService(&config.Config{})
+
+	if _, err := service.ListInvoices(context.Background(), InvoiceFilter{Limit: 10}); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+	if _, err := service.GetInvoice(context.Background(), 1); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+}
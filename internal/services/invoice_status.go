@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"kb-freelance-api/internal/store"
+)
+
+// Invoice statuses. Generated invoices start as drafts; overdue is never
+// stored but reported for issued and sent invoices past their due date.
+const (
+	InvoiceDraft   = "draft"
+	InvoiceIssued  = "issued"
+	InvoiceSent    = "sent"
+	InvoicePaid    = "paid"
+	InvoiceOverdue = "overdue"
+	InvoiceVoid    = "void"
+)
+
+// ErrInvalidTransition means the invoice's status does not allow the
+// requested change, e.g. paying a void invoice.
+var ErrInvalidTransition = &Error{Kind: KindConflict, Code: "invalid_transition", Message: "invalid invoice status transition"}
+
+// outstandingStatuses are the stored statuses of invoices awaiting payment.
+var outstandingStatuses = []string{InvoiceIssued, InvoiceSent}
+
+// InvoicePayment describes a payment to record against an invoice.
+type InvoicePayment struct {
+	Amount float64
+	// Date defaults to today.
+	Date      time.Time
+	Reference string
+}
+
+// IssueInvoice finalises a draft invoice.
+func (s *InvoiceService) IssueInvoice(ctx context.Context, id int) (*Invoice, error) {
+	return s.transition(ctx, id, "issue", []string{InvoiceDraft}, func(invoice *store.Invoice, now time.Time) error {
+		invoice.Status = InvoiceIssued
+		invoice.IssuedAt = &now
+		return nil
+	})
+}
+
+// SendInvoice marks an issued invoice as sent to the client.
+func (s *InvoiceService) SendInvoice(ctx context.Context, id int) (*Invoice, error) {
+	return s.transition(ctx, id, "send", []string{InvoiceIssued}, func(invoice *store.Invoice, now time.Time) error {
+		invoice.Status = InvoiceSent
+		invoice.SentAt = &now
+		return nil
+	})
+}
+
+// VoidInvoice cancels an unpaid invoice. Its number stays allocated.
+func (s *InvoiceService) VoidInvoice(ctx context.Context, id int) (*Invoice, error) {
+	from := []string{InvoiceDraft, InvoiceIssued, InvoiceSent}
+	return s.transition(ctx, id, "void", from, func(invoice *store.Invoice, now time.Time) error {
+		if invoice.AmountPaid > 0 {
+			return fmt.Errorf("%w: invoice %s has payments recorded", ErrInvalidTransition, invoice.Number)
+		}
+		invoice.Status = InvoiceVoid
+		invoice.VoidedAt = &now
+		return nil
+	})
+}
+
+// transition applies a status change if the invoice is currently in one of
+// the from statuses.
+func (s *InvoiceService) transition(ctx context.Context, id int, action string, from []string, apply func(invoice *store.Invoice, now time.Time) error) (*Invoice, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	now := time.Now()
+	row, err := s.store.UpdateInvoice(UserID(ctx), id, func(invoice *store.Invoice) error {
+		if err := checkStatus(invoice, action, from); err != nil {
+			return err
+		}
+		return apply(invoice, now)
+	})
+	if err != nil {
+		return nil, storeInvoiceError(id, err)
+	}
+
+	invoice := newInvoice(*row, now)
+	return &invoice, nil
+}
+
+// RecordPayment adds a payment to an issued or sent invoice. Once the
+// payments cover the total the invoice is marked paid.
+func (s *InvoiceService) RecordPayment(ctx context.Context, id int, payment InvoicePayment) (*Invoice, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	amount := roundCents(payment.Amount)
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: payment amount must be positive", ErrInvalidInvoice)
+	}
+
+	now := time.Now()
+	paidOn := payment.Date
+	if paidOn.IsZero() {
+		paidOn = now
+	}
+
+	row, err := s.store.RecordPayment(UserID(ctx), id, store.Payment{
+		Amount:    amount,
+		PaidOn:    startOfDay(paidOn),
+		Reference: payment.Reference,
+	}, func(invoice *store.Invoice) error {
+		if err := checkStatus(invoice, "record a payment on", outstandingStatuses); err != nil {
+			return err
+		}
+
+		balance := roundCents(invoice.Total - invoice.AmountPaid)
+		if amount > balance {
+			return fmt.Errorf("%w: payment of %.2f exceeds the balance due of %.2f", ErrInvalidInvoice, amount, balance)
+		}
+		if amount == balance {
+			invoice.Status = InvoicePaid
+			invoice.PaidAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storeInvoiceError(id, err)
+	}
+
+	invoice := newInvoice(*row, now)
+	return &invoice, nil
+}
+
+func checkStatus(invoice *store.Invoice, action string, from []string) error {
+	for _, status := range from {
+		if invoice.Status == status {
+			return nil
+		}
+	}
+	err := fmt.Errorf("%w: cannot %s invoice %s, it is %s", ErrInvalidTransition, action, invoice.Number, invoice.Status)
+	return WithDetails(err, map[string]interface{}{"status": invoice.Status})
+}
+
+// invoiceStatus returns the status to report for row at time now.
+func invoiceStatus(row store.Invoice, now time.Time) string {
+	if row.Status == InvoiceIssued || row.Status == InvoiceSent {
+		if row.DueDate.Before(startOfDay(now)) {
+			return InvoiceOverdue
+		}
+	}
+	return row.Status
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func generateTestInvoice(t *testing.T, service *InvoiceService, date string) int {
+	t.Helper()
+
+	result, err := service.GenerateInvoice(context.Background(), "Client", "client@example.com", []InvoiceLineItem{
+		{Description: "Work", Hours: 4, Rate: 25},
+	}, "", date)
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	return result["invoice_id"].(int)
+}
+
+func TestInvoiceLifecycle(t *testing.T) {
+	service := newRecordingInvoiceService(t, &recordingRenderer{})
+	id := generateTestInvoice(t, service, time.Now().Format("2006-01-02"))
+
+	invoice, err := service.GetInvoice(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if invoice.Status != InvoiceDraft {
+		t.Fatalf("Expected a new invoice to be a draft, got %s", invoice.Status)
+	}
+
+	if invoice, err = service.IssueInvoice(context.Background(), id); err != nil {
+		t.Fatalf("IssueInvoice failed: %v", err)
+	}
+	if invoice.Status != InvoiceIssued || invoice.IssuedAt == nil {
+		t.Errorf("Expected an issued invoice, got %+v", invoice)
+	}
+
+	if invoice, err = service.SendInvoice(context.Background(), id); err != nil {
+		t.Fatalf("SendInvoice failed: %v", err)
+	}
+	if invoice.Status != InvoiceSent || invoice.SentAt == nil {
+		t.Errorf("Expected a sent invoice, got %+v", invoice)
+	}
+
+	if invoice, err = service.RecordPayment(context.Background(), id, InvoicePayment{Amount: 40, Reference: "bank"}); err != nil {
+		t.Fatalf("RecordPayment failed: %v", err)
+	}
+	if invoice.Status != InvoiceSent || invoice.AmountPaid != 40 || invoice.BalanceDue != 60 {
+		t.Errorf("Expected a partially paid invoice, got %+v", invoice)
+	}
+
+	if _, err := service.RecordPayment(context.Background(), id, InvoicePayment{Amount: 60.01}); !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("Expected an overpayment to be rejected, got %v", err)
+	}
+
+	if invoice, err = service.RecordPayment(context.Background(), id, InvoicePayment{Amount: 60}); err != nil {
+		t.Fatalf("RecordPayment failed: %v", err)
+	}
+	if invoice.Status != InvoicePaid || invoice.PaidAt == nil || invoice.BalanceDue != 0 {
+		t.Errorf("Expected a paid invoice, got %+v", invoice)
+	}
+
+	invoice, err = service.GetInvoice(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if len(invoice.Payments) != 2 || invoice.Payments[0].Reference != "bank" {
+		t.Errorf("Expected both payments to be listed, got %+v", invoice.Payments)
+	}
+}
+
+func TestInvoiceInvalidTransitions(t *testing.T) {
+	service := newRecordingInvoiceService(t, &recordingRenderer{})
+	id := generateTestInvoice(t, service, "")
+
+	if _, err := service.SendInvoice(context.Background(), id); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected sending a draft to fail, got %v", err)
+	}
+	if _, err := service.RecordPayment(context.Background(), id, InvoicePayment{Amount: 10}); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected paying a draft to fail, got %v", err)
+	}
+
+	if _, err := service.IssueInvoice(context.Background(), id); err != nil {
+		t.Fatalf("IssueInvoice failed: %v", err)
+	}
+	if _, err := service.IssueInvoice(context.Background(), id); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected issuing twice to fail, got %v", err)
+	}
+	if _, err := service.RecordPayment(context.Background(), id, InvoicePayment{Amount: 10}); err != nil {
+		t.Fatalf("RecordPayment failed: %v", err)
+	}
+	if _, err := service.VoidInvoice(context.Background(), id); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected voiding a part-paid invoice to fail, got %v", err)
+	}
+
+	other := generateTestInvoice(t, service, "")
+	invoice, err := service.VoidInvoice(context.Background(), other)
+	if err != nil {
+		t.Fatalf("VoidInvoice failed: %v", err)
+	}
+	if invoice.Status != InvoiceVoid || invoice.BalanceDue != 0 {
+		t.Errorf("Expected a void invoice, got %+v", invoice)
+	}
+	if _, err := service.IssueInvoice(context.Background(), other); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected issuing a void invoice to fail, got %v", err)
+	}
+
+	if _, err := service.IssueInvoice(context.Background(), 999); !errors.Is(err, ErrInvoiceNotFound) {
+		t.Errorf("Expected ErrInvoiceNotFound, got %v", err)
+	}
+	if _, err := service.RecordPayment(context.Background(), id, InvoicePayment{Amount: -5}); !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("Expected a negative payment to be rejected, got %v", err)
+	}
+}
+
+func TestInvoiceOverdueStatus(t *testing.T) {
+	service := newRecordingInvoiceService(t, &recordingRenderer{})
+
+	// Due 14 days after issue, so long past due
+	overdue := generateTestInvoice(t, service, "2020-01-01")
+	current := generateTestInvoice(t, service, time.Now().Format("2006-01-02"))
+	draft := generateTestInvoice(t, service, "2020-01-01")
+	for _, id := range []int{overdue, current} {
+		if _, err := service.IssueInvoice(context.Background(), id); err != nil {
+			t.Fatalf("IssueInvoice failed: %v", err)
+		}
+	}
+
+	invoice, err := service.GetInvoice(context.Background(), overdue)
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if invoice.Status != InvoiceOverdue {
+		t.Errorf("Expected overdue, got %s", invoice.Status)
+	}
+
+	tests := []struct {
+		status   string
+		expected []int
+	}{
+		{InvoiceOverdue, []int{overdue}},
+		{InvoiceIssued, []int{current}},
+		{InvoiceDraft, []int{draft}},
+		{InvoicePaid, nil},
+		{"", []int{draft, current, overdue}},
+	}
+	for _, test := range tests {
+		invoices, err := service.ListInvoices(context.Background(), InvoiceFilter{Status: test.status})
+		if err != nil {
+			t.Fatalf("ListInvoices(%q) failed: %v", test.status, err)
+		}
+		if len(invoices) != len(test.expected) {
+			t.Errorf("ListInvoices(%q) returned %d invoices, expected %d", test.status, len(invoices), len(test.expected))
+			continue
+		}
+		for i, invoice := range invoices {
+			if invoice.ID != test.expected[i] {
+				t.Errorf("ListInvoices(%q)[%d] = %d, expected %d", test.status, i, invoice.ID, test.expected[i])
+			}
+		}
+	}
+
+	if _, err := service.ListInvoices(context.Background(), InvoiceFilter{Status: "unpaid"}); !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("Expected an unknown status to be rejected, got %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"kb-freelance-api/internal/config"
@@ -138,3 +140,81 @@ func TestInvoiceLineItemCalculations(t *testing.T) {
 
 
 
+
+func TestCalculateInvoice(t *testing.T) {
+	totals, err := CalculateInvoice([]InvoiceLineItem{
+		{Description: "Design", Hours: 2.5, Rate: 80.0},
+		{Description: "Development", Hours: 1.333, Rate: 95.0},
+		{Description: "Support", Hours: 0.25, Rate: 60.0},
+	}, 0)
+	if err != nil {
+		t.Fatalf("CalculateInvoice failed: %v", err)
+	}
+
+	if len(totals.Lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(totals.Lines))
+	}
+
+	expectedAmounts := []float64{200.0, 126.64, 15.0}
+	for i, expected := range expectedAmounts {
+		if totals.Lines[i].Amount != expected {
+			t.Errorf("Line %d: expected amount %.2f, got %.2f", i+1, expected, totals.Lines[i].Amount)
+		}
+	}
+
+	if totals.Subtotal != 341.64 {
+		t.Errorf("Expected subtotal 341.64, got %.2f", totals.Subtotal)
+	}
+	if totals.Total != 341.64 {
+		t.Errorf("Expected total 341.64, got %.2f", totals.Total)
+	}
+}
+
+func TestCalculateInvoiceTax(t *testing.T) {
+	totals, err := CalculateInvoice([]InvoiceLineItem{
+		{Description: "Development", Hours: 1.333, Rate: 95.0},
+	}, 19)
+	if err != nil {
+		t.Fatalf("CalculateInvoice failed: %v", err)
+	}
+
+	if totals.Subtotal != 126.64 || totals.Tax != 24.06 || totals.Total != 150.7 {
+		t.Errorf("Expected 126.64 + 24.06 = 150.70, got %.2f + %.2f = %.2f", totals.Subtotal, totals.Tax, totals.Total)
+	}
+}
+
+func TestCalculateInvoiceValidation(t *testing.T) {
+	work := []InvoiceLineItem{{Description: "Work", Hours: 1, Rate: 50}}
+	tests := []struct {
+		name    string
+		items   []InvoiceLineItem
+		taxRate float64
+	}{
+		{"No items", nil, 0},
+		{"Missing description", []InvoiceLineItem{{Hours: 1, Rate: 50}}, 0},
+		{"Zero hours", []InvoiceLineItem{{Description: "Work", Rate: 50}}, 0},
+		{"Negative rate", []InvoiceLineItem{{Description: "Work", Hours: 1, Rate: -50}}, 0},
+		{"Negative tax", work, -1},
+		{"Tax over 100 percent", work, 150},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := CalculateInvoice(test.items, test.taxRate); !errors.Is(err, ErrInvalidInvoice) {
+				t.Errorf("Expected ErrInvalidInvoice, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerateInvoiceRejectsMultipleLineItemsForCLI(t *testing.T) {
+	service := NewInvoiceService(&config.Config{InvoiceGenPath: t.TempDir()})
+
+	_, err := service.GenerateInvoice(context.Background(), "Client", "client@example.com", []InvoiceLineItem{
+		{Description: "Design", Hours: 1, Rate: 50},
+		{Description: "Development", Hours: 2, Rate: 75},
+	}, "", "")
+	if !errors.Is(err, ErrInvoiceNotRepresentable) {
+		t.Errorf("Expected ErrInvoiceNotRepresentable, got %v", err)
+	}
+}
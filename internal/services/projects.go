@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"kb-freelance-api/internal/store"
+)
+
+var (
+	ErrProjectNotFound = &Error{Kind: KindNotFound, Code: "project_not_found", Message: "project not found"}
+	ErrProjectExists   = &Error{Kind: KindConflict, Code: "project_exists", Message: "a project with this name already exists"}
+	ErrInvalidProject  = &Error{Kind: KindValidation, Code: "invalid_project", Message: "invalid project"}
+	// ErrUnknownProject and ErrProjectArchived turn away timers for
+	// projects that are not in the registry or no longer active.
+	ErrUnknownProject  = &Error{Kind: KindValidation, Code: "unknown_project", Message: "project is not registered"}
+	ErrProjectArchived = &Error{Kind: KindConflict, Code: "project_archived", Message: "project is archived"}
+)
+
+// Billing modes of a project.
+const (
+	BillingHourly = "hourly"
+	BillingFixed  = "fixed"
+)
+
+// Project is a registered project. Name is what time entries record.
+type Project struct {
+	ID       int    `json:"id"`
+	ClientID *int   `json:"client_id,omitempty"`
+	Name     string `json:"name"`
+	// BillingMode is BillingHourly or BillingFixed.
+	BillingMode string `json:"billing_mode"`
+	// HourlyRate overrides the client's rate; zero means it has none.
+	HourlyRate float64 `json:"hourly_rate,omitempty"`
+	// FixedFee is what a fixed-fee project bills in total.
+	FixedFee float64 `json:"fixed_fee,omitempty"`
+	// BudgetHours and BudgetAmount of zero mean no budget.
+	BudgetHours  float64    `json:"budget_hours,omitempty"`
+	BudgetAmount float64    `json:"budget_amount,omitempty"`
+	Archived     bool       `json:"archived"`
+	ArchivedAt   *time.Time `json:"archived_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// ProjectUpdate holds the fields to change on a project. Nil fields are
+// left untouched; ClearClient unlinks the project from its client.
+type ProjectUpdate struct {
+	ClientID     *int
+	ClearClient  bool
+	Name         *string
+	BillingMode  *string
+	HourlyRate   *float64
+	FixedFee     *float64
+	BudgetHours  *float64
+	BudgetAmount *float64
+	Archived     *bool
+}
+
+// ProjectService keeps the registry of each user's projects.
+type ProjectService struct {
+	store store.ProjectStore
+}
+
+// NewProjectService creates a service keeping projects in st. Without a
+// store there is no registry and timers accept any project.
+func NewProjectService(st *store.SQLiteStore) *ProjectService {
+	service := &ProjectService{}
+	if st != nil {
+		service.store = st
+	}
+	return service
+}
+
+// normalizeProject trims the project's name and checks its billing
+// settings.
+func normalizeProject(project *store.Project) error {
+	project.Name = strings.TrimSpace(project.Name)
+	if project.BillingMode == "" {
+		project.BillingMode = BillingHourly
+	}
+
+	if project.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidProject)
+	}
+
+	switch project.BillingMode {
+	case BillingHourly:
+		if project.FixedFee != 0 {
+			return WithDetails(fmt.Errorf("%w: only fixed-fee projects have a fixed fee", ErrInvalidProject),
+				map[string]interface{}{"field": "fixed_fee"})
+		}
+	case BillingFixed:
+		if project.FixedFee <= 0 {
+			return WithDetails(fmt.Errorf("%w: fixed-fee projects need a positive fixed fee", ErrInvalidProject),
+				map[string]interface{}{"field": "fixed_fee"})
+		}
+	default:
+		return WithDetails(fmt.Errorf("%w: billing mode must be %s or %s", ErrInvalidProject, BillingHourly, BillingFixed),
+			map[string]interface{}{"field": "billing_mode"})
+	}
+
+	for _, amount := range []struct {
+		field string
+		value float64
+	}{
+		{"hourly_rate", project.HourlyRate},
+		{"budget_hours", project.BudgetHours},
+		{"budget_amount", project.BudgetAmount},
+	} {
+		if amount.value < 0 {
+			return WithDetails(fmt.Errorf("%w: %s cannot be negative", ErrInvalidProject, amount.field),
+				map[string]interface{}{"field": amount.field})
+		}
+	}
+	return nil
+}
+
+// CreateProject registers a project, optionally for one of the user's
+// clients. Names are unique per user.
+func (s *ProjectService) CreateProject(ctx context.Context, project Project) (*Project, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	row := storeProject(project)
+	if project.Archived {
+		now := time.Now()
+		row.ArchivedAt = &now
+	}
+	if err := normalizeProject(&row); err != nil {
+		return nil, err
+	}
+
+	created, err := s.store.CreateProject(UserID(ctx), row)
+	if err != nil {
+		return nil, storeProjectError(0, &row, err)
+	}
+
+	result := newProject(*created)
+	return &result, nil
+}
+
+// GetProject returns a single project by ID.
+func (s *ProjectService) GetProject(ctx context.Context, id int) (*Project, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	row, err := s.store.GetProject(UserID(ctx), id)
+	if err != nil {
+		return nil, storeProjectError(id, nil, err)
+	}
+
+	project := newProject(*row)
+	return &project, nil
+}
+
+// ListProjects returns the active projects, or every project if
+// includeArchived is set, ordered by name.
+func (s *ProjectService) ListProjects(ctx context.Context, includeArchived bool) ([]Project, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	rows, err := s.store.ListProjects(UserID(ctx), includeArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make([]Project, 0, len(rows))
+	for _, row := range rows {
+		projects = append(projects, newProject(row))
+	}
+	return projects, nil
+}
+
+// UpdateProject applies update to an existing project. Renaming a project
+// does not change the project recorded on its past time entries.
+func (s *ProjectService) UpdateProject(ctx context.Context, id int, update ProjectUpdate) (*Project, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	var updated store.Project
+	row, err := s.store.UpdateProject(UserID(ctx), id, func(project *store.Project) error {
+		if update.ClearClient {
+			project.ClientID = nil
+		}
+		if update.ClientID != nil {
+			clientID := *update.ClientID
+			project.ClientID = &clientID
+		}
+		if update.Name != nil {
+			project.Name = *update.Name
+		}
+		if update.BillingMode != nil {
+			project.BillingMode = *update.BillingMode
+		}
+		if update.HourlyRate != nil {
+			project.HourlyRate = *update.HourlyRate
+		}
+		if update.FixedFee != nil {
+			project.FixedFee = *update.FixedFee
+		}
+		if update.BudgetHours != nil {
+			project.BudgetHours = *update.BudgetHours
+		}
+		if update.BudgetAmount != nil {
+			project.BudgetAmount = *update.BudgetAmount
+		}
+		if update.Archived != nil {
+			switch {
+			case !*update.Archived:
+				project.ArchivedAt = nil
+			case project.ArchivedAt == nil:
+				now := time.Now()
+				project.ArchivedAt = &now
+			}
+		}
+		if err := normalizeProject(project); err != nil {
+			return err
+		}
+		updated = *project
+		return nil
+	})
+	if err != nil {
+		return nil, storeProjectError(id, &updated, err)
+	}
+
+	project := newProject(*row)
+	return &project, nil
+}
+
+// DeleteProject removes a project. Its time entries keep the project's
+// name; archiving keeps the project's settings instead.
+func (s *ProjectService) DeleteProject(ctx context.Context, id int) error {
+	if s.store == nil {
+		return ErrStoreRequired
+	}
+
+	if err := s.store.DeleteProject(UserID(ctx), id); err != nil {
+		return storeProjectError(id, nil, err)
+	}
+	return nil
+}
+
+// CheckTimerProject returns ErrUnknownProject if name is not a registered
+// project and ErrProjectArchived if it is archived. Without a store there is
+// no registry to check against, so every project is accepted.
+func (s *ProjectService) CheckTimerProject(ctx context.Context, name string) error {
+	if s.store == nil {
+		return nil
+	}
+
+	details := map[string]interface{}{"project": name}
+	row, err := s.store.GetProjectByName(UserID(ctx), name)
+	if errors.Is(err, store.ErrNotFound) {
+		return WithDetails(fmt.Errorf("%w: %s", ErrUnknownProject, name), details)
+	}
+	if err != nil {
+		return err
+	}
+	if row.ArchivedAt != nil {
+		return WithDetails(fmt.Errorf("%w: %s", ErrProjectArchived, name), details)
+	}
+	return nil
+}
+
+// storeProjectError converts a store error about project id. project, if
+// known, is the project that was being saved.
+func storeProjectError(id int, project *store.Project, err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return WithDetails(fmt.Errorf("%w: %d", ErrProjectNotFound, id), map[string]interface{}{"id": id})
+	case errors.Is(err, store.ErrProjectExists):
+		return WithDetails(fmt.Errorf("%w: %s", ErrProjectExists, project.Name), map[string]interface{}{"name": project.Name})
+	case errors.Is(err, store.ErrUnknownClient):
+		return WithDetails(fmt.Errorf("%w: %d", ErrClientNotFound, *project.ClientID), map[string]interface{}{"id": *project.ClientID})
+	case errors.Is(err, ErrInvalidProject):
+		return err
+	}
+	return fmt.Errorf("failed to access project %d: %w", id, err)
+}
+
+func storeProject(project Project) store.Project {
+	return store.Project{
+		ClientID:     project.ClientID,
+		Name:         project.Name,
+		BillingMode:  project.BillingMode,
+		HourlyRate:   project.HourlyRate,
+		FixedFee:     project.FixedFee,
+		BudgetHours:  project.BudgetHours,
+		BudgetAmount: project.BudgetAmount,
+	}
+}
+
+func newProject(row store.Project) Project {
+	return Project{
+		ID:           row.ID,
+		ClientID:     row.ClientID,
+		Name:         row.Name,
+		BillingMode:  row.BillingMode,
+		HourlyRate:   row.HourlyRate,
+		FixedFee:     row.FixedFee,
+		BudgetHours:  row.BudgetHours,
+		BudgetAmount: row.BudgetAmount,
+		Archived:     row.ArchivedAt != nil,
+		ArchivedAt:   row.ArchivedAt,
+		CreatedAt:    row.CreatedAt,
+		UpdatedAt:    row.UpdatedAt,
+	}
+}
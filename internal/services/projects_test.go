@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestProjectService(t *testing.T) {
+	st := openUserTestStore(t)
+	service := NewProjectService(st)
+	ctx := context.Background()
+
+	client, err := NewClientService(st).CreateClient(ctx, Client{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+
+	project, err := service.CreateProject(ctx, Project{Name: " Website ", ClientID: &client.ID, HourlyRate: 120, BudgetHours: 40})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if project.Name != "Website" || project.BillingMode != BillingHourly || project.Archived {
+		t.Errorf("Unexpected project: %+v", project)
+	}
+
+	if _, err := service.CreateProject(ctx, Project{Name: "Website"}); !errors.Is(err, ErrProjectExists) {
+		t.Errorf("Expected ErrProjectExists, got %v", err)
+	}
+	missing := 99
+	if _, err := service.CreateProject(ctx, Project{Name: "App", ClientID: &missing}); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+
+	invalid := []Project{
+		{Name: " "},
+		{Name: "Unknown mode", BillingMode: "daily"},
+		{Name: "Fixed without fee", BillingMode: BillingFixed},
+		{Name: "Hourly with fee", FixedFee: 500},
+		{Name: "Negative budget", BudgetAmount: -1},
+	}
+	for _, test := range invalid {
+		if _, err := service.CreateProject(ctx, test); !errors.Is(err, ErrInvalidProject) {
+			t.Errorf("%s: expected ErrInvalidProject, got %v", test.Name, err)
+		}
+	}
+
+	mode, fee := BillingFixed, 2000.0
+	fixed, err := service.UpdateProject(ctx, project.ID, ProjectUpdate{BillingMode: &mode, FixedFee: &fee, ClearClient: true})
+	if err != nil {
+		t.Fatalf("UpdateProject failed: %v", err)
+	}
+	if fixed.BillingMode != BillingFixed || fixed.FixedFee != 2000 || fixed.ClientID != nil || fixed.HourlyRate != 120 {
+		t.Errorf("Unexpected updated project: %+v", fixed)
+	}
+
+	if err := service.CheckTimerProject(ctx, "Website"); err != nil {
+		t.Errorf("Expected an active project to be accepted, got %v", err)
+	}
+	if err := service.CheckTimerProject(ctx, "Websight"); !errors.Is(err, ErrUnknownProject) {
+		t.Errorf("Expected ErrUnknownProject, got %v", err)
+	}
+
+	archive := true
+	archived, err := service.UpdateProject(ctx, project.ID, ProjectUpdate{Archived: &archive})
+	if err != nil {
+		t.Fatalf("UpdateProject failed: %v", err)
+	}
+	if !archived.Archived || archived.ArchivedAt == nil {
+		t.Errorf("Expected the project to be archived, got %+v", archived)
+	}
+	if err := service.CheckTimerProject(ctx, "Website"); !errors.Is(err, ErrProjectArchived) {
+		t.Errorf("Expected ErrProjectArchived, got %v", err)
+	}
+
+	if projects, err := service.ListProjects(ctx, false); err != nil || len(projects) != 0 {
+		t.Errorf("Expected no active projects, got %+v, %v", projects, err)
+	}
+	if projects, err := service.ListProjects(ctx, true); err != nil || len(projects) != 1 {
+		t.Errorf("Expected the archived project, got %+v, %v", projects, err)
+	}
+
+	if err := service.DeleteProject(ctx, project.ID); err != nil {
+		t.Fatalf("DeleteProject failed: %v", err)
+	}
+	if _, err := service.GetProject(ctx, project.ID); !errors.Is(err, ErrProjectNotFound) {
+		t.Errorf("Expected ErrProjectNotFound, got %v", err)
+	}
+
+	// Without a registry every project is accepted
+	if err := NewProjectService(nil).CheckTimerProject(ctx, "Anything"); err != nil {
+		t.Errorf("Expected no check without a store, got %v", err)
+	}
+}
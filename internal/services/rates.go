@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/store"
+)
+
+var (
+	ErrRateChangeNotFound = &Error{Kind: KindNotFound, Code: "rate_change_not_found", Message: "rate change not found"}
+	ErrInvalidRateChange  = &Error{Kind: KindValidation, Code: "invalid_rate_change", Message: "invalid rate change"}
+)
+
+// Where a resolved rate comes from, from the most to the least specific.
+// RateSourceFixed marks entries of fixed-fee projects, whose time is not
+// billed by the hour.
+const (
+	RateSourceFixed   = "fixed"
+	RateSourceEntry   = "entry"
+	RateSourceProject = "project"
+	RateSourceClient  = "client"
+	RateSourceUser    = "user"
+)
+
+// RateChange is an hourly rate that applies to time tracked from
+// EffectiveFrom, a YYYY-MM-DD date, on. It belongs to a client if ClientID
+// is set, to a project if ProjectID is set, and is the user's own default
+// rate if neither is.
+type RateChange struct {
+	ID            int       `json:"id"`
+	ClientID      *int      `json:"client_id,omitempty"`
+	ProjectID     *int      `json:"project_id,omitempty"`
+	HourlyRate    float64   `json:"hourly_rate"`
+	EffectiveFrom string    `json:"effective_from"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// RateStore is what rate resolution reads: the rate changes and the
+// projects and clients whose rates they change.
+type RateStore interface {
+	store.RateStore
+	store.ProjectStore
+	store.ClientStore
+}
+
+// RateService keeps each user's rate changes and resolves the hourly rate
+// time entries are billed at.
+type RateService struct {
+	config *config.Config
+	store  RateStore
+}
+
+// NewRateService creates a service reading rates from st. Without a store
+// every entry is billed at INVOICE_HOURLY_RATE.
+func NewRateService(cfg *config.Config, st *store.SQLiteStore) *RateService {
+	service := &RateService{config: cfg}
+	if st != nil {
+		service.store = st
+	}
+	return service
+}
+
+// CreateRateChange records a rate change for a client, a project or, if it
+// names neither, the user.
+func (s *RateService) CreateRateChange(ctx context.Context, change RateChange) (*RateChange, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	if change.ClientID != nil && change.ProjectID != nil {
+		return nil, fmt.Errorf("%w: a rate change belongs to a client or a project, not both", ErrInvalidRateChange)
+	}
+	if change.HourlyRate < 0 {
+		return nil, WithDetails(fmt.Errorf("%w: hourly_rate cannot be negative", ErrInvalidRateChange),
+			map[string]interface{}{"field": "hourly_rate"})
+	}
+	effectiveFrom, err := time.ParseInLocation("2006-01-02", change.EffectiveFrom, time.Local)
+	if err != nil {
+		return nil, WithDetails(fmt.Errorf("%w: effective_from must be YYYY-MM-DD", ErrInvalidRateChange),
+			map[string]interface{}{"field": "effective_from"})
+	}
+
+	created, err := s.store.CreateRateChange(UserID(ctx), store.RateChange{
+		ClientID:      change.ClientID,
+		ProjectID:     change.ProjectID,
+		HourlyRate:    change.HourlyRate,
+		EffectiveFrom: effectiveFrom,
+	})
+	switch {
+	case errors.Is(err, store.ErrUnknownClient):
+		return nil, WithDetails(fmt.Errorf("%w: %d", ErrClientNotFound, *change.ClientID), map[string]interface{}{"id": *change.ClientID})
+	case errors.Is(err, store.ErrUnknownProject):
+		return nil, WithDetails(fmt.Errorf("%w: %d", ErrProjectNotFound, *change.ProjectID), map[string]interface{}{"id": *change.ProjectID})
+	case err != nil:
+		return nil, err
+	}
+
+	result := newRateChange(*created)
+	return &result, nil
+}
+
+// ListRateChanges returns the user's rate changes in the order they take
+// effect.
+func (s *RateService) ListRateChanges(ctx context.Context) ([]RateChange, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	rows, err := s.store.ListRateChanges(UserID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]RateChange, 0, len(rows))
+	for _, row := range rows {
+		changes = append(changes, newRateChange(row))
+	}
+	return changes, nil
+}
+
+// DeleteRateChange removes a rate change, so the rate before it applies
+// again.
+func (s *RateService) DeleteRateChange(ctx context.Context, id int) error {
+	if s.store == nil {
+		return ErrStoreRequired
+	}
+
+	err := s.store.DeleteRateChange(UserID(ctx), id)
+	if errors.Is(err, store.ErrNotFound) {
+		return WithDetails(fmt.Errorf("%w: %d", ErrRateChangeNotFound, id), map[string]interface{}{"id": id})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete rate change %d: %w", id, err)
+	}
+	return nil
+}
+
+// Rates loads the user's projects, clients and rate changes to resolve the
+// rates of their entries.
+func (s *RateService) Rates(ctx context.Context) (*Rates, error) {
+	rates := &Rates{
+		defaultRate: s.config.InvoiceHourlyRate,
+		projects:    map[string]store.Project{},
+		clients:     map[string]store.Client{},
+		clientsByID: map[int]store.Client{},
+	}
+	if s.store == nil {
+		return rates, nil
+	}
+
+	userID := UserID(ctx)
+	projects, err := s.store.ListProjects(userID, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		rates.projects[project.Name] = project
+	}
+
+	clients, err := s.store.ListClients(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		rates.clients[client.Name] = client
+		rates.clientsByID[client.ID] = client
+	}
+
+	if rates.changes, err = s.store.ListRateChanges(userID); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// Rates resolves hourly rates from a snapshot of a user's projects, clients
+// and rate changes.
+type Rates struct {
+	defaultRate float64
+	projects    map[string]store.Project
+	clients     map[string]store.Client
+	clientsByID map[int]store.Client
+	// changes are ordered by EffectiveFrom.
+	changes []store.RateChange
+}
+
+// EntryRate returns the hourly rate entry is billed at and where it comes
+// from: the entry's own rate, else its project's, else its client's, else
+// the user's. Project, client and user rates are the latest rate change in
+// effect when the entry started, falling back to the rate set on the
+// project or client and to INVOICE_HOURLY_RATE for the user. A rate of zero
+// means the entry has none. Entries of fixed-fee projects have a rate of
+// zero from RateSourceFixed.
+func (r *Rates) EntryRate(entry store.TimeEntry) (float64, string) {
+	project, hasProject := r.projects[entry.Project]
+	if hasProject && project.BillingMode == BillingFixed {
+		return 0, RateSourceFixed
+	}
+	if entry.HourlyRate != nil && *entry.HourlyRate > 0 {
+		return *entry.HourlyRate, RateSourceEntry
+	}
+
+	at := entry.StartTime
+	client, hasClient := r.clients[entry.Client]
+	if hasProject {
+		if rate := r.rateAt(at, project.HourlyRate, func(c store.RateChange) bool {
+			return c.ProjectID != nil && *c.ProjectID == project.ID
+		}); rate > 0 {
+			return rate, RateSourceProject
+		}
+		if project.ClientID != nil {
+			client, hasClient = r.clientsByID[*project.ClientID]
+		}
+	}
+
+	if hasClient {
+		if rate := r.ClientRate(client.ID, at); rate > 0 {
+			return rate, RateSourceClient
+		}
+	}
+
+	if rate := r.rateAt(at, r.defaultRate, func(c store.RateChange) bool {
+		return c.ClientID == nil && c.ProjectID == nil
+	}); rate > 0 {
+		return rate, RateSourceUser
+	}
+	return 0, ""
+}
+
+// ClientRate returns the hourly rate of the client with the given ID in
+// effect at: its latest rate change by then, else the rate set on the
+// client. It is zero if the client has neither or is unknown.
+func (r *Rates) ClientRate(clientID int, at time.Time) float64 {
+	client, ok := r.clientsByID[clientID]
+	if !ok {
+		return 0
+	}
+	return r.rateAt(at, client.HourlyRate, func(c store.RateChange) bool {
+		return c.ClientID != nil && *c.ClientID == client.ID
+	})
+}
+
+// rateAt returns the rate of the latest change matching level that is in
+// effect at, or base if none is.
+func (r *Rates) rateAt(at time.Time, base float64, level func(store.RateChange) bool) float64 {
+	rate := base
+	for _, change := range r.changes {
+		if change.EffectiveFrom.After(at) {
+			break
+		}
+		if level(change) {
+			rate = change.HourlyRate
+		}
+	}
+	return rate
+}
+
+func newRateChange(row store.RateChange) RateChange {
+	return RateChange{
+		ID:            row.ID,
+		ClientID:      row.ClientID,
+		ProjectID:     row.ProjectID,
+		HourlyRate:    row.HourlyRate,
+		EffectiveFrom: row.EffectiveFrom.Format("2006-01-02"),
+		CreatedAt:     row.CreatedAt,
+	}
+}
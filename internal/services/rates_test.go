@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/store"
+)
+
+func TestEntryRate(t *testing.T) {
+	st := openUserTestStore(t)
+	ctx := context.Background()
+	service := NewRateService(&config.Config{InvoiceHourlyRate: 50}, st)
+
+	acme, err := NewClientService(st).CreateClient(ctx, Client{Name: "Acme", HourlyRate: 100})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	if _, err := NewClientService(st).CreateClient(ctx, Client{Name: "Globex"}); err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	projects := NewProjectService(st)
+	website, err := projects.CreateProject(ctx, Project{Name: "Website", HourlyRate: 120})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if _, err := projects.CreateProject(ctx, Project{Name: "App", ClientID: &acme.ID}); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+
+	for _, change := range []RateChange{
+		{ProjectID: &website.ID, HourlyRate: 150, EffectiveFrom: "2026-07-01"},
+		{ClientID: &acme.ID, HourlyRate: 110, EffectiveFrom: "2026-04-01"},
+		{HourlyRate: 60, EffectiveFrom: "2026-05-01"},
+	} {
+		if _, err := service.CreateRateChange(ctx, change); err != nil {
+			t.Fatalf("CreateRateChange failed: %v", err)
+		}
+	}
+
+	rates, err := service.Rates(ctx)
+	if err != nil {
+		t.Fatalf("Rates failed: %v", err)
+	}
+	march := time.Date(2026, 3, 31, 23, 0, 0, 0, time.Local)
+	july := time.Date(2026, 7, 1, 0, 0, 0, 0, time.Local)
+	own := 200.0
+	tests := []struct {
+		name   string
+		entry  store.TimeEntry
+		rate   float64
+		source string
+	}{
+		{"Entry override", store.TimeEntry{Client: "Acme", Project: "Website", StartTime: march, HourlyRate: &own}, 200, RateSourceEntry},
+		{"Project before its change", store.TimeEntry{Client: "Globex", Project: "Website", StartTime: march}, 120, RateSourceProject},
+		{"Project after its change", store.TimeEntry{Client: "Globex", Project: "Website", StartTime: july}, 150, RateSourceProject},
+		{"Project's client", store.TimeEntry{Client: "Globex", Project: "App", StartTime: march}, 100, RateSourceClient},
+		{"Client after its change", store.TimeEntry{Client: "Acme", Project: "Unregistered", StartTime: july}, 110, RateSourceClient},
+		{"Default before the user's change", store.TimeEntry{Client: "Globex", Project: "Other", StartTime: march}, 50, RateSourceUser},
+		{"User after their change", store.TimeEntry{Client: "Globex", Project: "Other", StartTime: july}, 60, RateSourceUser},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if rate, source := rates.EntryRate(test.entry); rate != test.rate || source != test.source {
+				t.Errorf("Expected %.2f from the %s, got %.2f from %q", test.rate, test.source, rate, source)
+			}
+		})
+	}
+
+	// Without a store only INVOICE_HOURLY_RATE is left
+	withoutStore, err := NewRateService(&config.Config{}, nil).Rates(ctx)
+	if err != nil {
+		t.Fatalf("Rates failed: %v", err)
+	}
+	if rate, source := withoutStore.EntryRate(store.TimeEntry{Client: "Acme", Project: "Website", StartTime: july}); rate != 0 || source != "" {
+		t.Errorf("Expected no rate, got %.2f from %q", rate, source)
+	}
+}
+
+func TestRateService(t *testing.T) {
+	st := openUserTestStore(t)
+	ctx := context.Background()
+	service := NewRateService(&config.Config{}, st)
+
+	missing := 99
+	invalid := []struct {
+		name   string
+		change RateChange
+		err    error
+	}{
+		{"Client and project", RateChange{ClientID: &missing, ProjectID: &missing, EffectiveFrom: "2026-07-01"}, ErrInvalidRateChange},
+		{"Negative rate", RateChange{HourlyRate: -1, EffectiveFrom: "2026-07-01"}, ErrInvalidRateChange},
+		{"Bad date", RateChange{HourlyRate: 100, EffectiveFrom: "July"}, ErrInvalidRateChange},
+		{"Unknown client", RateChange{ClientID: &missing, EffectiveFrom: "2026-07-01"}, ErrClientNotFound},
+		{"Unknown project", RateChange{ProjectID: &missing, EffectiveFrom: "2026-07-01"}, ErrProjectNotFound},
+	}
+	for _, test := range invalid {
+		if _, err := service.CreateRateChange(ctx, test.change); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	change, err := service.CreateRateChange(ctx, RateChange{HourlyRate: 90, EffectiveFrom: "2026-07-01"})
+	if err != nil {
+		t.Fatalf("CreateRateChange failed: %v", err)
+	}
+	if changes, err := service.ListRateChanges(ctx); err != nil || len(changes) != 1 || changes[0].EffectiveFrom != "2026-07-01" {
+		t.Errorf("Expected the rate change, got %+v, %v", changes, err)
+	}
+	if err := service.DeleteRateChange(ctx, change.ID); err != nil {
+		t.Fatalf("DeleteRateChange failed: %v", err)
+	}
+	if err := service.DeleteRateChange(ctx, change.ID); !errors.Is(err, ErrRateChangeNotFound) {
+		t.Errorf("Expected ErrRateChangeNotFound, got %v", err)
+	}
+}
+
+func TestPricedTimeEntries(t *testing.T) {
+	st := openUserTestStore(t)
+	ctx := context.Background()
+	cfg := &config.Config{InvoiceHourlyRate: 80}
+	service := NewTimeTrackerServiceWithStore(cfg, st)
+	service.UseRates(NewRateService(cfg, st))
+
+	start := time.Now().Add(-3 * time.Hour)
+	entry, err := service.CreateEntry(ctx, "Acme", "Website", "", start, start.Add(90*time.Minute))
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	if entry.HourlyRate != 80 || entry.RateSource != RateSourceUser || entry.BillableAmount != 120 {
+		t.Errorf("Expected 1.5 hours at the default rate, got %+v", entry)
+	}
+
+	rate := 100.0
+	entry, err = service.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{HourlyRate: &rate})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if entry.HourlyRate != 100 || entry.RateSource != RateSourceEntry || entry.BillableAmount != 150 {
+		t.Errorf("Expected the entry's own rate, got %+v", entry)
+	}
+
+	page, err := service.ListEntries(ctx, TimeEntryFilter{})
+	if err != nil {
+		t.Fatalf("ListEntries failed: %v", err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].BillableAmount != 150 {
+		t.Errorf("Expected listed entries to be priced, got %+v", page.Entries)
+	}
+
+	entry, err = service.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{ClearHourlyRate: true})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if entry.RateSource != RateSourceUser {
+		t.Errorf("Expected the default rate again, got %+v", entry)
+	}
+
+	zero := 0.0
+	if _, err := service.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{HourlyRate: &zero}); !errors.Is(err, ErrInvalidTimeEntry) {
+		t.Errorf("Expected ErrInvalidTimeEntry, got %v", err)
+	}
+}
+
+func TestFixedFeeProjectsAreNotBilledHourly(t *testing.T) {
+	service := newRecordingInvoiceService(t, &recordingRenderer{})
+	st := service.store.(*store.SQLiteStore)
+	cfg := service.config
+	cfg.InvoiceHourlyRate = 80
+	rates := NewRateService(cfg, st)
+	service.UseRates(rates)
+	tracker := NewTimeTrackerServiceWithStore(cfg, st)
+	tracker.UseRates(rates)
+	ctx := context.Background()
+
+	projects := NewProjectService(st)
+	if _, err := projects.CreateProject(ctx, Project{Name: "Website", HourlyRate: 100}); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	launch, err := projects.CreateProject(ctx, Project{Name: "Launch", BillingMode: BillingFixed, FixedFee: 5000, BudgetHours: 10, BudgetAmount: 1000})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	hourly, err := tracker.CreateEntry(ctx, "Acme", "Website", "", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	fixed, err := tracker.CreateEntry(ctx, "Acme", "Launch", "", start.Add(2*time.Hour), start.Add(4*time.Hour))
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	if fixed.HourlyRate != 0 || fixed.RateSource != RateSourceFixed || fixed.BillableAmount != 0 {
+		t.Errorf("Expected no hourly rate for the fixed-fee project, got %+v", fixed)
+	}
+
+	budget, err := NewBudgetService(cfg, st).ProjectBudget(ctx, launch.ID)
+	if err != nil {
+		t.Fatalf("ProjectBudget failed: %v", err)
+	}
+	if budget.HoursConsumed != 2 || budget.AmountConsumed != 0 {
+		t.Errorf("Expected 2 hours and no amount consumed, got %+v", budget)
+	}
+
+	result, err := service.GenerateInvoiceFromTime(ctx, TimeInvoiceRequest{Client: "Acme", ClientEmail: "billing@acme.test", Date: "2026-03-31"})
+	if err != nil {
+		t.Fatalf("GenerateInvoiceFromTime failed: %v", err)
+	}
+	if result["total"] != 100.0 {
+		t.Errorf("Expected only the hour on Website, got %v", result["total"])
+	}
+	if ids := result["time_entry_ids"].([]int); len(ids) != 1 || ids[0] != hourly.ID {
+		t.Errorf("Expected only the hourly entry to be billed, got %v", ids)
+	}
+}
+
+func TestClientInvoiceUsesRateOnIssueDate(t *testing.T) {
+	service := newRecordingInvoiceService(t, &recordingRenderer{})
+	st := service.store.(*store.SQLiteStore)
+	rates := NewRateService(service.config, st)
+	service.UseRates(rates)
+	ctx := context.Background()
+
+	client, err := NewClientService(st).CreateClient(ctx, Client{Name: "Acme", Emails: []string{"billing@acme.test"}, HourlyRate: 100})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	if _, err := rates.CreateRateChange(ctx, RateChange{ClientID: &client.ID, HourlyRate: 120, EffectiveFrom: "2026-07-01"}); err != nil {
+		t.Fatalf("CreateRateChange failed: %v", err)
+	}
+	items := []InvoiceLineItem{{Description: "Design", Hours: 2}, {Description: "Hosting", Hours: 1, Rate: 30}}
+
+	before, err := service.PreviewClientInvoice(ctx, *client, items, "", "2026-06-30")
+	if err != nil {
+		t.Fatalf("PreviewClientInvoice failed: %v", err)
+	}
+	if before.Subtotal != 230 {
+		t.Errorf("Expected 2 hours at 100 and the hosting, got %v", before.Subtotal)
+	}
+
+	result, err := service.GenerateClientInvoice(ctx, *client, items, "", "2026-07-01")
+	if err != nil {
+		t.Fatalf("GenerateClientInvoice failed: %v", err)
+	}
+	if result["subtotal"] != 270.0 {
+		t.Errorf("Expected 2 hours at the changed rate of 120 and the hosting, got %v", result["subtotal"])
+	}
+}
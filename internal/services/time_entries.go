@@ -0,0 +1,350 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kb-freelance-api/internal/store"
+)
+
+var (
+	ErrTimeEntryNotFound = &Error{Kind: KindNotFound, Code: "time_entry_not_found", Message: "time entry not found"}
+	ErrInvalidTimeEntry  = &Error{Kind: KindValidation, Code: "invalid_time_entry", Message: "invalid time entry"}
+	ErrInvalidFilter     = &Error{Kind: KindValidation, Code: "invalid_filter", Message: "invalid time entry filter"}
+	// ErrStoreRequired is returned for operations that need the SQLite
+	// database, which is not available or not enabled.
+	ErrStoreRequired = &Error{Kind: KindNotImplemented, Code: "store_required", Message: "operation requires the SQLite database"}
+)
+
+// TimeEntryUpdate holds the fields to change on an entry. Nil fields are
+// left untouched; ClearHourlyRate removes the entry's own rate so it is
+// billed at its project's, client's or user's again.
+type TimeEntryUpdate struct {
+	Client          *string
+	Project         *string
+	Description     *string
+	StartTime       *time.Time
+	EndTime         *time.Time
+	HourlyRate      *float64
+	ClearHourlyRate bool
+}
+
+// TimeEntryFilter selects a page of time entries.
+type TimeEntryFilter struct {
+	From    *time.Time
+	To      *time.Time
+	Client  string
+	Project string
+	// Query searches entry descriptions.
+	Query string
+	// Sort is "desc" (newest first, the default) or "asc".
+	Sort string
+	// Cursor is the NextCursor of a previous page.
+	Cursor string
+	// Limit is the page size; zero or less returns every match.
+	Limit int
+}
+
+// TimeEntryPage is one page of a filtered listing. NextCursor is empty on the
+// last page.
+type TimeEntryPage struct {
+	Entries    []TimeEntry `json:"entries"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// ListEntries returns the entries matching filter a page at a time.
+func (s *TimeTrackerService) ListEntries(ctx context.Context, filter TimeEntryFilter) (*TimeEntryPage, error) {
+	if filter.Sort != "" && filter.Sort != "asc" && filter.Sort != "desc" {
+		return nil, fmt.Errorf("%w: sort must be asc or desc", ErrInvalidFilter)
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return nil, fmt.Errorf("%w: to must be after from", ErrInvalidFilter)
+	}
+
+	var after *store.EntryCursor
+	if filter.Cursor != "" {
+		cursor, err := decodeEntryCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = cursor
+	}
+
+	storeFilter := store.EntryFilter{
+		From:      filter.From,
+		To:        filter.To,
+		Client:    filter.Client,
+		Project:   filter.Project,
+		Query:     filter.Query,
+		Ascending: filter.Sort == "asc",
+		After:     after,
+	}
+	// Fetch one extra entry to learn whether another page follows
+	if filter.Limit > 0 {
+		storeFilter.Limit = filter.Limit + 1
+	}
+
+	var entries []TimeEntry
+	if s.store != nil {
+		rows, err := s.store.ListEntries(UserID(ctx), storeFilter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list time entries: %w", err)
+		}
+
+		if entries, err = s.pricedEntries(ctx, rows, time.Now()); err != nil {
+			return nil, err
+		}
+	} else {
+		// kb-tt-cli can only list everything, so filter in memory
+		all, err := s.GetRecentEntries(ctx, 0)
+		if err != nil {
+			return nil, err
+		}
+		entries = filterEntries(all, storeFilter)
+	}
+
+	page := &TimeEntryPage{Entries: entries}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		page.Entries = entries[:filter.Limit]
+		last := page.Entries[filter.Limit-1]
+		page.NextCursor = encodeEntryCursor(last.StartTime, last.ID)
+	}
+
+	return page, nil
+}
+
+// filterEntries applies filter to entries already in memory, matching the
+// semantics of store.ListEntries.
+func filterEntries(entries []TimeEntry, filter store.EntryFilter) []TimeEntry {
+	before := func(a, b TimeEntry) bool {
+		if a.StartTime.Equal(b.StartTime) {
+			return a.ID < b.ID
+		}
+		return a.StartTime.Before(b.StartTime)
+	}
+
+	var cursor *TimeEntry
+	if filter.After != nil {
+		cursor = &TimeEntry{ID: filter.After.ID, StartTime: filter.After.StartTime}
+	}
+	query := strings.ToLower(filter.Query)
+
+	matched := []TimeEntry{}
+	for _, entry := range entries {
+		switch {
+		case filter.From != nil && entry.StartTime.Before(*filter.From):
+		case filter.To != nil && !entry.StartTime.Before(*filter.To):
+		case filter.Client != "" && entry.Client != filter.Client:
+		case filter.Project != "" && entry.Project != filter.Project:
+		case query != "" && !strings.Contains(strings.ToLower(entry.Description), query):
+		case cursor != nil && filter.Ascending && !before(*cursor, entry):
+		case cursor != nil && !filter.Ascending && !before(entry, *cursor):
+		default:
+			matched = append(matched, entry)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if filter.Ascending {
+			return before(matched[i], matched[j])
+		}
+		return before(matched[j], matched[i])
+	})
+
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched
+}
+
+func encodeEntryCursor(startTime time.Time, id int) string {
+	raw := fmt.Sprintf("%d|%s", id, startTime.Format(time.RFC3339Nano))
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeEntryCursor(cursor string) (*store.EntryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidFilter)
+	}
+
+	idPart, timePart, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidFilter)
+	}
+
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidFilter)
+	}
+
+	startTime, err := time.Parse(time.RFC3339Nano, timePart)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidFilter)
+	}
+
+	return &store.EntryCursor{StartTime: startTime, ID: id}, nil
+}
+
+// CreateEntry records a completed entry by hand, for work that was not
+// tracked with the timer.
+func (s *TimeTrackerService) CreateEntry(ctx context.Context, client, project, description string, startTime, endTime time.Time) (*TimeEntry, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	row := store.TimeEntry{
+		Client:      client,
+		Project:     project,
+		Description: description,
+		StartTime:   startTime,
+		EndTime:     &endTime,
+	}
+	if err := validateTimeEntry(row, time.Now()); err != nil {
+		return nil, err
+	}
+
+	created, err := s.store.CreateEntry(UserID(ctx), row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create time entry: %w", err)
+	}
+
+	entry, err := s.pricedEntry(ctx, *created, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	entry.BudgetEvents = s.budgets.EntryChanged(ctx, nil, created)
+	return entry, nil
+}
+
+// GetEntry returns a single entry by ID.
+func (s *TimeTrackerService) GetEntry(ctx context.Context, id int) (*TimeEntry, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	row, err := s.store.GetEntry(UserID(ctx), id)
+	if err != nil {
+		return nil, storeEntryError(id, err)
+	}
+
+	return s.pricedEntry(ctx, *row, time.Now())
+}
+
+// UpdateEntry applies update to an existing entry. Setting EndTime on the
+// running entry stops it at that time. Billed entries cannot be changed.
+func (s *TimeTrackerService) UpdateEntry(ctx context.Context, id int, update TimeEntryUpdate) (*TimeEntry, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	now := time.Now()
+	var previous store.TimeEntry
+	row, err := s.store.UpdateEntry(UserID(ctx), id, func(entry *store.TimeEntry) error {
+		if entry.InvoiceID != nil {
+			return WithDetails(fmt.Errorf("%w: time entry %d is on invoice %d", ErrTimeEntryBilled, id, *entry.InvoiceID),
+				map[string]interface{}{"id": id, "invoice_id": *entry.InvoiceID})
+		}
+		previous = *entry
+		if update.Client != nil {
+			entry.Client = *update.Client
+		}
+		if update.Project != nil {
+			entry.Project = *update.Project
+		}
+		if update.Description != nil {
+			entry.Description = *update.Description
+		}
+		if update.StartTime != nil {
+			entry.StartTime = *update.StartTime
+		}
+		if update.EndTime != nil {
+			endTime := *update.EndTime
+			entry.EndTime = &endTime
+		}
+		if update.ClearHourlyRate {
+			entry.HourlyRate = nil
+		}
+		if update.HourlyRate != nil {
+			rate := *update.HourlyRate
+			entry.HourlyRate = &rate
+		}
+		return validateTimeEntry(*entry, now)
+	})
+	if err != nil {
+		return nil, storeEntryError(id, err)
+	}
+
+	entry, err := s.pricedEntry(ctx, *row, now)
+	if err != nil {
+		return nil, err
+	}
+	entry.BudgetEvents = s.budgets.EntryChanged(ctx, &previous, row)
+	return entry, nil
+}
+
+// DeleteEntry removes an entry permanently, unless it has been billed.
+func (s *TimeTrackerService) DeleteEntry(ctx context.Context, id int) error {
+	if s.store == nil {
+		return ErrStoreRequired
+	}
+
+	if err := s.store.DeleteEntry(UserID(ctx), id); err != nil {
+		return storeEntryError(id, err)
+	}
+	return nil
+}
+
+// validateTimeEntry rejects entries that would produce a negative or empty
+// duration, that start after or end before one of their pauses starts or
+// that have a rate of their own that is not positive.
+func validateTimeEntry(entry store.TimeEntry, now time.Time) error {
+	if entry.Client == "" || entry.Project == "" {
+		return fmt.Errorf("%w: client and project are required", ErrInvalidTimeEntry)
+	}
+	if entry.StartTime.IsZero() {
+		return fmt.Errorf("%w: start time is required", ErrInvalidTimeEntry)
+	}
+	if entry.HourlyRate != nil && *entry.HourlyRate <= 0 {
+		return fmt.Errorf("%w: hourly rate must be positive", ErrInvalidTimeEntry)
+	}
+	for _, pause := range entry.Pauses {
+		if entry.StartTime.After(pause.Start) {
+			return fmt.Errorf("%w: start time cannot be after a pause starts", ErrInvalidTimeEntry)
+		}
+		if entry.EndTime != nil && entry.EndTime.Before(pause.Start) {
+			return fmt.Errorf("%w: end time cannot be before a pause starts", ErrInvalidTimeEntry)
+		}
+	}
+
+	if entry.EndTime == nil {
+		if entry.StartTime.After(now) {
+			return fmt.Errorf("%w: running entry cannot start in the future", ErrInvalidTimeEntry)
+		}
+		return nil
+	}
+
+	if !entry.EndTime.After(entry.StartTime) {
+		return fmt.Errorf("%w: end time must be after start time", ErrInvalidTimeEntry)
+	}
+	return nil
+}
+
+func storeEntryError(id int, err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return WithDetails(fmt.Errorf("%w: %d", ErrTimeEntryNotFound, id), map[string]interface{}{"id": id})
+	}
+	if errors.Is(err, store.ErrAlreadyBilled) {
+		return WithDetails(fmt.Errorf("%w: time entry %d is on an invoice", ErrTimeEntryBilled, id), map[string]interface{}{"id": id})
+	}
+	if errors.Is(err, ErrInvalidTimeEntry) || errors.Is(err, ErrTimeEntryBilled) {
+		return err
+	}
+	return fmt.Errorf("failed to access time entry %d: %w", id, err)
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/store"
+)
+
+func TestCreateEntry(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+	entry, err := service.CreateEntry(context.Background(), "Client", "Project", "Forgot the timer", start, start.Add(45*time.Minute))
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	if entry.ID == 0 || entry.DurationMinutes != 45 || entry.IsRunning {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	loaded, err := service.GetEntry(context.Background(), entry.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if loaded.Description != "Forgot the timer" {
+		t.Errorf("Expected description 'Forgot the timer', got '%s'", loaded.Description)
+	}
+}
+
+func TestCreateEntryValidation(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		client  string
+		project string
+		start   time.Time
+		end     time.Time
+	}{
+		{"End before start", "Client", "Project", start, start.Add(-time.Hour)},
+		{"Zero duration", "Client", "Project", start, start},
+		{"Missing start", "Client", "Project", time.Time{}, start},
+		{"Missing client", "", "Project", start, start.Add(time.Hour)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := service.CreateEntry(context.Background(), test.client, test.project, "", test.start, test.end)
+			if !errors.Is(err, ErrInvalidTimeEntry) {
+				t.Errorf("Expected ErrInvalidTimeEntry, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateEntryStopsOvernightTimer(t *testing.T) {
+	service := newNativeTimeTracker(t)
+
+	started, err := service.StartTimer(context.Background(), "Client", "Project", "")
+	if err != nil {
+		t.Fatalf("StartTimer failed: %v", err)
+	}
+
+	earlier := started.StartTime.Add(-10 * time.Hour)
+	end := earlier.Add(2 * time.Hour)
+	updated, err := service.UpdateEntry(context.Background(), started.ID, TimeEntryUpdate{StartTime: &earlier, EndTime: &end})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if updated.IsRunning || updated.DurationMinutes != 120 {
+		t.Errorf("Unexpected updated entry: %+v", updated)
+	}
+
+	status, err := service.GetStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status != nil {
+		t.Errorf("Expected no running timer after setting an end time, got %+v", status)
+	}
+}
+
+func TestUpdateEntryRejectsNegativeDuration(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+	entry, err := service.CreateEntry(context.Background(), "Client", "Project", "", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+
+	later := start.Add(2 * time.Hour)
+	if _, err := service.UpdateEntry(context.Background(), entry.ID, TimeEntryUpdate{StartTime: &later}); !errors.Is(err, ErrInvalidTimeEntry) {
+		t.Errorf("Expected ErrInvalidTimeEntry, got %v", err)
+	}
+
+	loaded, err := service.GetEntry(context.Background(), entry.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if !loaded.StartTime.Equal(start) {
+		t.Errorf("Expected rejected update to leave start time unchanged, got %v", loaded.StartTime)
+	}
+}
+
+func TestUpdateEntryKeepsPausesInside(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	st := service.store.(*store.SQLiteStore)
+	ctx := context.Background()
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	pauseStart := start.Add(time.Hour)
+
+	entry, err := st.StartEntry(UserID(ctx), "Client", "Project", "", start)
+	if err != nil {
+		t.Fatalf("StartEntry failed: %v", err)
+	}
+	if _, err := st.PauseEntry(UserID(ctx), pauseStart); err != nil {
+		t.Fatalf("PauseEntry failed: %v", err)
+	}
+	if _, err := st.ResumeEntry(UserID(ctx), pauseStart.Add(30*time.Minute)); err != nil {
+		t.Fatalf("ResumeEntry failed: %v", err)
+	}
+
+	laterStart := pauseStart.Add(time.Minute)
+	if _, err := service.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{StartTime: &laterStart}); !errors.Is(err, ErrInvalidTimeEntry) {
+		t.Errorf("Expected ErrInvalidTimeEntry for a start after the pause, got %v", err)
+	}
+	earlierEnd := pauseStart.Add(-time.Minute)
+	if _, err := service.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{EndTime: &earlierEnd}); !errors.Is(err, ErrInvalidTimeEntry) {
+		t.Errorf("Expected ErrInvalidTimeEntry for an end before the pause, got %v", err)
+	}
+
+	loaded, err := service.GetEntry(ctx, entry.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if !loaded.StartTime.Equal(start) || !loaded.IsRunning {
+		t.Errorf("Expected rejected updates to leave the entry unchanged, got %+v", loaded)
+	}
+
+	end := pauseStart.Add(time.Hour)
+	stopped, err := service.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{EndTime: &end})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if stopped.DurationMinutes != 90 {
+		t.Errorf("Expected 90 active minutes, got %+v", stopped)
+	}
+}
+
+func TestDeleteEntry(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+	entry, err := service.CreateEntry(context.Background(), "Client", "Project", "", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+
+	if err := service.DeleteEntry(context.Background(), entry.ID); err != nil {
+		t.Fatalf("DeleteEntry failed: %v", err)
+	}
+	if _, err := service.GetEntry(context.Background(), entry.ID); !errors.Is(err, ErrTimeEntryNotFound) {
+		t.Errorf("Expected ErrTimeEntryNotFound, got %v", err)
+	}
+}
+
+func TestBilledEntriesCannotChange(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	st := service.store.(*store.SQLiteStore)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+	entry, err := service.CreateEntry(ctx, "Client", "Project", "", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	numbers, err := NewInvoiceNumberScheme("{year}-{seq:4}")
+	if err != nil {
+		t.Fatalf("NewInvoiceNumberScheme failed: %v", err)
+	}
+	invoice, err := st.CreateInvoice(store.DefaultUserID, store.Invoice{
+		ClientName:   "Client",
+		IssueDate:    start,
+		DueDate:      start,
+		TimeEntryIDs: []int{entry.ID},
+	}, numbers, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+
+	description := "Changed"
+	if _, err := service.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{Description: &description}); !errors.Is(err, ErrTimeEntryBilled) {
+		t.Errorf("Expected ErrTimeEntryBilled updating a billed entry, got %v", err)
+	}
+	if err := service.DeleteEntry(ctx, entry.ID); !errors.Is(err, ErrTimeEntryBilled) {
+		t.Errorf("Expected ErrTimeEntryBilled deleting a billed entry, got %v", err)
+	}
+
+	// Voiding the invoice frees the entry again
+	if _, err := st.UpdateInvoice(store.DefaultUserID, invoice.ID, func(invoice *store.Invoice) error {
+		invoice.Status = InvoiceVoid
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateInvoice failed: %v", err)
+	}
+	if _, err := service.UpdateEntry(ctx, entry.ID, TimeEntryUpdate{Description: &description}); err != nil {
+		t.Errorf("UpdateEntry failed: %v", err)
+	}
+	if err := service.DeleteEntry(ctx, entry.ID); err != nil {
+		t.Errorf("DeleteEntry failed: %v", err)
+	}
+}
+
+func TestEntryCRUDRequiresStore(t *testing.T) {
+	service := NewTimeTrackerService(&config.Config{})
+
+	if _, err := service.GetEntry(context.Background(), 1); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+	if err := service.DeleteEntry(context.Background(), 1); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+}
+
+func TestListEntriesPagination(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	base := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+	for i := 0; i < 5; i++ {
+		start := base.Add(time.Duration(i) * time.Hour)
+		if _, err := service.CreateEntry(context.Background(), "Client", "Project", "", start, start.Add(30*time.Minute)); err != nil {
+			t.Fatalf("CreateEntry failed: %v", err)
+		}
+	}
+
+	var seen []int
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		page, err := service.ListEntries(context.Background(), TimeEntryFilter{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("ListEntries failed: %v", err)
+		}
+		for _, entry := range page.Entries {
+			seen = append(seen, entry.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	expected := []int{5, 4, 3, 2, 1}
+	if len(seen) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, seen)
+	}
+	for i := range expected {
+		if seen[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, seen)
+		}
+	}
+}
+
+func TestListEntriesInvalidFilter(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	from := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	to := from.Add(-time.Hour)
+
+	tests := []TimeEntryFilter{
+		{Sort: "sideways"},
+		{Cursor: "not-a-cursor"},
+		{From: &from, To: &to},
+	}
+
+	for _, filter := range tests {
+		if _, err := service.ListEntries(context.Background(), filter); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("Expected ErrInvalidFilter for %+v, got %v", filter, err)
+		}
+	}
+}
+
+func TestFilterEntriesInMemory(t *testing.T) {
+	base := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+	entries := []TimeEntry{
+		{ID: 1, Client: "Acme", Description: "Design review", StartTime: base},
+		{ID: 2, Client: "Globex", Description: "Design work", StartTime: base.Add(time.Hour)},
+		{ID: 3, Client: "Acme", Description: "Bug fixes", StartTime: base.Add(2 * time.Hour)},
+		{ID: 4, Client: "Acme", Description: "design polish", StartTime: base.Add(3 * time.Hour)},
+	}
+
+	matched := filterEntries(entries, store.EntryFilter{Client: "Acme", Query: "design", Limit: 1})
+	if len(matched) != 1 || matched[0].ID != 4 {
+		t.Fatalf("Expected entry 4 first, got %+v", matched)
+	}
+
+	after := &store.EntryCursor{StartTime: matched[0].StartTime, ID: matched[0].ID}
+	matched = filterEntries(entries, store.EntryFilter{Client: "Acme", Query: "design", After: after})
+	if len(matched) != 1 || matched[0].ID != 1 {
+		t.Errorf("Expected entry 1 after the cursor, got %+v", matched)
+	}
+
+	matched = filterEntries(entries, store.EntryFilter{Ascending: true, Limit: 2})
+	if len(matched) != 2 || matched[0].ID != 1 || matched[1].ID != 2 {
+		t.Errorf("Expected entries 1 and 2 in ascending order, got %+v", matched)
+	}
+}
+
+func TestEntryCursorRoundTrip(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 123456000, time.Local)
+
+	cursor, err := decodeEntryCursor(encodeEntryCursor(start, 42))
+	if err != nil {
+		t.Fatalf("decodeEntryCursor failed: %v", err)
+	}
+	if cursor.ID != 42 || !cursor.StartTime.Equal(start) {
+		t.Errorf("Unexpected cursor: %+v", cursor)
+	}
+}
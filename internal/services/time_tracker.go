@@ -1,20 +1,75 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os/exec"
 	"time"
 
 	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/logging"
+	"kb-freelance-api/internal/store"
 )
 
 type TimeTrackerService struct {
 	config *config.Config
+	// runner runs kb-tt-cli when there is no store.
+	runner CommandRunner
+	// store, when set, is used instead of shelling out to kb-tt-cli.
+	store store.TimeEntryStore
+	// budgets, when set, is told about completed and edited entries.
+	budgets *BudgetService
+	// rates, when set, prices the entries the service returns.
+	rates *RateService
 }
 
 func NewTimeTrackerService(cfg *config.Config) *TimeTrackerService {
-	return &TimeTrackerService{config: cfg}
+	return NewTimeTrackerServiceWithRunner(cfg, ExecRunner{})
+}
+
+// NewTimeTrackerServiceWithRunner creates a service that runs kb-tt-cli
+// through runner.
+func NewTimeTrackerServiceWithRunner(cfg *config.Config, runner CommandRunner) *TimeTrackerService {
+	return &TimeTrackerService{config: cfg, runner: runner}
+}
+
+// NewTimeTrackerServiceWithStore creates a service that reads and writes time
+// entries through st instead of the Python CLI.
+func NewTimeTrackerServiceWithStore(cfg *config.Config, st store.TimeEntryStore) *TimeTrackerService {
+	return &TimeTrackerService{config: cfg, store: st}
+}
+
+// WatchBudgets makes the service emit budget threshold events through
+// budgets whenever a timer is stopped or an entry is recorded or edited.
+func (s *TimeTrackerService) WatchBudgets(budgets *BudgetService) {
+	s.budgets = budgets
+}
+
+// UseRates makes the service report the hourly rate and billable amount of
+// the entries it returns, resolved through rates.
+func (s *TimeTrackerService) UseRates(rates *RateService) {
+	s.rates = rates
+}
+
+// runCLI runs a kb-tt-cli subcommand and returns its combined output. The
+// command is killed when ctx is done or CommandTimeout passes.
+func (s *TimeTrackerService) runCLI(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := Command{
+		Name: s.config.PythonExecPath,
+		Args: append([]string{"-m", "tt.cli"}, args...),
+		Dir:  s.config.TimeTrackerPath,
+	}
+	return runCommand(ctx, s.runner, cmd, s.config.CommandTimeout)
+}
+
+// requireCLIUser rejects requests from users other than the default one
+// when time is tracked through kb-tt-cli, which knows nothing of users.
+func requireCLIUser(ctx context.Context) error {
+	if id := UserID(ctx); id != store.DefaultUserID {
+		return fmt.Errorf("%w: kb-tt-cli only tracks time for the default user, not user %d", ErrStoreRequired, id)
+	}
+	return nil
 }
 
 type TimeEntry struct {
@@ -26,6 +81,28 @@ type TimeEntry struct {
 	EndTime         *time.Time `json:"end_time,omitempty"`
 	DurationMinutes int        `json:"duration_minutes"`
 	IsRunning       bool       `json:"is_running"`
+	// IsPaused is set while a running entry is paused. DurationMinutes
+	// leaves out the PausedMinutes spent in Pauses.
+	IsPaused      bool    `json:"is_paused"`
+	PausedMinutes int     `json:"paused_minutes,omitempty"`
+	Pauses        []Pause `json:"pauses,omitempty"`
+	// InvoiceID is set once the entry has been billed.
+	InvoiceID *int `json:"invoice_id,omitempty"`
+	// HourlyRate is the rate the entry is billed at, RateSource where that
+	// rate comes from and BillableAmount what its duration is worth.
+	HourlyRate     float64 `json:"hourly_rate,omitempty"`
+	RateSource     string  `json:"rate_source,omitempty"`
+	BillableAmount float64 `json:"billable_amount,omitempty"`
+	// BudgetEvents are the budget thresholds that stopping, recording or
+	// editing the entry crossed.
+	BudgetEvents []BudgetEvent `json:"budget_events,omitempty"`
+}
+
+// Pause is an interval during which an entry was paused. EndTime is nil
+// while the entry is still paused.
+type Pause struct {
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
 }
 
 type TimerStatus struct {
@@ -51,86 +128,136 @@ type Breakdown struct {
 	Minutes       int     `json:"minutes"`
 }
 
-func (s *TimeTrackerService) StartTimer(client, project, description string) (map[string]interface{}, error) {
-	// Build command to start timer using configurable Python executable
-	cmd := exec.Command(s.config.PythonExecPath, "-m", "tt.cli", "start", client, project)
-	if description != "" {
-		cmd.Args = append(cmd.Args, "--desc", description)
+// StartTimer starts tracking time and returns the persisted entry.
+func (s *TimeTrackerService) StartTimer(ctx context.Context, client, project, description string) (*TimeEntry, error) {
+	if s.store != nil {
+		return s.startTimerNative(ctx, UserID(ctx), client, project, description)
+	}
+	if err := requireCLIUser(ctx); err != nil {
+		return nil, err
 	}
 
-	// Set working directory to time tracker path
-	cmd.Dir = s.config.TimeTrackerPath
-
-	// Debug: log the command and directory
-	fmt.Printf("DEBUG: Running command: %v\n", cmd.Args)
-	fmt.Printf("DEBUG: Working directory: %s\n", cmd.Dir)
+	// Build command to start timer
+	args := []string{"start", client, project}
+	if description != "" {
+		args = append(args, "--desc", description)
+	}
 
 	// Execute command
-	output, err := cmd.CombinedOutput()
+	output, err := s.runCLI(ctx, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to start timer: %s, output: %s", err.Error(), string(output))
-	}
-
-	// Return the timer data that was just started
-	now := time.Now()
-	return map[string]interface{}{
-		"id":               1, // This should be the actual ID from the database
-		"client":           client,
-		"project":          project,
-		"description":      description,
-		"start_time":       now.Format(time.RFC3339),
-		"is_running":       true,
-		"duration_minutes": 0,
-	}, nil
+		return nil, commandError(ErrTimeTrackerFailed, "start timer", err, output)
+	}
+
+	// The CLI does not print the new entry, so read it back from status
+	status, err := s.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return nil, fmt.Errorf("%w: timer was started but no running entry was found", ErrTimeTrackerFailed)
+	}
+
+	entry := timeEntryFromJSON(ctx, status)
+	return &entry, nil
 }
 
-func (s *TimeTrackerService) StopTimer() (map[string]interface{}, error) {
-	// Build command to stop timer using configurable Python executable
-	cmd := exec.Command(s.config.PythonExecPath, "-m", "tt.cli", "stop")
-	cmd.Dir = s.config.TimeTrackerPath
+// StopTimer stops the running timer and returns the completed entry.
+func (s *TimeTrackerService) StopTimer(ctx context.Context) (*TimeEntry, error) {
+	if s.store != nil {
+		return s.stopTimerNative(ctx, UserID(ctx))
+	}
+	if err := requireCLIUser(ctx); err != nil {
+		return nil, err
+	}
 
-	// Execute command
-	output, err := cmd.CombinedOutput()
+	// Remember which entry is running so it can be found after stopping
+	status, err := s.GetStatus(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to stop timer: %s, output: %s", err.Error(), string(output))
-	}
-
-	// After stopping the timer, return the stopped timer data
-	// For now, return a proper TimeEntry structure indicating it's stopped
-	now := time.Now()
-	return map[string]interface{}{
-		"id":               1,                                        // This should be the actual ID from the database
-		"client":           "Unknown",                                // This should be the actual client from the database
-		"project":          "Unknown",                                // This should be the actual project from the database
-		"description":      "",                                       // This should be the actual description from the database
-		"start_time":       now.Add(-time.Hour).Format(time.RFC3339), // This should be the actual start time
-		"end_time":         now.Format(time.RFC3339),
-		"is_running":       false,
-		"duration_minutes": 60, // This should be the actual duration
-	}, nil
+		return nil, err
+	}
+	if status == nil {
+		return nil, ErrNoTimerRunning
+	}
+	stopped := timeEntryFromJSON(ctx, status)
+
+	// Stop the timer
+	output, err := s.runCLI(ctx, "stop")
+	if err != nil {
+		return nil, commandError(ErrTimeTrackerFailed, "stop timer", err, output)
+	}
+
+	// Look the entry up again to pick up the end time recorded by the CLI
+	entries, err := s.GetRecentEntries(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.ID == stopped.ID {
+			return &entry, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: stopped entry %d not found", ErrTimeTrackerFailed, stopped.ID)
 }
 
-func (s *TimeTrackerService) GetStatus() (map[string]interface{}, error) {
-	// Build command to get status using configurable Python executable with JSON output
-	cmd := exec.Command(s.config.PythonExecPath, "-m", "tt.cli", "status", "--json")
-	cmd.Dir = s.config.TimeTrackerPath
+// TimerSwitch is the result of SwitchTimer: the entry that was stopped and
+// the one started in its place.
+type TimerSwitch struct {
+	Stopped *TimeEntry `json:"stopped"`
+	Started *TimeEntry `json:"started"`
+}
 
-	// Execute command
-	output, err := cmd.CombinedOutput()
+// SwitchTimer stops the running timer and starts tracking the given task
+// from the same moment, so no time goes untracked in between. Either both
+// happen or neither does.
+func (s *TimeTrackerService) SwitchTimer(ctx context.Context, client, project, description string) (*TimerSwitch, error) {
+	if s.store == nil {
+		return nil, fmt.Errorf("%w: kb-tt-cli cannot switch timers atomically", ErrStoreRequired)
+	}
+	return s.switchTimerNative(ctx, UserID(ctx), client, project, description)
+}
+
+// PauseTimer pauses the running timer, e.g. for a break, and returns the
+// running entry. Time spent paused does not count towards its duration.
+func (s *TimeTrackerService) PauseTimer(ctx context.Context) (*TimeEntry, error) {
+	if s.store == nil {
+		return nil, fmt.Errorf("%w: kb-tt-cli cannot pause timers", ErrStoreRequired)
+	}
+	return s.pauseTimerNative(ctx, UserID(ctx))
+}
+
+// ResumeTimer resumes the paused timer and returns the running entry.
+func (s *TimeTrackerService) ResumeTimer(ctx context.Context) (*TimeEntry, error) {
+	if s.store == nil {
+		return nil, fmt.Errorf("%w: kb-tt-cli cannot pause timers", ErrStoreRequired)
+	}
+	return s.resumeTimerNative(ctx, UserID(ctx))
+}
+
+func (s *TimeTrackerService) GetStatus(ctx context.Context) (map[string]interface{}, error) {
+	if s.store != nil {
+		return s.getStatusNative(UserID(ctx))
+	}
+	if err := requireCLIUser(ctx); err != nil {
+		return nil, err
+	}
+
+	// Get status with JSON output
+	output, err := s.runCLI(ctx, "status", "--json")
 	if err != nil {
 		// If no timer is running, this is not an error
-		if len(output) > 0 {
+		if len(output) > 0 && !errors.Is(err, ErrCommandTimeout) {
 			outputStr := string(output)
 			if contains(outputStr, "null") {
 				return nil, nil // Return nil to indicate no timer running
 			}
 		}
-		return nil, fmt.Errorf("failed to get timer status: %s, output: %s", err.Error(), string(output))
+		return nil, commandError(ErrTimeTrackerFailed, "get timer status", err, output)
 	}
 
 	// Parse JSON output
 	outputStr := string(output)
-	fmt.Printf("DEBUG: GetStatus output: %s\n", outputStr)
 
 	if outputStr == "null" || outputStr == "" {
 		return nil, nil // No timer running
@@ -139,73 +266,36 @@ func (s *TimeTrackerService) GetStatus() (map[string]interface{}, error) {
 	// Parse the JSON response
 	var timerData map[string]interface{}
 	if err := json.Unmarshal(output, &timerData); err != nil {
-		return nil, fmt.Errorf("failed to parse timer status JSON: %s, output: %s", err.Error(), string(output))
+		return nil, commandError(ErrTimeTrackerFailed, "parse timer status JSON", err, output)
 	}
 
-	fmt.Printf("DEBUG: Parsed timer data: %+v\n", timerData)
 	return timerData, nil
 }
 
-func (s *TimeTrackerService) GetRecentEntries(limit int) ([]TimeEntry, error) {
-	// Build command to get recent entries using configurable Python executable with JSON output
-	cmd := exec.Command(s.config.PythonExecPath, "-m", "tt.cli", "list", "--json")
-	cmd.Dir = s.config.TimeTrackerPath
+func (s *TimeTrackerService) GetRecentEntries(ctx context.Context, limit int) ([]TimeEntry, error) {
+	if s.store != nil {
+		return s.getRecentEntriesNative(ctx, UserID(ctx), limit)
+	}
+	if err := requireCLIUser(ctx); err != nil {
+		return nil, err
+	}
 
-	// Execute command
-	output, err := cmd.CombinedOutput()
+	// Get recent entries with JSON output
+	output, err := s.runCLI(ctx, "list", "--json")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get recent entries: %s, output: %s", err.Error(), string(output))
+		return nil, commandError(ErrTimeTrackerFailed, "get recent entries", err, output)
 	}
 
 	// Parse JSON output
-	fmt.Printf("DEBUG: GetRecentEntries output: %s\n", string(output))
 	var entriesData []map[string]interface{}
 	if err := json.Unmarshal(output, &entriesData); err != nil {
-		return nil, fmt.Errorf("failed to parse recent entries JSON: %s, output: %s", err.Error(), string(output))
+		return nil, commandError(ErrTimeTrackerFailed, "parse recent entries JSON", err, output)
 	}
-	fmt.Printf("DEBUG: Parsed entries data: %+v\n", entriesData)
 
 	// Convert to TimeEntry structs
 	var entries []TimeEntry
 	for _, item := range entriesData {
-		entry := TimeEntry{
-			ID:              int(item["id"].(float64)),
-			Client:          item["client"].(string),
-			Project:         item["project"].(string),
-			Description:     item["description"].(string),
-			DurationMinutes: int(item["duration_minutes"].(float64)),
-			IsRunning:       item["is_running"].(bool),
-		}
-
-		// Parse start time
-		if startTimeStr, ok := item["start_time"].(string); ok {
-			// Try different time formats
-			if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
-				entry.StartTime = startTime
-			} else if startTime, err := time.Parse(time.RFC3339Nano, startTimeStr); err == nil {
-				entry.StartTime = startTime
-			} else if startTime, err := time.Parse("2006-01-02T15:04:05.999999", startTimeStr); err == nil {
-				entry.StartTime = startTime
-			} else {
-				fmt.Printf("DEBUG: Failed to parse start_time: %s, error: %v\n", startTimeStr, err)
-			}
-		}
-
-		// Parse end time if it exists
-		if endTimeStr, ok := item["end_time"].(string); ok && endTimeStr != "" {
-			// Try different time formats
-			if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
-				entry.EndTime = &endTime
-			} else if endTime, err := time.Parse(time.RFC3339Nano, endTimeStr); err == nil {
-				entry.EndTime = &endTime
-			} else if endTime, err := time.Parse("2006-01-02T15:04:05.999999", endTimeStr); err == nil {
-				entry.EndTime = &endTime
-			} else {
-				fmt.Printf("DEBUG: Failed to parse end_time: %s, error: %v\n", endTimeStr, err)
-			}
-		}
-
-		entries = append(entries, entry)
+		entries = append(entries, timeEntryFromJSON(ctx, item))
 	}
 
 	// Apply limit if specified
@@ -216,21 +306,24 @@ func (s *TimeTrackerService) GetRecentEntries(limit int) ([]TimeEntry, error) {
 	return entries, nil
 }
 
-func (s *TimeTrackerService) GetTodaySummary() (*TodaySummary, error) {
-	// Build command to get today's summary using configurable Python executable with JSON output
-	cmd := exec.Command(s.config.PythonExecPath, "-m", "tt.cli", "today", "--json")
-	cmd.Dir = s.config.TimeTrackerPath
+func (s *TimeTrackerService) GetTodaySummary(ctx context.Context) (*TodaySummary, error) {
+	if s.store != nil {
+		return s.getTodaySummaryNative(UserID(ctx))
+	}
+	if err := requireCLIUser(ctx); err != nil {
+		return nil, err
+	}
 
-	// Execute command
-	output, err := cmd.CombinedOutput()
+	// Get today's summary with JSON output
+	output, err := s.runCLI(ctx, "today", "--json")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get today's summary: %s, output: %s", err.Error(), string(output))
+		return nil, commandError(ErrTimeTrackerFailed, "get today's summary", err, output)
 	}
 
 	// Parse JSON output
 	var summaryData map[string]interface{}
 	if err := json.Unmarshal(output, &summaryData); err != nil {
-		return nil, fmt.Errorf("failed to parse today's summary JSON: %s, output: %s", err.Error(), string(output))
+		return nil, commandError(ErrTimeTrackerFailed, "parse today's summary JSON", err, output)
 	}
 
 	// Extract data from JSON
@@ -264,6 +357,55 @@ func (s *TimeTrackerService) GetTodaySummary() (*TodaySummary, error) {
 	}, nil
 }
 
+// timeEntryFromJSON converts an entry printed by kb-tt-cli with --json.
+func timeEntryFromJSON(ctx context.Context, item map[string]interface{}) TimeEntry {
+	id, _ := item["id"].(float64)
+	client, _ := item["client"].(string)
+	project, _ := item["project"].(string)
+	description, _ := item["description"].(string)
+	durationMinutes, _ := item["duration_minutes"].(float64)
+	isRunning, _ := item["is_running"].(bool)
+
+	entry := TimeEntry{
+		ID:              int(id),
+		Client:          client,
+		Project:         project,
+		Description:     description,
+		DurationMinutes: int(durationMinutes),
+		IsRunning:       isRunning,
+	}
+
+	// Parse start time
+	if startTimeStr, ok := item["start_time"].(string); ok {
+		if startTime, ok := parseCLITime(startTimeStr); ok {
+			entry.StartTime = startTime
+		} else {
+			logging.FromContext(ctx).Warn("kb-tt-cli returned an unparseable time", "start_time", startTimeStr)
+		}
+	}
+
+	// Parse end time if it exists
+	if endTimeStr, ok := item["end_time"].(string); ok && endTimeStr != "" {
+		if endTime, ok := parseCLITime(endTimeStr); ok {
+			entry.EndTime = &endTime
+		} else {
+			logging.FromContext(ctx).Warn("kb-tt-cli returned an unparseable time", "end_time", endTimeStr)
+		}
+	}
+
+	return entry
+}
+
+// parseCLITime tries the timestamp formats kb-tt-cli is known to print.
+func parseCLITime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, time.RFC3339Nano, "2006-01-02T15:04:05.999999"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
 // Helper function to check if a string contains a substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && s[:len(substr)] == substr ||
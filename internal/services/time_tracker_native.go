@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"kb-freelance-api/internal/store"
+)
+
+// Native implementations of the time tracker operations, used when the
+// service has a store instead of going through kb-tt-cli.
+
+func (s *TimeTrackerService) startTimerNative(ctx context.Context, userID int, client, project, description string) (*TimeEntry, error) {
+	row, err := s.store.StartEntry(userID, client, project, description, time.Now())
+	if errors.Is(err, store.ErrTimerRunning) {
+		return nil, ErrTimerRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to start timer: %w", err)
+	}
+
+	return s.pricedEntry(ctx, *row, row.StartTime)
+}
+
+func (s *TimeTrackerService) stopTimerNative(ctx context.Context, userID int) (*TimeEntry, error) {
+	row, err := s.store.StopEntry(userID, time.Now())
+	if errors.Is(err, store.ErrNoTimerRunning) {
+		return nil, ErrNoTimerRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stop timer: %w", err)
+	}
+
+	entry, err := s.pricedEntry(ctx, *row, *row.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	entry.BudgetEvents = s.budgets.EntryChanged(ctx, nil, row)
+	return entry, nil
+}
+
+func (s *TimeTrackerService) switchTimerNative(ctx context.Context, userID int, client, project, description string) (*TimerSwitch, error) {
+	stoppedRow, startedRow, err := s.store.SwitchEntry(userID, client, project, description, time.Now())
+	if errors.Is(err, store.ErrNoTimerRunning) {
+		return nil, ErrNoTimerRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to switch timer: %w", err)
+	}
+
+	entries, err := s.pricedEntries(ctx, []store.TimeEntry{*stoppedRow, *startedRow}, startedRow.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	entries[0].BudgetEvents = s.budgets.EntryChanged(ctx, nil, stoppedRow)
+	return &TimerSwitch{Stopped: &entries[0], Started: &entries[1]}, nil
+}
+
+func (s *TimeTrackerService) pauseTimerNative(ctx context.Context, userID int) (*TimeEntry, error) {
+	now := time.Now()
+	row, err := s.store.PauseEntry(userID, now)
+	switch {
+	case errors.Is(err, store.ErrNoTimerRunning):
+		return nil, ErrNoTimerRunning
+	case errors.Is(err, store.ErrTimerPaused):
+		return nil, ErrTimerPaused
+	case err != nil:
+		return nil, fmt.Errorf("failed to pause timer: %w", err)
+	}
+
+	return s.pricedEntry(ctx, *row, now)
+}
+
+func (s *TimeTrackerService) resumeTimerNative(ctx context.Context, userID int) (*TimeEntry, error) {
+	now := time.Now()
+	row, err := s.store.ResumeEntry(userID, now)
+	switch {
+	case errors.Is(err, store.ErrNoTimerRunning):
+		return nil, ErrNoTimerRunning
+	case errors.Is(err, store.ErrTimerNotPaused):
+		return nil, ErrTimerNotPaused
+	case err != nil:
+		return nil, fmt.Errorf("failed to resume timer: %w", err)
+	}
+
+	return s.pricedEntry(ctx, *row, now)
+}
+
+func (s *TimeTrackerService) getStatusNative(userID int) (map[string]interface{}, error) {
+	entry, err := s.store.RunningEntry(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timer status: %w", err)
+	}
+	if entry == nil {
+		return nil, nil // No timer running
+	}
+
+	return entryToMap(newTimeEntry(*entry, time.Now())), nil
+}
+
+func (s *TimeTrackerService) getRecentEntriesNative(ctx context.Context, userID, limit int) ([]TimeEntry, error) {
+	rows, err := s.store.ListEntries(userID, store.EntryFilter{Limit: limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent entries: %w", err)
+	}
+
+	return s.pricedEntries(ctx, rows, time.Now())
+}
+
+func (s *TimeTrackerService) getTodaySummaryNative(userID int) (*TodaySummary, error) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	rows, err := s.store.EntriesSince(userID, midnight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get today's summary: %w", err)
+	}
+
+	summary := &TodaySummary{EntryCount: len(rows)}
+	index := map[string]int{}
+	for _, row := range rows {
+		entry := newTimeEntry(row, now)
+		summary.TotalMinutes += entry.DurationMinutes
+
+		key := fmt.Sprintf("%s - %s", entry.Client, entry.Project)
+		i, ok := index[key]
+		if !ok {
+			i = len(summary.Breakdown)
+			index[key] = i
+			summary.Breakdown = append(summary.Breakdown, Breakdown{ClientProject: key})
+		}
+		summary.Breakdown[i].Minutes += entry.DurationMinutes
+	}
+
+	summary.TotalHours = minutesToHours(summary.TotalMinutes)
+	for i := range summary.Breakdown {
+		summary.Breakdown[i].Hours = minutesToHours(summary.Breakdown[i].Minutes)
+	}
+
+	return summary, nil
+}
+
+// newTimeEntry converts a stored row into the API representation. Running
+// entries report their duration up to now, without the time paused.
+func newTimeEntry(row store.TimeEntry, now time.Time) TimeEntry {
+	end := now
+	if row.EndTime != nil {
+		end = *row.EndTime
+	}
+	active := row.ActiveTime(time.Time{}, now)
+
+	var pauses []Pause
+	for _, pause := range row.Pauses {
+		pauses = append(pauses, Pause{StartTime: pause.Start, EndTime: pause.End})
+	}
+
+	return TimeEntry{
+		ID:              row.ID,
+		Client:          row.Client,
+		Project:         row.Project,
+		Description:     row.Description,
+		StartTime:       row.StartTime,
+		EndTime:         row.EndTime,
+		DurationMinutes: int(active.Minutes()),
+		IsRunning:       row.EndTime == nil,
+		IsPaused:        row.Paused(),
+		PausedMinutes:   int((end.Sub(row.StartTime) - active).Minutes()),
+		Pauses:          pauses,
+		InvoiceID:       row.InvoiceID,
+	}
+}
+
+// pricedEntries converts rows like newTimeEntry and, if the service has
+// rates, sets the hourly rate and billable amount of each entry.
+func (s *TimeTrackerService) pricedEntries(ctx context.Context, rows []store.TimeEntry, now time.Time) ([]TimeEntry, error) {
+	entries := make([]TimeEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, newTimeEntry(row, now))
+	}
+	if s.rates == nil {
+		return entries, nil
+	}
+
+	rates, err := s.rates.Rates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve hourly rates: %w", err)
+	}
+	for i, row := range rows {
+		entries[i].HourlyRate, entries[i].RateSource = rates.EntryRate(row)
+		entries[i].BillableAmount = roundCents(float64(entries[i].DurationMinutes) / 60 * entries[i].HourlyRate)
+	}
+	return entries, nil
+}
+
+// pricedEntry is pricedEntries for a single row.
+func (s *TimeTrackerService) pricedEntry(ctx context.Context, row store.TimeEntry, now time.Time) (*TimeEntry, error) {
+	entries, err := s.pricedEntries(ctx, []store.TimeEntry{row}, now)
+	if err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// entryToMap mirrors the JSON shape produced by kb-tt-cli, plus the pause
+// state kb-tt-cli does not track.
+func entryToMap(entry TimeEntry) map[string]interface{} {
+	result := map[string]interface{}{
+		"id":               entry.ID,
+		"client":           entry.Client,
+		"project":          entry.Project,
+		"description":      entry.Description,
+		"start_time":       entry.StartTime.Format(time.RFC3339),
+		"is_running":       entry.IsRunning,
+		"duration_minutes": entry.DurationMinutes,
+		"is_paused":        entry.IsPaused,
+		"paused_minutes":   entry.PausedMinutes,
+	}
+	if entry.IsPaused {
+		result["paused_since"] = entry.Pauses[len(entry.Pauses)-1].StartTime.Format(time.RFC3339)
+	}
+	if entry.EndTime != nil {
+		result["end_time"] = entry.EndTime.Format(time.RFC3339)
+	}
+	return result
+}
+
+func minutesToHours(minutes int) float64 {
+	return math.Round(float64(minutes)/60*100) / 100
+}
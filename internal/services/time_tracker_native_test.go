@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/store"
+)
+
+func newNativeTimeTracker(t *testing.T) *TimeTrackerService {
+	t.Helper()
+
+	dbPath := filepath.Join(t.TempDir(), "time_tracker.db")
+	st, err := store.Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	cfg := &config.Config{DatabasePath: dbPath, TimeTrackerBackend: "sqlite"}
+	return NewTimeTrackerServiceWithStore(cfg, st)
+}
+
+func TestNativeTimerLifecycle(t *testing.T) {
+	service := newNativeTimeTracker(t)
+
+	status, err := service.GetStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status != nil {
+		t.Fatalf("Expected no running timer, got %+v", status)
+	}
+
+	started, err := service.StartTimer(context.Background(), "Test Client", "Test Project", "Test Description")
+	if err != nil {
+		t.Fatalf("StartTimer failed: %v", err)
+	}
+	if started.ID == 0 || !started.IsRunning || started.EndTime != nil {
+		t.Errorf("Unexpected started entry: %+v", started)
+	}
+	if started.Client != "Test Client" || started.Project != "Test Project" || started.Description != "Test Description" {
+		t.Errorf("Unexpected started entry: %+v", started)
+	}
+
+	status, err = service.GetStatus(context.Background())
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status["client"] != "Test Client" || status["is_running"] != true {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	stopped, err := service.StopTimer(context.Background())
+	if err != nil {
+		t.Fatalf("StopTimer failed: %v", err)
+	}
+	if stopped.ID != started.ID || stopped.IsRunning || stopped.EndTime == nil {
+		t.Errorf("Unexpected stopped entry: %+v", stopped)
+	}
+	if stopped.Client != "Test Client" || !stopped.StartTime.Equal(started.StartTime) {
+		t.Errorf("Expected the started entry back, got %+v", stopped)
+	}
+
+	entries, err := service.GetRecentEntries(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("GetRecentEntries failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].ID != stopped.ID || entries[0].IsRunning || !entries[0].EndTime.Equal(*stopped.EndTime) {
+		t.Errorf("Expected the stopped entry, got %+v", entries[0])
+	}
+
+	summary, err := service.GetTodaySummary(context.Background())
+	if err != nil {
+		t.Fatalf("GetTodaySummary failed: %v", err)
+	}
+	if summary.EntryCount != 1 || len(summary.Breakdown) != 1 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+	if summary.Breakdown[0].ClientProject != "Test Client - Test Project" {
+		t.Errorf("Unexpected breakdown: %+v", summary.Breakdown[0])
+	}
+}
+
+func TestNewTimeEntry(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(95 * time.Minute)
+
+	stopped := newTimeEntry(store.TimeEntry{ID: 3, Client: "A", Project: "B", StartTime: start, EndTime: &end}, end.Add(time.Hour))
+	if stopped.DurationMinutes != 95 || stopped.IsRunning {
+		t.Errorf("Unexpected stopped entry: %+v", stopped)
+	}
+
+	running := newTimeEntry(store.TimeEntry{ID: 4, StartTime: start}, start.Add(30*time.Minute))
+	if running.DurationMinutes != 30 || !running.IsRunning {
+		t.Errorf("Unexpected running entry: %+v", running)
+	}
+
+	resumed := start.Add(20 * time.Minute)
+	pauses := []store.Pause{{Start: start.Add(10 * time.Minute), End: &resumed}, {Start: start.Add(40 * time.Minute)}}
+	paused := newTimeEntry(store.TimeEntry{ID: 5, StartTime: start, Pauses: pauses}, start.Add(time.Hour))
+	if paused.DurationMinutes != 30 || paused.PausedMinutes != 30 || !paused.IsPaused || len(paused.Pauses) != 2 {
+		t.Errorf("Unexpected paused entry: %+v", paused)
+	}
+}
+
+func TestSwitchTimer(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	ctx := context.Background()
+
+	if _, err := service.SwitchTimer(ctx, "Acme", "App", ""); !errors.Is(err, ErrNoTimerRunning) {
+		t.Errorf("Expected ErrNoTimerRunning, got %v", err)
+	}
+
+	first, err := service.StartTimer(ctx, "Acme", "Website", "")
+	if err != nil {
+		t.Fatalf("StartTimer failed: %v", err)
+	}
+	switched, err := service.SwitchTimer(ctx, "Acme", "App", "Review")
+	if err != nil {
+		t.Fatalf("SwitchTimer failed: %v", err)
+	}
+	if switched.Stopped.ID != first.ID || switched.Stopped.IsRunning || switched.Stopped.EndTime == nil {
+		t.Errorf("Unexpected stopped entry: %+v", switched.Stopped)
+	}
+	if !switched.Started.IsRunning || switched.Started.Project != "App" || !switched.Started.StartTime.Equal(*switched.Stopped.EndTime) {
+		t.Errorf("Expected the new entry to start when the first one stopped, got %+v", switched.Started)
+	}
+
+	withoutStore := NewTimeTrackerService(&config.Config{})
+	if _, err := withoutStore.SwitchTimer(ctx, "Acme", "App", ""); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+}
+
+func TestPauseAndResumeTimer(t *testing.T) {
+	service := newNativeTimeTracker(t)
+	ctx := context.Background()
+
+	if _, err := service.PauseTimer(ctx); !errors.Is(err, ErrNoTimerRunning) {
+		t.Errorf("Expected ErrNoTimerRunning, got %v", err)
+	}
+	if _, err := service.StartTimer(ctx, "Acme", "Website", ""); err != nil {
+		t.Fatalf("StartTimer failed: %v", err)
+	}
+	if _, err := service.ResumeTimer(ctx); !errors.Is(err, ErrTimerNotPaused) {
+		t.Errorf("Expected ErrTimerNotPaused, got %v", err)
+	}
+
+	paused, err := service.PauseTimer(ctx)
+	if err != nil {
+		t.Fatalf("PauseTimer failed: %v", err)
+	}
+	if !paused.IsPaused || !paused.IsRunning || len(paused.Pauses) != 1 {
+		t.Errorf("Unexpected paused entry: %+v", paused)
+	}
+	if _, err := service.PauseTimer(ctx); !errors.Is(err, ErrTimerPaused) {
+		t.Errorf("Expected ErrTimerPaused, got %v", err)
+	}
+
+	status, err := service.GetStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status["is_paused"] != true || status["paused_since"] == nil {
+		t.Errorf("Expected the status to report the pause, got %+v", status)
+	}
+
+	resumed, err := service.ResumeTimer(ctx)
+	if err != nil {
+		t.Fatalf("ResumeTimer failed: %v", err)
+	}
+	if resumed.IsPaused || resumed.Pauses[0].EndTime == nil {
+		t.Errorf("Unexpected resumed entry: %+v", resumed)
+	}
+
+	withoutStore := NewTimeTrackerService(&config.Config{})
+	if _, err := withoutStore.PauseTimer(ctx); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+}
+
+func TestStopTimerWithoutRunningTimer(t *testing.T) {
+	service := newNativeTimeTracker(t)
+
+	if _, err := service.StopTimer(context.Background()); err == nil {
+		t.Error("Expected an error when no timer is running")
+	}
+}
+
+func TestMinutesToHours(t *testing.T) {
+	if hours := minutesToHours(90); hours != 1.5 {
+		t.Errorf("Expected 1.5, got %f", hours)
+	}
+	if hours := minutesToHours(20); hours != 0.33 {
+		t.Errorf("Expected 0.33, got %f", hours)
+	}
+}
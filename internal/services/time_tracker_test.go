@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"regexp"
 	"strconv"
 	"strings"
@@ -154,6 +155,48 @@ func TestContains(t *testing.T) {
 	}
 }
 
+func TestTimeEntryFromJSON(t *testing.T) {
+	item := map[string]interface{}{
+		"id":               float64(7),
+		"client":           "Test Client",
+		"project":          "Test Project",
+		"description":      "Test Description",
+		"start_time":       "2024-01-01T09:00:00.123456",
+		"end_time":         "2024-01-01T10:30:00.000000",
+		"duration_minutes": float64(90),
+		"is_running":       false,
+	}
+
+	entry := timeEntryFromJSON(context.Background(), item)
+
+	if entry.ID != 7 {
+		t.Errorf("Expected ID 7, got %d", entry.ID)
+	}
+	if entry.Client != "Test Client" || entry.Project != "Test Project" {
+		t.Errorf("Unexpected client/project: %s/%s", entry.Client, entry.Project)
+	}
+	if entry.StartTime.Hour() != 9 {
+		t.Errorf("Expected start hour 9, got %d", entry.StartTime.Hour())
+	}
+	if entry.EndTime == nil || entry.EndTime.Hour() != 10 {
+		t.Errorf("Expected end time at 10:30, got %v", entry.EndTime)
+	}
+	if entry.DurationMinutes != 90 {
+		t.Errorf("Expected DurationMinutes 90, got %d", entry.DurationMinutes)
+	}
+}
+
+func TestTimeEntryFromJSONMissingFields(t *testing.T) {
+	entry := timeEntryFromJSON(context.Background(), map[string]interface{}{"id": float64(1), "is_running": true})
+
+	if entry.ID != 1 || !entry.IsRunning {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if entry.EndTime != nil {
+		t.Error("Expected no end time")
+	}
+}
+
 // Test the parsing logic with sample output
 func TestParseTodaySummary(t *testing.T) {
 	// Sample output from the Python CLI
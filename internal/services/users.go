@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/store"
+)
+
+var (
+	ErrUserNotFound = &Error{Kind: KindNotFound, Code: "user_not_found", Message: "user not found"}
+	ErrUserExists   = &Error{Kind: KindConflict, Code: "user_exists", Message: "a user with this name already exists"}
+	ErrInvalidUser  = &Error{Kind: KindValidation, Code: "invalid_user", Message: "invalid user"}
+)
+
+// User is someone tracking time and sending invoices. Every time entry,
+// invoice and API key belongs to one user.
+type User struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type userContextKey struct{}
+
+// WithUser returns a copy of ctx acting on behalf of the user with the
+// given ID.
+func WithUser(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, userContextKey{}, userID)
+}
+
+// UserID returns the user ctx acts on behalf of, or store.DefaultUserID if
+// it has none, as when authentication is disabled.
+func UserID(ctx context.Context) int {
+	if id, ok := ctx.Value(userContextKey{}).(int); ok {
+		return id
+	}
+	return store.DefaultUserID
+}
+
+// UserInvoiceDir returns the directory the user's invoice PDFs are written
+// to. The default user keeps the invoice output directory itself, so files
+// generated before there were users stay where they are; everyone else has
+// a directory under users/.
+func UserInvoiceDir(cfg *config.Config, userID int) string {
+	if userID == store.DefaultUserID {
+		return cfg.InvoiceOutputDir()
+	}
+	return filepath.Join(cfg.InvoiceOutputDir(), "users", strconv.Itoa(userID))
+}
+
+// UserService creates and lists users.
+type UserService struct {
+	store store.UserStore
+}
+
+// NewUserService creates a service keeping users in st. Without a store
+// there is only the default user and none can be created.
+func NewUserService(st *store.SQLiteStore) *UserService {
+	service := &UserService{}
+	if st != nil {
+		service.store = st
+	}
+	return service
+}
+
+// CreateUser adds a user with a unique name.
+func (s *UserService) CreateUser(ctx context.Context, name string) (*User, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidUser)
+	}
+
+	row, err := s.store.CreateUser(name, time.Now())
+	if errors.Is(err, store.ErrUserExists) {
+		return nil, WithDetails(fmt.Errorf("%w: %s", ErrUserExists, name), map[string]interface{}{"name": name})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user := newUser(*row)
+	return &user, nil
+}
+
+// GetUser returns the user with the given ID.
+func (s *UserService) GetUser(ctx context.Context, id int) (*User, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	row, err := s.store.GetUser(id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, WithDetails(fmt.Errorf("%w: %d", ErrUserNotFound, id), map[string]interface{}{"id": id})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user := newUser(*row)
+	return &user, nil
+}
+
+// ListUsers returns every user, oldest first.
+func (s *UserService) ListUsers(ctx context.Context) ([]User, error) {
+	if s.store == nil {
+		return nil, ErrStoreRequired
+	}
+
+	rows, err := s.store.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, newUser(row))
+	}
+	return users, nil
+}
+
+func newUser(row store.User) User {
+	return User{ID: row.ID, Name: row.Name, CreatedAt: row.CreatedAt}
+}
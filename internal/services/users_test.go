@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/store"
+)
+
+func openUserTestStore(t *testing.T) *store.SQLiteStore {
+	t.Helper()
+
+	st, err := store.Open(filepath.Join(t.TempDir(), "time_tracker.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestUserService(t *testing.T) {
+	service := NewUserService(openUserTestStore(t))
+	ctx := context.Background()
+
+	user, err := service.CreateUser(ctx, " alice ")
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if user.Name != "alice" || user.ID == store.DefaultUserID {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+	if _, err := service.CreateUser(ctx, "alice"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+	if _, err := service.CreateUser(ctx, " "); !errors.Is(err, ErrInvalidUser) {
+		t.Errorf("Expected ErrInvalidUser, got %v", err)
+	}
+	if _, err := service.GetUser(ctx, 99); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+
+	users, err := service.ListUsers(ctx)
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+	if len(users) != 2 || users[0].ID != store.DefaultUserID || users[1].Name != "alice" {
+		t.Errorf("Expected the default user and alice, got %+v", users)
+	}
+}
+
+func TestTimeTrackerIsScopedToUser(t *testing.T) {
+	st := openUserTestStore(t)
+	service := NewTimeTrackerServiceWithStore(&config.Config{}, st)
+	user, err := NewUserService(st).CreateUser(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	mine := context.Background()
+	theirs := WithUser(mine, user.ID)
+
+	if _, err := service.StartTimer(mine, "Acme", "Web", ""); err != nil {
+		t.Fatalf("StartTimer failed: %v", err)
+	}
+	started, err := service.StartTimer(theirs, "Globex", "App", "")
+	if err != nil {
+		t.Fatalf("Expected a second user to start their own timer, got %v", err)
+	}
+
+	stopped, err := service.StopTimer(theirs)
+	if err != nil {
+		t.Fatalf("StopTimer failed: %v", err)
+	}
+	if stopped.ID != started.ID {
+		t.Errorf("Expected to stop the user's own entry %d, got %d", started.ID, stopped.ID)
+	}
+	if status, err := service.GetStatus(mine); err != nil || status == nil {
+		t.Errorf("Expected the default user's timer to keep running, got %v, %v", status, err)
+	}
+	if _, err := service.GetEntry(mine, started.ID); !errors.Is(err, ErrTimeEntryNotFound) {
+		t.Errorf("Expected ErrTimeEntryNotFound for another user's entry, got %v", err)
+	}
+}
+
+func TestCLIBackendOnlyTracksDefaultUser(t *testing.T) {
+	runner := &ScriptedRunner{}
+	service := NewTimeTrackerServiceWithRunner(&config.Config{}, runner)
+
+	if _, err := service.StartTimer(WithUser(context.Background(), 2), "Acme", "Web", ""); !errors.Is(err, ErrStoreRequired) {
+		t.Errorf("Expected ErrStoreRequired, got %v", err)
+	}
+	if len(runner.Calls()) != 0 {
+		t.Errorf("Expected kb-tt-cli not to run, got %+v", runner.Calls())
+	}
+}
+
+func TestUserInvoiceDir(t *testing.T) {
+	cfg := &config.Config{InvoiceOutputPath: "/var/invoices"}
+
+	if dir := UserInvoiceDir(cfg, store.DefaultUserID); dir != "/var/invoices" {
+		t.Errorf("Expected the output directory for the default user, got %s", dir)
+	}
+	if dir := UserInvoiceDir(cfg, 2); dir != filepath.Join("/var/invoices", "users", "2") {
+		t.Errorf("Expected a directory per user, got %s", dir)
+	}
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"kb-freelance-api/internal/logging"
+)
+
+// workerScript is the Python side of the worker protocol.
+//
+//go:embed worker.py
+var workerScript string
+
+const (
+	// workerHealthInterval is how long a worker may sit idle before it is
+	// pinged again before use.
+	workerHealthInterval = 30 * time.Second
+	// workerPingTimeout bounds how long a starting or idle worker has to
+	// answer a ping.
+	workerPingTimeout = 10 * time.Second
+)
+
+// WorkerPool is a CommandRunner that answers "python -m <module>" commands
+// from persistent Python processes, which import each CLI once, instead of
+// starting an interpreter per command. Workers are started on first use,
+// pinged when they have been idle for a while and replaced when they crash.
+// Other commands, and commands no worker could be handed, go to the
+// fallback. Commands a worker failed while running are not run again,
+// since they may already have taken effect.
+type WorkerPool struct {
+	python   string
+	fallback CommandRunner
+
+	// slots holds a token for every running worker; idle holds the
+	// workers not currently answering a command.
+	slots chan struct{}
+	idle  chan *pythonWorker
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewWorkerPool creates a pool of up to size workers run with python.
+func NewWorkerPool(python string, size int, fallback CommandRunner) *WorkerPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &WorkerPool{
+		python:   python,
+		fallback: fallback,
+		slots:    make(chan struct{}, size),
+		idle:     make(chan *pythonWorker, size),
+	}
+}
+
+func (p *WorkerPool) Run(ctx context.Context, cmd Command) ([]byte, error) {
+	module, args, ok := p.workerCommand(cmd)
+	if !ok {
+		return p.fallback.Run(ctx, cmd)
+	}
+
+	worker, err := p.acquire(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		logging.FromContext(ctx).Warn("Python worker unavailable, running command directly", "command", cmd, "error", err)
+		return p.fallback.Run(ctx, cmd)
+	}
+
+	// The worker answered a ping while starting or being checked, so it
+	// already knows its version
+	if module == "" {
+		p.release(worker, true)
+		return []byte(worker.version + "\n"), nil
+	}
+
+	var result struct {
+		Output   string `json:"output"`
+		ExitCode int    `json:"exit_code"`
+	}
+	err = worker.call(ctx, "run", map[string]interface{}{"module": module, "args": args, "cwd": cmd.Dir}, &result)
+	if err != nil {
+		// An error reply leaves the worker usable; anything else means it
+		// crashed or was killed mid-command
+		var rpcErr *workerRPCError
+		p.release(worker, errors.As(err, &rpcErr))
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var sendErr *workerSendError
+		if errors.As(err, &sendErr) {
+			logging.FromContext(ctx).Warn("Python worker unavailable, running command directly", "command", cmd, "error", err)
+			return p.fallback.Run(ctx, cmd)
+		}
+		return nil, fmt.Errorf("python worker failed running %s: %w", cmd, err)
+	}
+	p.release(worker, true)
+
+	output := []byte(result.Output)
+	if result.ExitCode != 0 {
+		return output, workerExitError(result.ExitCode)
+	}
+	return output, nil
+}
+
+// workerExitError is the non-zero exit status of a command run by a
+// worker, reported like that of a process.
+type workerExitError int
+
+func (e workerExitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e workerExitError) ExitCode() int { return int(e) }
+
+// workerCommand returns the module and arguments of a command a worker can
+// run. The module is empty for "python --version".
+func (p *WorkerPool) workerCommand(cmd Command) (module string, args []string, ok bool) {
+	if cmd.Name != p.python || cmd.Stdin != nil || len(cmd.Env) > 0 {
+		return "", nil, false
+	}
+	if len(cmd.Args) == 1 && cmd.Args[0] == "--version" {
+		return "", nil, true
+	}
+	if len(cmd.Args) >= 2 && cmd.Args[0] == "-m" {
+		return cmd.Args[1], cmd.Args[2:], true
+	}
+	return "", nil, false
+}
+
+// acquire returns an idle, healthy worker, starting one if the pool is not
+// full yet.
+func (p *WorkerPool) acquire(ctx context.Context) (*pythonWorker, error) {
+	for {
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return nil, errors.New("worker pool is closed")
+		}
+
+		var worker *pythonWorker
+		select {
+		case worker = <-p.idle:
+		default:
+			select {
+			case worker = <-p.idle:
+			case p.slots <- struct{}{}:
+				worker, err := startPythonWorker(ctx, p.python)
+				if err != nil {
+					<-p.slots
+					return nil, err
+				}
+				return worker, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if time.Since(worker.lastUsed) < workerHealthInterval {
+			return worker, nil
+		}
+		if err := worker.ping(ctx); err != nil {
+			logging.FromContext(ctx).Warn("Python worker failed its health check, replacing it", "pid", worker.cmd.Process.Pid, "error", err)
+			p.release(worker, false)
+			continue
+		}
+		return worker, nil
+	}
+}
+
+// release returns a worker to the pool, or stops it if it is no longer
+// usable or the pool was closed.
+func (p *WorkerPool) release(worker *pythonWorker, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if healthy && !p.closed {
+		worker.lastUsed = time.Now()
+		p.idle <- worker
+		return
+	}
+	worker.stop()
+	<-p.slots
+}
+
+// Close stops the idle workers. Workers busy with a command are stopped
+// when they finish it.
+func (p *WorkerPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for {
+		select {
+		case worker := <-p.idle:
+			worker.stop()
+			<-p.slots
+		default:
+			return nil
+		}
+	}
+}
+
+// pythonWorker is one worker process. It answers one call at a time.
+type pythonWorker struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	stdout   *bufio.Reader
+	nextID   int
+	version  string
+	lastUsed time.Time
+	stopped  sync.Once
+}
+
+// workerRPCError is an error reply from a worker.
+type workerRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *workerRPCError) Error() string {
+	return fmt.Sprintf("python worker error %d: %s", e.Code, e.Message)
+}
+
+// workerSendError means a request could not be handed to a worker, so the
+// worker never saw it.
+type workerSendError struct {
+	err error
+}
+
+func (e *workerSendError) Error() string {
+	return fmt.Sprintf("failed to send request to python worker: %v", e.err)
+}
+
+func (e *workerSendError) Unwrap() error { return e.err }
+
+func startPythonWorker(ctx context.Context, python string) (*pythonWorker, error) {
+	cmd := exec.Command(python, "-u", "-c", workerScript)
+	cmd.Stderr = os.Stderr
+	startInProcessGroup(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start python worker: %w", err)
+	}
+
+	worker := &pythonWorker{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+	if err := worker.ping(ctx); err != nil {
+		worker.stop()
+		return nil, fmt.Errorf("python worker did not start: %w", err)
+	}
+	return worker, nil
+}
+
+// ping checks that the worker answers and records its Python version.
+func (w *pythonWorker) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, workerPingTimeout)
+	defer cancel()
+
+	var result struct {
+		Version string `json:"version"`
+	}
+	if err := w.call(ctx, "ping", nil, &result); err != nil {
+		return err
+	}
+	w.version = result.Version
+	w.lastUsed = time.Now()
+	return nil
+}
+
+// call sends a request and decodes the result of its response. If ctx is
+// done first the worker is killed, since its state is then unknown.
+func (w *pythonWorker) call(ctx context.Context, method string, params, result interface{}) error {
+	w.nextID++
+	request, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": w.nextID, "method": method, "params": params})
+	if err != nil {
+		return &workerSendError{err}
+	}
+	if _, err := w.stdin.Write(append(request, '\n')); err != nil {
+		return &workerSendError{err}
+	}
+
+	type reply struct {
+		line []byte
+		err  error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		line, err := w.stdout.ReadBytes('\n')
+		replies <- reply{line, err}
+	}()
+
+	var r reply
+	select {
+	case r = <-replies:
+	case <-ctx.Done():
+		w.stop()
+		return ctx.Err()
+	}
+	if r.err != nil {
+		return fmt.Errorf("python worker exited: %w", r.err)
+	}
+
+	var response struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *workerRPCError `json:"error"`
+	}
+	if err := json.Unmarshal(r.line, &response); err != nil {
+		return fmt.Errorf("invalid response from python worker: %w", err)
+	}
+	if response.ID != w.nextID {
+		return fmt.Errorf("python worker answered request %d, expected %d", response.ID, w.nextID)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// stop kills the worker and the processes it started, and waits for it to
+// exit.
+func (w *pythonWorker) stop() {
+	w.stopped.Do(func() {
+		w.stdin.Close()
+		killProcessGroup(w.cmd)
+		w.cmd.Wait()
+	})
+}
@@ -0,0 +1,153 @@
+"""Persistent Python worker for kb-freelance-api.
+
+Reads JSON-RPC 2.0 requests from stdin, one per line, and writes one
+response per line to stdout. CLI modules are imported once and reused, so
+commands do not pay for interpreter startup and imports. Each working
+directory is a separate checkout: modules imported from one are only visible
+to commands run in it, so same-named modules of two CLIs do not clash.
+
+Methods:
+  ping                      -> {"pid": ..., "version": "Python 3.x.y"}
+  run {module, args, cwd}   -> {"output": "...", "exit_code": 0}
+"""
+
+import contextlib
+import importlib
+import io
+import json
+import os
+import platform
+import runpy
+import sys
+import traceback
+
+# sys.path without the directory the worker started in
+_base_path = [p for p in sys.path if p not in ("", ".")]
+# Modules imported from each checkout, keyed by its absolute path
+_checkouts = {}
+_entry_points = {}
+
+
+def entry_point(root, module):
+    """Returns the click command defined by module, importing it once."""
+    key = (root, module)
+    if key not in _entry_points:
+        mod = importlib.import_module(module)
+        command = None
+        for name in ("cli", "main"):
+            candidate = getattr(mod, name, None)
+            if hasattr(candidate, "main") and hasattr(candidate, "params"):
+                command = candidate
+                break
+        _entry_points[key] = command
+    return _entry_points[key]
+
+
+def in_checkout(module, root):
+    """Reports whether module was imported from the checkout at root."""
+    paths = list(getattr(module, "__path__", None) or [])
+    if getattr(module, "__file__", None):
+        paths.append(module.__file__)
+    return any(os.path.abspath(p).startswith(root + os.sep) for p in paths)
+
+
+def enter_checkout(root):
+    """Makes the checkout at root, and only it, importable."""
+    sys.path[:] = ([root] if root else []) + _base_path
+    sys.modules.update(_checkouts.get(root, {}))
+
+
+def leave_checkout(root):
+    """Puts the modules imported from the checkout at root aside."""
+    if not root:
+        return
+    own = {name: mod for name, mod in list(sys.modules.items()) if mod is not None and in_checkout(mod, root)}
+    for name in own:
+        del sys.modules[name]
+    _checkouts.setdefault(root, {}).update(own)
+
+
+def exit_status(code, output):
+    if code is None:
+        return 0
+    if isinstance(code, int):
+        return code
+    print(code, file=output)
+    return 1
+
+
+def run(module, args, cwd):
+    root = os.path.abspath(cwd) if cwd else None
+    if root:
+        os.chdir(root)
+    enter_checkout(root)
+
+    output = io.StringIO()
+    exit_code = 0
+    stdin, argv = sys.stdin, sys.argv
+    # Prompts see the end of input instead of reading the next request
+    sys.stdin = io.StringIO()
+    sys.argv = [module] + list(args)
+    try:
+        with contextlib.redirect_stdout(output), contextlib.redirect_stderr(output):
+            command = entry_point(root, module)
+            if command is not None:
+                command.main(args=list(args), prog_name=module)
+            else:
+                runpy.run_module(module, run_name="__main__", alter_sys=True)
+    except SystemExit as e:
+        exit_code = exit_status(e.code, output)
+    except Exception:
+        traceback.print_exc(file=output)
+        exit_code = 1
+    finally:
+        sys.stdin, sys.argv = stdin, argv
+        leave_checkout(root)
+
+    return {"output": output.getvalue(), "exit_code": exit_code}
+
+
+def reply(protocol, request_id, result=None, error=None):
+    response = {"jsonrpc": "2.0", "id": request_id}
+    if error is not None:
+        response["error"] = {"code": error[0], "message": error[1]}
+    else:
+        response["result"] = result
+    protocol.write(json.dumps(response) + "\n")
+    protocol.flush()
+
+
+def main():
+    # Keep the real stdout for responses; anything else written to it, e.g.
+    # by child processes, goes to stderr instead
+    protocol = os.fdopen(os.dup(1), "w")
+    os.dup2(2, 1)
+
+    for line in sys.stdin:
+        if not line.strip():
+            continue
+        try:
+            request = json.loads(line)
+        except ValueError as e:
+            reply(protocol, None, error=(-32700, "parse error: %s" % e))
+            continue
+
+        request_id = request.get("id")
+        method = request.get("method")
+        params = request.get("params") or {}
+        try:
+            if method == "ping":
+                result = {"pid": os.getpid(), "version": "Python " + platform.python_version()}
+            elif method == "run":
+                result = run(params["module"], params.get("args") or [], params.get("cwd"))
+            else:
+                reply(protocol, request_id, error=(-32601, "method not found: %s" % method))
+                continue
+        except Exception as e:
+            reply(protocol, request_id, error=(-32000, "".join(traceback.format_exception_only(type(e), e)).strip()))
+            continue
+        reply(protocol, request_id, result=result)
+
+
+if __name__ == "__main__":
+    main()
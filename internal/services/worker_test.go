@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCLIModule stands in for tt.cli. Like a click command, it exposes cli
+// with main and params, and exits through SystemExit.
+const fakeCLIModule = `import os
+import subprocess
+import sys
+import time
+
+IMPORTS = [os.getpid()]
+
+
+class Command:
+    params = []
+
+    def main(self, args=None, prog_name=None):
+        if args[0] == "whoami":
+            print("%d %s" % (os.getpid(), os.getcwd()))
+        elif args[0] == "fail":
+            print("database is locked")
+            sys.exit(2)
+        elif args[0] == "prompt":
+            input("Notes: ")
+        elif args[0] == "crash":
+            os._exit(1)
+        elif args[0] == "hang":
+            time.sleep(30)
+        elif args[0] == "spawn":
+            child = subprocess.Popen(["sleep", "30"])
+            with open("child.pid", "w") as f:
+                f.write(str(child.pid))
+            time.sleep(30)
+        sys.exit(0)
+
+
+cli = Command()
+`
+
+// newWorkerTestPool creates a pool whose workers can import the fake tt.cli
+// from the returned directory. Unhandled commands go to fallback.
+func newWorkerTestPool(t *testing.T, fallback CommandRunner) (*WorkerPool, string) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 is not available")
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "tt"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tt", "__init__.py"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tt", "cli.py"), []byte(fakeCLIModule), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewWorkerPool(python, 1, fallback)
+	t.Cleanup(func() { pool.Close() })
+	return pool, dir
+}
+
+func workerCommand(pool *WorkerPool, dir string, args ...string) Command {
+	return Command{Name: pool.python, Args: append([]string{"-m", "tt.cli"}, args...), Dir: dir}
+}
+
+func TestWorkerPoolReusesWorker(t *testing.T) {
+	fallback := &ScriptedRunner{}
+	pool, dir := newWorkerTestPool(t, fallback)
+
+	first, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami"))
+	if err != nil {
+		t.Fatalf("Run failed: %v, output: %s", err, first)
+	}
+	second, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami"))
+	if err != nil {
+		t.Fatalf("Run failed: %v, output: %s", err, second)
+	}
+
+	fields := strings.Fields(string(first))
+	if len(fields) != 2 || fields[1] != dir {
+		t.Errorf("Expected the command to run in %s, got %q", dir, first)
+	}
+	if string(first) != string(second) {
+		t.Errorf("Expected both commands to be answered by the same worker, got %q and %q", first, second)
+	}
+
+	version, err := pool.Run(context.Background(), Command{Name: pool.python, Args: []string{"--version"}})
+	if err != nil || !strings.HasPrefix(string(version), "Python 3") {
+		t.Errorf("Expected the worker's Python version, got %q, %v", version, err)
+	}
+	if calls := fallback.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no commands to fall back, got %v", calls)
+	}
+}
+
+func TestWorkerPoolReportsExitStatus(t *testing.T) {
+	pool, dir := newWorkerTestPool(t, &ScriptedRunner{})
+
+	output, err := pool.Run(context.Background(), workerCommand(pool, dir, "fail"))
+	if err == nil || err.Error() != "exit status 2" {
+		t.Errorf("Expected exit status 2, got %v", err)
+	}
+	if string(output) != "database is locked\n" {
+		t.Errorf("Expected the command's output, got %q", output)
+	}
+
+	// Prompts must not read the worker's requests
+	output, err = pool.Run(context.Background(), workerCommand(pool, dir, "prompt"))
+	if err == nil || !strings.Contains(string(output), "EOFError") {
+		t.Errorf("Expected the prompt to see the end of input, got %q, %v", output, err)
+	}
+	if _, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami")); err != nil {
+		t.Errorf("Expected the worker to keep answering, got %v", err)
+	}
+}
+
+func TestWorkerPoolDoesNotRerunCrashedCommands(t *testing.T) {
+	fallback := &ScriptedRunner{}
+	fallback.On("-m", "other").Return("not a worker command", nil)
+	pool, dir := newWorkerTestPool(t, fallback)
+
+	before, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami"))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// The worker may have run part of the command, so it must not run again
+	if _, err := pool.Run(context.Background(), workerCommand(pool, dir, "crash")); err == nil {
+		t.Error("Expected the crashed command to fail")
+	}
+	if calls := fallback.Calls(); len(calls) != 0 {
+		t.Errorf("Expected the crashed command not to fall back, got %v", calls)
+	}
+
+	after, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami"))
+	if err != nil {
+		t.Fatalf("Run failed after the crash: %v", err)
+	}
+	if string(before) == string(after) {
+		t.Errorf("Expected a new worker after the crash, got %q twice", after)
+	}
+
+	stdin := Command{Name: pool.python, Args: []string{"-m", "other"}, Stdin: strings.NewReader("input")}
+	if output, err := pool.Run(context.Background(), stdin); err != nil || string(output) != "not a worker command" {
+		t.Errorf("Expected commands with stdin to fall back, got %q, %v", output, err)
+	}
+}
+
+func TestWorkerPoolFallsBackWhenRequestCannotBeSent(t *testing.T) {
+	fallback := &ScriptedRunner{}
+	fallback.On("-m", "tt.cli", "whoami").Return("ran directly", nil)
+	pool, dir := newWorkerTestPool(t, fallback)
+
+	if _, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami")); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// The worker never sees a request written to its closed stdin
+	worker := <-pool.idle
+	worker.stdin.Close()
+	pool.idle <- worker
+
+	output, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami"))
+	if err != nil || string(output) != "ran directly" {
+		t.Errorf("Expected the undelivered command to run through the fallback, got %q, %v", output, err)
+	}
+}
+
+func TestWorkerPoolTimeout(t *testing.T) {
+	pool, dir := newWorkerTestPool(t, &ScriptedRunner{})
+
+	begin := time.Now()
+	_, err := runCommand(context.Background(), pool, workerCommand(pool, dir, "hang"), 200*time.Millisecond)
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Fatalf("Expected ErrCommandTimeout, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 5*time.Second {
+		t.Errorf("Expected the hung worker to be killed promptly, took %s", elapsed)
+	}
+
+	if _, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami")); err != nil {
+		t.Errorf("Expected a replacement worker after the timeout, got %v", err)
+	}
+}
+
+func TestWorkerPoolHealthCheckReplacesDeadWorker(t *testing.T) {
+	pool, dir := newWorkerTestPool(t, &ScriptedRunner{})
+
+	before, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami"))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Kill the idle worker behind the pool's back and make it due for a
+	// health check
+	worker := <-pool.idle
+	worker.cmd.Process.Kill()
+	worker.lastUsed = time.Now().Add(-2 * workerHealthInterval)
+	pool.idle <- worker
+
+	after, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami"))
+	if err != nil {
+		t.Fatalf("Run failed after the health check: %v", err)
+	}
+	if string(before) == string(after) {
+		t.Errorf("Expected the dead worker to be replaced, got %q twice", after)
+	}
+}
+
+func TestWorkerPoolKeepsCheckoutsApart(t *testing.T) {
+	pool, dir := newWorkerTestPool(t, &ScriptedRunner{})
+
+	// A second checkout whose tt.cli has the same name but other behaviour
+	other := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(other, "tt"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(other, "tt", "__init__.py"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	otherCLI := strings.Replace(fakeCLIModule, `print("%d %s" % (os.getpid(), os.getcwd()))`, `print("other %d" % os.getpid())`, 1)
+	if err := os.WriteFile(filepath.Join(other, "tt", "cli.py"), []byte(otherCLI), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami"))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	second, err := pool.Run(context.Background(), workerCommand(pool, other, "whoami"))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	again, err := pool.Run(context.Background(), workerCommand(pool, dir, "whoami"))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	pid := strings.Fields(string(first))[0]
+	if string(second) != "other "+pid+"\n" {
+		t.Errorf("Expected the same worker to run the other checkout's tt.cli, got %q", second)
+	}
+	if string(again) != string(first) {
+		t.Errorf("Expected the first checkout's tt.cli again, got %q and %q", first, again)
+	}
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIKey is a row of the api_keys table. Only a hash of the key itself is
+// stored.
+type APIKey struct {
+	ID   int
+	Name string
+	// Prefix is the start of the key, kept so keys can be told apart.
+	Prefix     string
+	Hash       string
+	UserID     int
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// APIKeyStore persists API keys.
+type APIKeyStore interface {
+	CreateAPIKey(key APIKey) (*APIKey, error)
+	GetAPIKeyByHash(hash string) (*APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	RevokeAPIKey(id int, at time.Time) (*APIKey, error)
+	TouchAPIKey(id int, at time.Time) error
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, user_id, CAST(created_at AS TEXT),
+	CAST(last_used_at AS TEXT), CAST(revoked_at AS TEXT)`
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	var scopes, createdAt string
+	var lastUsedAt, revokedAt sql.NullString
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &scopes, &key.UserID, &createdAt, &lastUsedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, " ")
+	}
+
+	var err error
+	if key.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("API key %d: %w", key.ID, err)
+	}
+	if key.LastUsedAt, err = parseNullableTimestamp(lastUsedAt); err != nil {
+		return nil, fmt.Errorf("API key %d: %w", key.ID, err)
+	}
+	if key.RevokedAt, err = parseNullableTimestamp(revokedAt); err != nil {
+		return nil, fmt.Errorf("API key %d: %w", key.ID, err)
+	}
+	return &key, nil
+}
+
+func getAPIKey(q queryer, condition string, arg interface{}) (*APIKey, error) {
+	key, err := scanAPIKey(q.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE `+condition, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+	return key, nil
+}
+
+// CreateAPIKey stores key and returns it with its ID. Scopes are stored
+// space-separated, so they must not contain spaces. A zero UserID gives the
+// key to DefaultUserID; an unknown one fails with ErrNotFound.
+func (s *SQLiteStore) CreateAPIKey(key APIKey) (*APIKey, error) {
+	key.CreatedAt = truncateTimestamp(key.CreatedAt)
+	if key.UserID == 0 {
+		key.UserID = DefaultUserID
+	}
+
+	err := s.withTx(func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)`, key.UserID).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check user %d: %w", key.UserID, err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: user %d", ErrNotFound, key.UserID)
+		}
+
+		result, err := tx.Exec(`INSERT INTO api_keys (name, prefix, key_hash, scopes, user_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`, key.Name, key.Prefix, key.Hash, strings.Join(key.Scopes, " "),
+			key.UserID, formatTimestamp(key.CreatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to create API key: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to create API key: %w", err)
+		}
+		key.ID = int(id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetAPIKeyByHash returns the key with the given hash, revoked or not, or
+// ErrNotFound.
+func (s *SQLiteStore) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	return getAPIKey(s.db, `key_hash = ?`, hash)
+}
+
+// ListAPIKeys returns every key, oldest first.
+func (s *SQLiteStore) ListAPIKeys() ([]APIKey, error) {
+	rows, err := s.db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list API keys: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey marks the key revoked at the given time, keeping the time of
+// an earlier revocation, or returns ErrNotFound.
+func (s *SQLiteStore) RevokeAPIKey(id int, at time.Time) (*APIKey, error) {
+	var key *APIKey
+	err := s.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`,
+			formatTimestamp(at), id); err != nil {
+			return fmt.Errorf("failed to revoke API key %d: %w", id, err)
+		}
+
+		var err error
+		key, err = getAPIKey(tx, `id = ?`, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// TouchAPIKey records that the key was used at the given time.
+func (s *SQLiteStore) TouchAPIKey(id int, at time.Time) error {
+	if _, err := s.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, formatTimestamp(at), id); err != nil {
+		return fmt.Errorf("failed to update API key %d: %w", id, err)
+	}
+	return nil
+}
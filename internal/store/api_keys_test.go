@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	st := openTestStore(t)
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local)
+
+	key, err := st.CreateAPIKey(APIKey{Name: "ci", Prefix: "kb_1234", Hash: "hash-1", Scopes: []string{"time:read", "invoice:read"}, CreatedAt: created})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if _, err := st.CreateAPIKey(APIKey{Name: "admin", Prefix: "kb_5678", Hash: "hash-2", Scopes: []string{"admin"}, CreatedAt: created}); err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if _, err := st.CreateAPIKey(APIKey{Name: "duplicate", Hash: "hash-1", CreatedAt: created}); err == nil {
+		t.Error("Expected keys with the same hash to be rejected")
+	}
+	if _, err := st.CreateAPIKey(APIKey{Name: "nobody", Hash: "hash-3", UserID: 99, CreatedAt: created}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown user, got %v", err)
+	}
+
+	found, err := st.GetAPIKeyByHash("hash-1")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash failed: %v", err)
+	}
+	if found.ID != key.ID || found.Name != "ci" || found.UserID != DefaultUserID || len(found.Scopes) != 2 || found.Scopes[1] != "invoice:read" {
+		t.Errorf("Unexpected key: %+v", found)
+	}
+	if !found.CreatedAt.Equal(created) || found.LastUsedAt != nil || found.RevokedAt != nil {
+		t.Errorf("Unexpected timestamps: %+v", found)
+	}
+	if _, err := st.GetAPIKeyByHash("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	used := created.Add(time.Hour)
+	if err := st.TouchAPIKey(key.ID, used); err != nil {
+		t.Fatalf("TouchAPIKey failed: %v", err)
+	}
+	revoked, err := st.RevokeAPIKey(key.ID, used)
+	if err != nil {
+		t.Fatalf("RevokeAPIKey failed: %v", err)
+	}
+	if revoked.RevokedAt == nil || !revoked.RevokedAt.Equal(used) || revoked.LastUsedAt == nil {
+		t.Errorf("Expected the key to be used and revoked, got %+v", revoked)
+	}
+
+	// Revoking again keeps the original time
+	again, err := st.RevokeAPIKey(key.ID, used.Add(time.Hour))
+	if err != nil || !again.RevokedAt.Equal(used) {
+		t.Errorf("Expected the first revocation time, got %+v, %v", again, err)
+	}
+	if _, err := st.RevokeAPIKey(99, used); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	keys, err := st.ListAPIKeys()
+	if err != nil {
+		t.Fatalf("ListAPIKeys failed: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Name != "ci" || keys[1].Name != "admin" {
+		t.Errorf("Unexpected keys: %+v", keys)
+	}
+}
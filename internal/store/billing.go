@@ -0,0 +1,137 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// billingInvoiceColumn selects the invoice billing a time_entries row. Void
+// invoices release their entries so they can be billed again.
+const billingInvoiceColumn = `(SELECT l.invoice_id FROM invoice_time_entries l
+	JOIN invoices i ON i.id = l.invoice_id
+	WHERE l.time_entry_id = time_entries.id AND i.status != 'void'
+	ORDER BY l.invoice_id DESC LIMIT 1)`
+
+// UnbilledEntries returns the user's completed entries for client that are
+// not on any invoice, oldest first. from and to bound the start time,
+// inclusive and exclusive; nil bounds are open.
+func (s *SQLiteStore) UnbilledEntries(userID int, client string, from, to *time.Time) ([]TimeEntry, error) {
+	query := `SELECT ` + timeEntryColumns + ` FROM time_entries
+		WHERE client = ? AND end_time IS NOT NULL AND ` + billingInvoiceColumn + ` IS NULL
+		AND ` + entryOwnerColumn + ` = ?`
+	args := []interface{}{client, userID}
+	if from != nil {
+		query += ` AND start_time >= ?`
+		args = append(args, formatTimestamp(*from))
+	}
+	if to != nil {
+		query += ` AND start_time < ?`
+		args = append(args, formatTimestamp(*to))
+	}
+	query += ` ORDER BY start_time, id`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unbilled time entries: %w", err)
+	}
+	return scanTimeEntries(s.db, rows)
+}
+
+// checkUnbilled returns ErrNotFound if any of the entries does not belong
+// to the user, and ErrAlreadyBilled if any is on an invoice that is not
+// void.
+func checkUnbilled(tx *sql.Tx, userID int, entryIDs []int) error {
+	for _, id := range entryIDs {
+		if _, err := getEntry(tx, userID, id); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("%w: time entry %d", ErrNotFound, id)
+			}
+			return err
+		}
+
+		var invoiceID int
+		err := tx.QueryRow(`SELECT l.invoice_id FROM invoice_time_entries l
+			JOIN invoices i ON i.id = l.invoice_id
+			WHERE l.time_entry_id = ? AND i.status != 'void' LIMIT 1`, id).Scan(&invoiceID)
+		if err == nil {
+			return fmt.Errorf("%w: time entry %d is on invoice %d", ErrAlreadyBilled, id, invoiceID)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check time entry %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// checkUnchanged fails with ErrEntryChanged if the billed times, pauses,
+// rate, client or project of any of entries differ from the database.
+func checkUnchanged(tx *sql.Tx, userID int, entries []TimeEntry) error {
+	for _, billed := range entries {
+		current, err := getEntry(tx, userID, billed.ID)
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: time entry %d", ErrNotFound, billed.ID)
+		}
+		if err != nil {
+			return err
+		}
+		if !sameBilling(billed, *current) {
+			return fmt.Errorf("%w: time entry %d was edited", ErrEntryChanged, billed.ID)
+		}
+	}
+	return nil
+}
+
+// sameBilling reports whether a and b are billed the same way.
+func sameBilling(a, b TimeEntry) bool {
+	if a.Client != b.Client || a.Project != b.Project || !a.StartTime.Equal(b.StartTime) ||
+		!sameTime(a.EndTime, b.EndTime) || len(a.Pauses) != len(b.Pauses) {
+		return false
+	}
+	if (a.HourlyRate == nil) != (b.HourlyRate == nil) || (a.HourlyRate != nil && *a.HourlyRate != *b.HourlyRate) {
+		return false
+	}
+	for i := range a.Pauses {
+		if !a.Pauses[i].Start.Equal(b.Pauses[i].Start) || !sameTime(a.Pauses[i].End, b.Pauses[i].End) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func linkTimeEntries(tx *sql.Tx, invoiceID int, entryIDs []int) error {
+	for _, id := range entryIDs {
+		if _, err := tx.Exec(`INSERT INTO invoice_time_entries (invoice_id, time_entry_id) VALUES (?, ?)`,
+			invoiceID, id); err != nil {
+			return fmt.Errorf("failed to bill time entry %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func listBilledEntryIDs(q queryer, invoiceID int) ([]int, error) {
+	rows, err := q.Query(`SELECT time_entry_id FROM invoice_time_entries WHERE invoice_id = ?
+		ORDER BY time_entry_id`, invoiceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time entries of invoice %d: %w", invoiceID, err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
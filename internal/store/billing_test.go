@@ -0,0 +1,180 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func createTestEntry(t *testing.T, st *SQLiteStore, client string, start time.Time, minutes int) *TimeEntry {
+	t.Helper()
+
+	entry := TimeEntry{Client: client, Project: "Website", StartTime: start}
+	if minutes > 0 {
+		end := start.Add(time.Duration(minutes) * time.Minute)
+		entry.EndTime = &end
+	}
+	created, err := st.CreateEntry(DefaultUserID, entry)
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	return created
+}
+
+func TestUnbilledEntries(t *testing.T) {
+	st := openTestStore(t)
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+
+	first := createTestEntry(t, st, "Acme", day, 60)
+	second := createTestEntry(t, st, "Acme", day.AddDate(0, 0, 1), 30)
+	createTestEntry(t, st, "Other", day, 60)
+	createTestEntry(t, st, "Acme", day.AddDate(0, 0, 2), 0)
+
+	entries, err := st.UnbilledEntries(DefaultUserID, "Acme", nil, nil)
+	if err != nil {
+		t.Fatalf("UnbilledEntries failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != first.ID || entries[1].ID != second.ID {
+		t.Fatalf("Expected the two completed Acme entries, got %+v", entries)
+	}
+
+	to := day.AddDate(0, 0, 1)
+	if entries, err = st.UnbilledEntries(DefaultUserID, "Acme", nil, &to); err != nil || len(entries) != 1 {
+		t.Errorf("Expected one entry before %v, got %+v (%v)", to, entries, err)
+	}
+
+	invoice := testInvoice(day)
+	invoice.TimeEntryIDs = []int{first.ID}
+	created, err := st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+
+	if entries, err = st.UnbilledEntries(DefaultUserID, "Acme", nil, nil); err != nil || len(entries) != 1 || entries[0].ID != second.ID {
+		t.Errorf("Expected only the unbilled entry, got %+v (%v)", entries, err)
+	}
+
+	billed, err := st.GetEntry(DefaultUserID, first.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if billed.InvoiceID == nil || *billed.InvoiceID != created.ID {
+		t.Errorf("Expected entry to be billed on invoice %d, got %v", created.ID, billed.InvoiceID)
+	}
+
+	loaded, err := st.GetInvoice(DefaultUserID, created.ID)
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if len(loaded.TimeEntryIDs) != 1 || loaded.TimeEntryIDs[0] != first.ID {
+		t.Errorf("Expected invoice to list entry %d, got %v", first.ID, loaded.TimeEntryIDs)
+	}
+}
+
+func TestCreateInvoiceRejectsBilledEntries(t *testing.T) {
+	st := openTestStore(t)
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	entry := createTestEntry(t, st, "Acme", day, 60)
+
+	invoice := testInvoice(day)
+	invoice.TimeEntryIDs = []int{entry.ID}
+	first, err := st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+
+	if _, err := st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, nil); !errors.Is(err, ErrAlreadyBilled) {
+		t.Fatalf("Expected ErrAlreadyBilled, got %v", err)
+	}
+
+	// Voiding the invoice releases its entries
+	if _, err := st.UpdateInvoice(DefaultUserID, first.ID, func(invoice *Invoice) error {
+		invoice.Status = "void"
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateInvoice failed: %v", err)
+	}
+
+	second, err := st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+	if second.Number != "2026-0002" {
+		t.Errorf("Expected the rejected invoice not to use a number, got %s", second.Number)
+	}
+}
+
+func TestDeleteEntryKeepsInvoicesIntact(t *testing.T) {
+	st := openTestStore(t)
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	entry := createTestEntry(t, st, "Acme", day, 60)
+
+	invoice := testInvoice(day)
+	invoice.TimeEntryIDs = []int{entry.ID}
+	created, err := st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+	if err := st.DeleteEntry(DefaultUserID, entry.ID); !errors.Is(err, ErrAlreadyBilled) {
+		t.Fatalf("Expected ErrAlreadyBilled, got %v", err)
+	}
+
+	if _, err := st.UpdateInvoice(DefaultUserID, created.ID, func(invoice *Invoice) error {
+		invoice.Status = "void"
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateInvoice failed: %v", err)
+	}
+	if err := st.DeleteEntry(DefaultUserID, entry.ID); err != nil {
+		t.Fatalf("DeleteEntry failed: %v", err)
+	}
+
+	// The next entry reuses the ID but none of the old entry's links
+	next := createTestEntry(t, st, "Acme", day, 30)
+	if next.ID != entry.ID {
+		t.Fatalf("Expected SQLite to reuse ID %d, got %d", entry.ID, next.ID)
+	}
+	if loaded, err := st.GetInvoice(DefaultUserID, created.ID); err != nil || len(loaded.TimeEntryIDs) != 0 {
+		t.Errorf("Expected the void invoice to lose its link to the deleted entry, got %+v, %v", loaded, err)
+	}
+	if entries, err := st.UnbilledEntries(DefaultUserID, "Acme", nil, nil); err != nil || len(entries) != 1 {
+		t.Errorf("Expected the new entry to be unbilled, got %+v, %v", entries, err)
+	}
+}
+
+func TestCreateInvoiceRejectsEditedEntries(t *testing.T) {
+	st := openTestStore(t)
+	day := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	entry := createTestEntry(t, st, "Acme", day, 60)
+
+	entries, err := st.UnbilledEntries(DefaultUserID, "Acme", nil, nil)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected the entry, got %+v (%v)", entries, err)
+	}
+	invoice := testInvoice(day)
+	invoice.TimeEntryIDs = []int{entry.ID}
+	invoice.BilledEntries = entries
+
+	// The entry is lengthened after the invoice was computed from it
+	_, err = st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, func(*Invoice) error {
+		_, err := st.UpdateEntry(DefaultUserID, entry.ID, func(entry *TimeEntry) error {
+			end := entry.EndTime.Add(time.Hour)
+			entry.EndTime = &end
+			return nil
+		})
+		return err
+	})
+	if !errors.Is(err, ErrEntryChanged) {
+		t.Fatalf("Expected ErrEntryChanged, got %v", err)
+	}
+	if current, err := st.GetEntry(DefaultUserID, entry.ID); err != nil || current.InvoiceID != nil {
+		t.Errorf("Expected the entry to stay unbilled, got %+v, %v", current, err)
+	}
+
+	if invoice.BilledEntries, err = st.UnbilledEntries(DefaultUserID, "Acme", nil, nil); err != nil {
+		t.Fatalf("UnbilledEntries failed: %v", err)
+	}
+	if _, err := st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, nil); err != nil {
+		t.Errorf("Expected the unchanged entry to be billed, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrClientExists = errors.New("a client with this name already exists")
+	ErrClientInUse  = errors.New("client is referenced by invoices or projects")
+)
+
+// Client is a row of the clients table. Name is what time entries record
+// as their client; the other details fill in invoices.
+type Client struct {
+	ID             int
+	UserID         int
+	Name           string
+	LegalName      string
+	Emails         []string
+	BillingAddress string
+	TaxID          string
+	Currency       string
+	// PaymentTermsDays is the number of days invoices are due after
+	// issue. Nil uses the configured default.
+	PaymentTermsDays *int
+	// HourlyRate of zero means the client has no default rate.
+	HourlyRate float64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ClientStore persists each user's clients.
+type ClientStore interface {
+	CreateClient(userID int, client Client) (*Client, error)
+	GetClient(userID, id int) (*Client, error)
+	ListClients(userID int) ([]Client, error)
+	UpdateClient(userID, id int, update func(client *Client) error) (*Client, error)
+	DeleteClient(userID, id int) error
+}
+
+const clientColumns = `id, user_id, name, COALESCE(legal_name, ''), emails, COALESCE(billing_address, ''),
+	COALESCE(tax_id, ''), COALESCE(currency, ''), payment_terms_days, hourly_rate,
+	CAST(created_at AS TEXT), CAST(updated_at AS TEXT)`
+
+func scanClient(row rowScanner) (*Client, error) {
+	var client Client
+	var emails, createdAt, updatedAt string
+	var paymentTerms sql.NullInt64
+	if err := row.Scan(&client.ID, &client.UserID, &client.Name, &client.LegalName, &emails, &client.BillingAddress,
+		&client.TaxID, &client.Currency, &paymentTerms, &client.HourlyRate, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(emails), &client.Emails); err != nil {
+		return nil, fmt.Errorf("client %d: invalid emails: %w", client.ID, err)
+	}
+	if paymentTerms.Valid {
+		days := int(paymentTerms.Int64)
+		client.PaymentTermsDays = &days
+	}
+
+	var err error
+	if client.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("client %d: %w", client.ID, err)
+	}
+	if client.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+		return nil, fmt.Errorf("client %d: %w", client.ID, err)
+	}
+	return &client, nil
+}
+
+func getClient(q queryer, userID, id int) (*Client, error) {
+	client, err := scanClient(q.QueryRow(`SELECT `+clientColumns+` FROM clients WHERE id = ? AND user_id = ?`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client %d: %w", id, err)
+	}
+	return client, nil
+}
+
+// checkClientName returns ErrClientExists if another of the user's clients
+// is called name.
+func checkClientName(tx *sql.Tx, userID, id int, name string) error {
+	var existing int
+	err := tx.QueryRow(`SELECT id FROM clients WHERE user_id = ? AND name = ? AND id != ?`, userID, name, id).Scan(&existing)
+	if err == nil {
+		return fmt.Errorf("%w: %s", ErrClientExists, name)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to check client %s: %w", name, err)
+	}
+	return nil
+}
+
+// CreateClient stores a new client for the user, or fails with
+// ErrClientExists if the user already has one with the same name.
+func (s *SQLiteStore) CreateClient(userID int, client Client) (*Client, error) {
+	client.UserID = userID
+	client.CreatedAt = truncateTimestamp(time.Now())
+	client.UpdatedAt = client.CreatedAt
+	if client.Emails == nil {
+		client.Emails = []string{}
+	}
+
+	emails, err := json.Marshal(client.Emails)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode client emails: %w", err)
+	}
+
+	err = s.withTx(func(tx *sql.Tx) error {
+		if err := checkClientName(tx, userID, 0, client.Name); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`INSERT INTO clients (user_id, name, legal_name, emails, billing_address, tax_id,
+			currency, payment_terms_days, hourly_rate, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, userID, client.Name, client.LegalName, string(emails),
+			client.BillingAddress, client.TaxID, client.Currency, client.PaymentTermsDays, client.HourlyRate,
+			formatTimestamp(client.CreatedAt), formatTimestamp(client.UpdatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to create client: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to read client id: %w", err)
+		}
+		client.ID = int(id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// GetClient returns the user's client with the given ID or ErrNotFound.
+func (s *SQLiteStore) GetClient(userID, id int) (*Client, error) {
+	return getClient(s.db, userID, id)
+}
+
+// ListClients returns the user's clients ordered by name.
+func (s *SQLiteStore) ListClients(userID int) ([]Client, error) {
+	rows, err := s.db.Query(`SELECT `+clientColumns+` FROM clients WHERE user_id = ? ORDER BY name, id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clients: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []Client{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+// UpdateClient loads the client, lets update modify it and saves the result
+// in a single transaction. Renaming it onto another client's name fails
+// with ErrClientExists.
+func (s *SQLiteStore) UpdateClient(userID, id int, update func(client *Client) error) (*Client, error) {
+	var client *Client
+	err := s.withTx(func(tx *sql.Tx) error {
+		current, err := getClient(tx, userID, id)
+		if err != nil {
+			return err
+		}
+
+		if err := update(current); err != nil {
+			return err
+		}
+		if err := checkClientName(tx, userID, id, current.Name); err != nil {
+			return err
+		}
+
+		if current.Emails == nil {
+			current.Emails = []string{}
+		}
+		emails, err := json.Marshal(current.Emails)
+		if err != nil {
+			return fmt.Errorf("failed to encode client emails: %w", err)
+		}
+
+		current.UpdatedAt = truncateTimestamp(time.Now())
+		if _, err := tx.Exec(`UPDATE clients
+			SET name = ?, legal_name = ?, emails = ?, billing_address = ?, tax_id = ?, currency = ?,
+				payment_terms_days = ?, hourly_rate = ?, updated_at = ?
+			WHERE id = ?`, current.Name, current.LegalName, string(emails), current.BillingAddress, current.TaxID,
+			current.Currency, current.PaymentTermsDays, current.HourlyRate, formatTimestamp(current.UpdatedAt), id); err != nil {
+			return fmt.Errorf("failed to update client %d: %w", id, err)
+		}
+
+		client = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// DeleteClient removes the user's client with the given ID. Clients that
+// invoices were issued to or that have projects are kept, failing with
+// ErrClientInUse. The client's rate changes are removed with it.
+func (s *SQLiteStore) DeleteClient(userID, id int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := getClient(tx, userID, id); err != nil {
+			return err
+		}
+
+		var invoices int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM invoices WHERE client_id = ?`, id).Scan(&invoices); err != nil {
+			return fmt.Errorf("failed to check invoices of client %d: %w", id, err)
+		}
+		if invoices > 0 {
+			return fmt.Errorf("%w: %d invoices", ErrClientInUse, invoices)
+		}
+
+		var projects int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM projects WHERE client_id = ?`, id).Scan(&projects); err != nil {
+			return fmt.Errorf("failed to check projects of client %d: %w", id, err)
+		}
+		if projects > 0 {
+			return fmt.Errorf("%w: %d projects", ErrClientInUse, projects)
+		}
+
+		if _, err := tx.Exec(`DELETE FROM rate_changes WHERE client_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete rate changes of client %d: %w", id, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM clients WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete client %d: %w", id, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClients(t *testing.T) {
+	st := openTestStore(t)
+	terms := 14
+
+	client, err := st.CreateClient(DefaultUserID, Client{
+		Name:             "Acme",
+		LegalName:        "Acme Corporation Ltd",
+		Emails:           []string{"billing@acme.test", "ap@acme.test"},
+		BillingAddress:   "1 Main Street\nSpringfield",
+		TaxID:            "GB123456789",
+		Currency:         "GBP",
+		PaymentTermsDays: &terms,
+		HourlyRate:       95,
+	})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	if _, err := st.CreateClient(DefaultUserID, Client{Name: "Acme"}); !errors.Is(err, ErrClientExists) {
+		t.Errorf("Expected ErrClientExists, got %v", err)
+	}
+	other, err := st.CreateClient(DefaultUserID, Client{Name: "Globex"})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+
+	found, err := st.GetClient(DefaultUserID, client.ID)
+	if err != nil {
+		t.Fatalf("GetClient failed: %v", err)
+	}
+	if found.LegalName != "Acme Corporation Ltd" || len(found.Emails) != 2 || found.Emails[1] != "ap@acme.test" ||
+		found.BillingAddress != "1 Main Street\nSpringfield" || found.Currency != "GBP" ||
+		found.PaymentTermsDays == nil || *found.PaymentTermsDays != 14 || found.HourlyRate != 95 {
+		t.Errorf("Unexpected client: %+v", found)
+	}
+	if found, err := st.GetClient(DefaultUserID, other.ID); err != nil || found.PaymentTermsDays != nil || len(found.Emails) != 0 {
+		t.Errorf("Expected a client without details, got %+v, %v", found, err)
+	}
+
+	// Names stay unique when renaming
+	if _, err := st.UpdateClient(DefaultUserID, other.ID, func(c *Client) error {
+		c.Name = "Acme"
+		return nil
+	}); !errors.Is(err, ErrClientExists) {
+		t.Errorf("Expected ErrClientExists, got %v", err)
+	}
+	updated, err := st.UpdateClient(DefaultUserID, client.ID, func(c *Client) error {
+		c.PaymentTermsDays = nil
+		c.HourlyRate = 100
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateClient failed: %v", err)
+	}
+	if updated.PaymentTermsDays != nil || updated.HourlyRate != 100 || updated.UpdatedAt.Before(updated.CreatedAt) {
+		t.Errorf("Unexpected update: %+v", updated)
+	}
+
+	clients, err := st.ListClients(DefaultUserID)
+	if err != nil {
+		t.Fatalf("ListClients failed: %v", err)
+	}
+	if len(clients) != 2 || clients[0].Name != "Acme" || clients[1].Name != "Globex" {
+		t.Errorf("Expected clients ordered by name, got %+v", clients)
+	}
+
+	// Clients that were invoiced cannot be deleted
+	invoice := testInvoice(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local))
+	invoice.ClientID = &client.ID
+	invoice.Currency = "GBP"
+	created, err := st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+	if stored, err := st.GetInvoice(DefaultUserID, created.ID); err != nil || stored.ClientID == nil || *stored.ClientID != client.ID || stored.Currency != "GBP" {
+		t.Errorf("Expected the invoice to record its client, got %+v, %v", stored, err)
+	}
+	if err := st.DeleteClient(DefaultUserID, client.ID); !errors.Is(err, ErrClientInUse) {
+		t.Errorf("Expected ErrClientInUse, got %v", err)
+	}
+	if err := st.DeleteClient(DefaultUserID, other.ID); err != nil {
+		t.Errorf("DeleteClient failed: %v", err)
+	}
+	if err := st.DeleteClient(DefaultUserID, other.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestClientsAreScopedToUser(t *testing.T) {
+	st := openTestStore(t)
+	alice, err := st.CreateUser("alice", time.Now())
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	client, err := st.CreateClient(DefaultUserID, Client{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	// Another user may use the same name
+	if _, err := st.CreateClient(alice.ID, Client{Name: "Acme"}); err != nil {
+		t.Errorf("Expected names to be unique per user, got %v", err)
+	}
+	if _, err := st.GetClient(alice.ID, client.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for another user's client, got %v", err)
+	}
+	if err := st.DeleteClient(alice.ID, client.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting another user's client, got %v", err)
+	}
+	if clients, err := st.ListClients(alice.ID); err != nil || len(clients) != 1 || clients[0].UserID != alice.ID {
+		t.Errorf("Expected only the user's client, got %+v, %v", clients, err)
+	}
+}
@@ -0,0 +1,464 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateLayout is used for date-only columns such as issue and due dates.
+const dateLayout = "2006-01-02"
+
+// Invoice is a row of the invoices table.
+type Invoice struct {
+	ID int
+	// Number is unique per user.
+	Number      string
+	UserID      int
+	ClientName  string
+	ClientEmail string
+	LineItems   []InvoiceLine
+	Subtotal    float64
+	TaxRate     float64
+	Tax         float64
+	Total       float64
+	Notes       string
+	IssueDate   time.Time
+	DueDate     time.Time
+	PDFPath     string
+	CreatedAt   time.Time
+	Status      string
+	IssuedAt    *time.Time
+	SentAt      *time.Time
+	PaidAt      *time.Time
+	VoidedAt    *time.Time
+	// ClientID is the registered client billed, if the invoice was
+	// generated for one.
+	ClientID *int
+	Currency string
+	// AmountPaid is the sum of the payments recorded against the invoice.
+	AmountPaid float64
+	// Payments is only loaded by GetInvoice.
+	Payments []Payment
+	// TimeEntryIDs are the time entries billed by the invoice. CreateInvoice
+	// refuses entries already billed elsewhere; only GetInvoice loads them.
+	TimeEntryIDs []int
+	// BilledEntries are the entries of TimeEntryIDs as the invoice was
+	// computed from them. CreateInvoice fails with ErrEntryChanged if any
+	// was edited since; it is not stored.
+	BilledEntries []TimeEntry
+}
+
+// InvoiceLine is a line item stored with an invoice.
+type InvoiceLine struct {
+	Description string  `json:"description"`
+	Hours       float64 `json:"hours"`
+	Rate        float64 `json:"rate"`
+	Amount      float64 `json:"amount"`
+}
+
+// Payment is a row of the invoice_payments table.
+type Payment struct {
+	ID        int
+	InvoiceID int
+	Amount    float64
+	PaidOn    time.Time
+	Reference string
+	CreatedAt time.Time
+}
+
+// InvoiceFilter selects invoices. Zero values match everything.
+type InvoiceFilter struct {
+	Statuses []string
+	// DueBefore and DueFrom bound the due date, exclusive and inclusive.
+	DueBefore *time.Time
+	DueFrom   *time.Time
+	// Limit of zero or less returns every match.
+	Limit int
+}
+
+// NumberFormatter builds an invoice number from the sequence value allocated
+// within scope.
+type NumberFormatter interface {
+	// Scope returns the sequence an invoice issued on date draws from, e.g.
+	// its year when numbers reset yearly.
+	Scope(issueDate time.Time) string
+	Format(issueDate time.Time, sequence int) string
+}
+
+// InvoiceStore persists invoices.
+type InvoiceStore interface {
+	CreateInvoice(userID int, invoice Invoice, numbers NumberFormatter, finalize func(invoice *Invoice) error) (*Invoice, error)
+	GetInvoice(userID, id int) (*Invoice, error)
+	ListInvoices(userID int, filter InvoiceFilter) ([]Invoice, error)
+	UpdateInvoice(userID, id int, update func(invoice *Invoice) error) (*Invoice, error)
+	RecordPayment(userID, id int, payment Payment, update func(invoice *Invoice) error) (*Invoice, error)
+	UnbilledEntries(userID int, client string, from, to *time.Time) ([]TimeEntry, error)
+}
+
+const invoiceColumns = `id, number, user_id, client_name, client_email, line_items, subtotal, tax_rate, tax, total,
+	COALESCE(notes, ''), CAST(issue_date AS TEXT), CAST(due_date AS TEXT), COALESCE(pdf_path, ''),
+	CAST(created_at AS TEXT), status, CAST(issued_at AS TEXT), CAST(sent_at AS TEXT),
+	CAST(paid_at AS TEXT), CAST(voided_at AS TEXT), client_id, COALESCE(currency, ''),
+	(SELECT COALESCE(SUM(amount), 0) FROM invoice_payments WHERE invoice_id = invoices.id)`
+
+func scanInvoice(row rowScanner) (*Invoice, error) {
+	var invoice Invoice
+	var lineItems, issueDate, dueDate, createdAt string
+	var issuedAt, sentAt, paidAt, voidedAt sql.NullString
+	var clientID sql.NullInt64
+	if err := row.Scan(&invoice.ID, &invoice.Number, &invoice.UserID, &invoice.ClientName, &invoice.ClientEmail,
+		&lineItems, &invoice.Subtotal, &invoice.TaxRate, &invoice.Tax, &invoice.Total, &invoice.Notes, &issueDate, &dueDate,
+		&invoice.PDFPath, &createdAt, &invoice.Status, &issuedAt, &sentAt, &paidAt, &voidedAt,
+		&clientID, &invoice.Currency, &invoice.AmountPaid); err != nil {
+		return nil, err
+	}
+	if clientID.Valid {
+		id := int(clientID.Int64)
+		invoice.ClientID = &id
+	}
+
+	if err := json.Unmarshal([]byte(lineItems), &invoice.LineItems); err != nil {
+		return nil, fmt.Errorf("invoice %d: invalid line items: %w", invoice.ID, err)
+	}
+
+	var err error
+	if invoice.IssueDate, err = time.ParseInLocation(dateLayout, issueDate, time.Local); err != nil {
+		return nil, fmt.Errorf("invoice %d: %w", invoice.ID, err)
+	}
+	if invoice.DueDate, err = time.ParseInLocation(dateLayout, dueDate, time.Local); err != nil {
+		return nil, fmt.Errorf("invoice %d: %w", invoice.ID, err)
+	}
+	if invoice.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("invoice %d: %w", invoice.ID, err)
+	}
+
+	for _, field := range []struct {
+		value  sql.NullString
+		target **time.Time
+	}{
+		{issuedAt, &invoice.IssuedAt},
+		{sentAt, &invoice.SentAt},
+		{paidAt, &invoice.PaidAt},
+		{voidedAt, &invoice.VoidedAt},
+	} {
+		if *field.target, err = parseNullableTimestamp(field.value); err != nil {
+			return nil, fmt.Errorf("invoice %d: %w", invoice.ID, err)
+		}
+	}
+
+	return &invoice, nil
+}
+
+// allocateInvoiceNumber takes the lowest released number of scope or else
+// the next value of its sequence.
+func allocateInvoiceNumber(tx *sql.Tx, scope string) (int, error) {
+	var released sql.NullInt64
+	if err := tx.QueryRow(`SELECT MIN(value) FROM released_invoice_numbers WHERE scope = ?`, scope).Scan(&released); err != nil {
+		return 0, fmt.Errorf("failed to allocate invoice number: %w", err)
+	}
+	if released.Valid {
+		if _, err := tx.Exec(`DELETE FROM released_invoice_numbers WHERE scope = ? AND value = ?`, scope, released.Int64); err != nil {
+			return 0, fmt.Errorf("failed to allocate invoice number: %w", err)
+		}
+		return int(released.Int64), nil
+	}
+
+	var next int
+	err := tx.QueryRow(`SELECT next_value FROM invoice_sequences WHERE scope = ?`, scope).Scan(&next)
+	if errors.Is(err, sql.ErrNoRows) {
+		next = 1
+		_, err = tx.Exec(`INSERT INTO invoice_sequences (scope, next_value) VALUES (?, ?)`, scope, next+1)
+	} else if err == nil {
+		_, err = tx.Exec(`UPDATE invoice_sequences SET next_value = ? WHERE scope = ?`, next+1, scope)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate invoice number: %w", err)
+	}
+	return next, nil
+}
+
+// releaseInvoiceNumber hands a number allocated for an invoice that was not
+// stored back to scope and returns cause, the reason it was not stored.
+func (s *SQLiteStore) releaseInvoiceNumber(scope string, sequence int, cause error) error {
+	err := s.withTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO released_invoice_numbers (scope, value) VALUES (?, ?)`, scope, sequence)
+		return err
+	})
+	if err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to release invoice number: %w", err))
+	}
+	return cause
+}
+
+// sequenceScope keeps each user's invoice numbers in their own sequence.
+// The default user keeps the scopes used before there were users.
+func sequenceScope(userID int, scope string) string {
+	if userID == DefaultUserID {
+		return scope
+	}
+	return fmt.Sprintf("user:%d:%s", userID, scope)
+}
+
+// CreateInvoice allocates the user's next invoice number and stores the
+// invoice, marking invoice.TimeEntryIDs as billed. finalize runs once the
+// number is known, to render the PDF for example. It runs outside any
+// transaction, so slow renders do not hold up other writes.
+//
+// Numbers are unique but only gap-free as long as the process survives: if
+// finalize or storing the invoice fails, the number is handed out again to
+// the next invoice, which may then be numbered below invoices issued
+// before it. A number reserved when the process dies is lost.
+func (s *SQLiteStore) CreateInvoice(userID int, invoice Invoice, numbers NumberFormatter, finalize func(invoice *Invoice) error) (*Invoice, error) {
+	if invoice.Status == "" {
+		invoice.Status = "draft"
+	}
+	invoice.UserID = userID
+
+	scope := sequenceScope(userID, numbers.Scope(invoice.IssueDate))
+	var sequence int
+	err := s.withTx(func(tx *sql.Tx) error {
+		var err error
+		if sequence, err = allocateInvoiceNumber(tx, scope); err != nil {
+			return err
+		}
+		return checkUnbilled(tx, userID, invoice.TimeEntryIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	invoice.Number = numbers.Format(invoice.IssueDate, sequence)
+	invoice.CreatedAt = truncateTimestamp(time.Now())
+
+	if finalize != nil {
+		if err := finalize(&invoice); err != nil {
+			return nil, s.releaseInvoiceNumber(scope, sequence, err)
+		}
+	}
+
+	err = s.withTx(func(tx *sql.Tx) error {
+		// The entries may have been billed, edited or deleted while
+		// finalizing
+		if err := checkUnbilled(tx, userID, invoice.TimeEntryIDs); err != nil {
+			return err
+		}
+		if err := checkUnchanged(tx, userID, invoice.BilledEntries); err != nil {
+			return err
+		}
+
+		lineItems, err := json.Marshal(invoice.LineItems)
+		if err != nil {
+			return fmt.Errorf("failed to encode line items: %w", err)
+		}
+
+		result, err := tx.Exec(`INSERT INTO invoices (number, user_id, client_name, client_email, line_items,
+			subtotal, tax_rate, tax, total, notes, issue_date, due_date, pdf_path, created_at, status,
+			client_id, currency)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			invoice.Number, userID, invoice.ClientName, invoice.ClientEmail, string(lineItems),
+			invoice.Subtotal, invoice.TaxRate, invoice.Tax, invoice.Total, invoice.Notes,
+			invoice.IssueDate.Format(dateLayout), invoice.DueDate.Format(dateLayout),
+			invoice.PDFPath, formatTimestamp(invoice.CreatedAt), invoice.Status,
+			invoice.ClientID, invoice.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to insert invoice: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to read invoice id: %w", err)
+		}
+		invoice.ID = int(id)
+		return linkTimeEntries(tx, invoice.ID, invoice.TimeEntryIDs)
+	})
+	if err != nil {
+		return nil, s.releaseInvoiceNumber(scope, sequence, err)
+	}
+	return &invoice, nil
+}
+
+func getInvoice(q queryer, userID, id int) (*Invoice, error) {
+	row := q.QueryRow(`SELECT `+invoiceColumns+` FROM invoices WHERE id = ? AND user_id = ?`, id, userID)
+	invoice, err := scanInvoice(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load invoice %d: %w", id, err)
+	}
+
+	if invoice.Payments, err = listPayments(q, id); err != nil {
+		return nil, err
+	}
+	if invoice.TimeEntryIDs, err = listBilledEntryIDs(q, id); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+func listPayments(q queryer, invoiceID int) ([]Payment, error) {
+	rows, err := q.Query(`SELECT id, invoice_id, amount, CAST(paid_on AS TEXT), COALESCE(reference, ''),
+		CAST(created_at AS TEXT) FROM invoice_payments WHERE invoice_id = ? ORDER BY paid_on, id`, invoiceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payments of invoice %d: %w", invoiceID, err)
+	}
+	defer rows.Close()
+
+	payments := []Payment{}
+	for rows.Next() {
+		var payment Payment
+		var paidOn, createdAt string
+		if err := rows.Scan(&payment.ID, &payment.InvoiceID, &payment.Amount, &paidOn,
+			&payment.Reference, &createdAt); err != nil {
+			return nil, err
+		}
+		if payment.PaidOn, err = time.ParseInLocation(dateLayout, paidOn, time.Local); err != nil {
+			return nil, fmt.Errorf("payment %d: %w", payment.ID, err)
+		}
+		if payment.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			return nil, fmt.Errorf("payment %d: %w", payment.ID, err)
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// GetInvoice returns the user's invoice with the given ID, including its
+// payments, or ErrNotFound.
+func (s *SQLiteStore) GetInvoice(userID, id int) (*Invoice, error) {
+	return getInvoice(s.db, userID, id)
+}
+
+// ListInvoices returns the user's invoices matching filter, most recent
+// first.
+func (s *SQLiteStore) ListInvoices(userID int, filter InvoiceFilter) ([]Invoice, error) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	if len(filter.Statuses) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.Statuses)), ", ")
+		conditions = append(conditions, "status IN ("+placeholders+")")
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if filter.DueBefore != nil {
+		conditions = append(conditions, "due_date < ?")
+		args = append(args, filter.DueBefore.Format(dateLayout))
+	}
+	if filter.DueFrom != nil {
+		conditions = append(conditions, "due_date >= ?")
+		args = append(args, filter.DueFrom.Format(dateLayout))
+	}
+
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invoices: %w", err)
+	}
+	defer rows.Close()
+
+	invoices := []Invoice{}
+	for rows.Next() {
+		invoice, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, *invoice)
+	}
+	return invoices, rows.Err()
+}
+
+func saveInvoiceStatus(tx *sql.Tx, invoice *Invoice) error {
+	for _, t := range []*time.Time{invoice.IssuedAt, invoice.SentAt, invoice.PaidAt, invoice.VoidedAt} {
+		if t != nil {
+			*t = truncateTimestamp(*t)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE invoices
+		SET status = ?, issued_at = ?, sent_at = ?, paid_at = ?, voided_at = ?
+		WHERE id = ?`, invoice.Status, nullableTimestamp(invoice.IssuedAt), nullableTimestamp(invoice.SentAt),
+		nullableTimestamp(invoice.PaidAt), nullableTimestamp(invoice.VoidedAt), invoice.ID); err != nil {
+		return fmt.Errorf("failed to update invoice %d: %w", invoice.ID, err)
+	}
+	return nil
+}
+
+// UpdateInvoice loads the invoice, applies update and saves its status and
+// status timestamps in a single transaction, so concurrent transitions
+// cannot interleave. The invoice contents themselves are immutable.
+func (s *SQLiteStore) UpdateInvoice(userID, id int, update func(invoice *Invoice) error) (*Invoice, error) {
+	var invoice *Invoice
+	err := s.withTx(func(tx *sql.Tx) error {
+		current, err := getInvoice(tx, userID, id)
+		if err != nil {
+			return err
+		}
+
+		if err := update(current); err != nil {
+			return err
+		}
+		if err := saveInvoiceStatus(tx, current); err != nil {
+			return err
+		}
+
+		invoice = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// RecordPayment stores payment against the invoice. update runs first, in
+// the same transaction, to validate the payment and move the invoice to its
+// new status.
+func (s *SQLiteStore) RecordPayment(userID, id int, payment Payment, update func(invoice *Invoice) error) (*Invoice, error) {
+	var invoice *Invoice
+	err := s.withTx(func(tx *sql.Tx) error {
+		current, err := getInvoice(tx, userID, id)
+		if err != nil {
+			return err
+		}
+
+		if err := update(current); err != nil {
+			return err
+		}
+
+		payment.InvoiceID = id
+		payment.CreatedAt = truncateTimestamp(time.Now())
+		result, err := tx.Exec(`INSERT INTO invoice_payments (invoice_id, amount, paid_on, reference, created_at)
+			VALUES (?, ?, ?, ?, ?)`, id, payment.Amount, payment.PaidOn.Format(dateLayout),
+			payment.Reference, formatTimestamp(payment.CreatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to record payment for invoice %d: %w", id, err)
+		}
+		paymentID, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to read payment id: %w", err)
+		}
+		payment.ID = int(paymentID)
+
+		if err := saveInvoiceStatus(tx, current); err != nil {
+			return err
+		}
+
+		current.Payments = append(current.Payments, payment)
+		current.AmountPaid += payment.Amount
+		invoice = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
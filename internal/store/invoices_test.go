@@ -0,0 +1,359 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// yearlyNumbers formats numbers as YEAR-SEQ with a sequence per year.
+type yearlyNumbers struct{}
+
+func (yearlyNumbers) Scope(issueDate time.Time) string { return issueDate.Format("2006") }
+
+func (yearlyNumbers) Format(issueDate time.Time, sequence int) string {
+	return fmt.Sprintf("%s-%04d", issueDate.Format("2006"), sequence)
+}
+
+func testInvoice(issueDate time.Time) Invoice {
+	return Invoice{
+		ClientName:  "Test Client",
+		ClientEmail: "test@example.com",
+		LineItems:   []InvoiceLine{{Description: "Work", Hours: 2, Rate: 50, Amount: 100}},
+		Subtotal:    100,
+		Total:       100,
+		IssueDate:   issueDate,
+		DueDate:     issueDate.AddDate(0, 0, 30),
+	}
+}
+
+func TestCreateInvoiceNumbersSequentially(t *testing.T) {
+	st := openTestStore(t)
+	issued := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+
+	var numbers []string
+	for i := 0; i < 3; i++ {
+		invoice, err := st.CreateInvoice(DefaultUserID, testInvoice(issued), yearlyNumbers{}, nil)
+		if err != nil {
+			t.Fatalf("CreateInvoice failed: %v", err)
+		}
+		numbers = append(numbers, invoice.Number)
+	}
+
+	next, err := st.CreateInvoice(DefaultUserID, testInvoice(issued.AddDate(1, 0, 0)), yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+	numbers = append(numbers, next.Number)
+
+	expected := []string{"2026-0001", "2026-0002", "2026-0003", "2027-0001"}
+	for i := range expected {
+		if numbers[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, numbers)
+		}
+	}
+
+	loaded, err := st.GetInvoice(DefaultUserID, next.ID)
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if loaded.Number != "2027-0001" || len(loaded.LineItems) != 1 || loaded.LineItems[0].Amount != 100 {
+		t.Errorf("Unexpected invoice: %+v", loaded)
+	}
+	if !loaded.DueDate.Equal(next.DueDate) {
+		t.Errorf("Expected due date %v, got %v", next.DueDate, loaded.DueDate)
+	}
+}
+
+func TestCreateInvoiceFailedFinalizeLeavesNoGap(t *testing.T) {
+	st := openTestStore(t)
+	issued := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+
+	renderErr := errors.New("render failed")
+	_, err := st.CreateInvoice(DefaultUserID, testInvoice(issued), yearlyNumbers{}, func(invoice *Invoice) error {
+		return renderErr
+	})
+	if !errors.Is(err, renderErr) {
+		t.Fatalf("Expected the finalize error, got %v", err)
+	}
+
+	invoice, err := st.CreateInvoice(DefaultUserID, testInvoice(issued), yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+	if invoice.Number != "2026-0001" {
+		t.Errorf("Expected the released number 2026-0001, got %s", invoice.Number)
+	}
+
+	invoices, err := st.ListInvoices(DefaultUserID, InvoiceFilter{})
+	if err != nil {
+		t.Fatalf("ListInvoices failed: %v", err)
+	}
+	if len(invoices) != 1 {
+		t.Errorf("Expected 1 stored invoice, got %d", len(invoices))
+	}
+}
+
+func TestCreateInvoiceReusesNumberReleasedMidway(t *testing.T) {
+	st := openTestStore(t)
+	issued := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+
+	// Another invoice takes 2026-0002 while 2026-0001 is being rendered
+	renderErr := errors.New("render failed")
+	_, err := st.CreateInvoice(DefaultUserID, testInvoice(issued), yearlyNumbers{}, func(invoice *Invoice) error {
+		other, err := st.CreateInvoice(DefaultUserID, testInvoice(issued), yearlyNumbers{}, nil)
+		if err != nil {
+			t.Errorf("CreateInvoice failed: %v", err)
+		} else if other.Number != "2026-0002" {
+			t.Errorf("Expected 2026-0002, got %s", other.Number)
+		}
+		return renderErr
+	})
+	if !errors.Is(err, renderErr) {
+		t.Fatalf("Expected the finalize error, got %v", err)
+	}
+
+	var numbers []string
+	for i := 0; i < 2; i++ {
+		invoice, err := st.CreateInvoice(DefaultUserID, testInvoice(issued), yearlyNumbers{}, nil)
+		if err != nil {
+			t.Fatalf("CreateInvoice failed: %v", err)
+		}
+		numbers = append(numbers, invoice.Number)
+	}
+	if numbers[0] != "2026-0001" || numbers[1] != "2026-0003" {
+		t.Errorf("Expected the released 2026-0001 and then 2026-0003, got %v", numbers)
+	}
+}
+
+func TestCreateInvoiceFinalizeDoesNotBlockWrites(t *testing.T) {
+	st := openTestStore(t)
+	issued := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+
+	rendering := make(chan struct{})
+	finish := make(chan struct{})
+	created := make(chan error, 1)
+	go func() {
+		_, err := st.CreateInvoice(DefaultUserID, testInvoice(issued), yearlyNumbers{}, func(invoice *Invoice) error {
+			close(rendering)
+			<-finish
+			return nil
+		})
+		created <- err
+	}()
+	<-rendering
+
+	// A slow render must not hold the write lock
+	started := make(chan error, 1)
+	go func() {
+		_, err := st.StartEntry(DefaultUserID, "Acme", "Website", "", time.Now())
+		started <- err
+	}()
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Errorf("StartEntry failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("StartEntry blocked while an invoice was being finalized")
+	}
+
+	close(finish)
+	if err := <-created; err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+}
+
+func TestCreateInvoiceConcurrentNumbersAreUnique(t *testing.T) {
+	st := openTestStore(t)
+	issued := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+
+	const count = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var numbers []string
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			invoice, err := st.CreateInvoice(DefaultUserID, testInvoice(issued), yearlyNumbers{}, nil)
+			if err != nil {
+				t.Errorf("CreateInvoice failed: %v", err)
+				return
+			}
+			mu.Lock()
+			numbers = append(numbers, invoice.Number)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(numbers)
+	for i, number := range numbers {
+		if expected := fmt.Sprintf("2026-%04d", i+1); number != expected {
+			t.Fatalf("Expected contiguous numbers, got %v", numbers)
+		}
+	}
+}
+
+func TestGetInvoiceNotFound(t *testing.T) {
+	st := openTestStore(t)
+
+	if _, err := st.GetInvoice(DefaultUserID, 42); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestInvoiceStatusAndPayments(t *testing.T) {
+	st := openTestStore(t)
+	issued := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+
+	created, err := st.CreateInvoice(DefaultUserID, testInvoice(issued), yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+	if created.Status != "draft" {
+		t.Errorf("Expected status draft, got %s", created.Status)
+	}
+
+	issuedAt := time.Now()
+	if _, err := st.UpdateInvoice(DefaultUserID, created.ID, func(invoice *Invoice) error {
+		invoice.Status = "issued"
+		invoice.IssuedAt = &issuedAt
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateInvoice failed: %v", err)
+	}
+
+	rejected := errors.New("rejected")
+	if _, err := st.RecordPayment(DefaultUserID, created.ID, Payment{Amount: 30, PaidOn: issued}, func(invoice *Invoice) error {
+		return rejected
+	}); !errors.Is(err, rejected) {
+		t.Fatalf("Expected the update error, got %v", err)
+	}
+
+	paid, err := st.RecordPayment(DefaultUserID, created.ID, Payment{Amount: 30, PaidOn: issued, Reference: "cheque"}, func(invoice *Invoice) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RecordPayment failed: %v", err)
+	}
+	if paid.AmountPaid != 30 || len(paid.Payments) != 1 {
+		t.Errorf("Expected one payment of 30, got %+v", paid)
+	}
+
+	loaded, err := st.GetInvoice(DefaultUserID, created.ID)
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if loaded.Status != "issued" || loaded.IssuedAt == nil || !loaded.IssuedAt.Equal(truncateTimestamp(issuedAt)) {
+		t.Errorf("Expected the issued status to persist, got %+v", loaded)
+	}
+	if loaded.AmountPaid != 30 || len(loaded.Payments) != 1 || loaded.Payments[0].Reference != "cheque" {
+		t.Errorf("Expected the payment to persist, got %+v", loaded.Payments)
+	}
+
+	if _, err := st.UpdateInvoice(DefaultUserID, 42, func(invoice *Invoice) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestListInvoicesFilter(t *testing.T) {
+	st := openTestStore(t)
+	march := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	april := time.Date(2026, 4, 1, 0, 0, 0, 0, time.Local)
+
+	for _, invoice := range []Invoice{testInvoice(march), testInvoice(april)} {
+		invoice.Status = "issued"
+		if _, err := st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, nil); err != nil {
+			t.Fatalf("CreateInvoice failed: %v", err)
+		}
+	}
+	if _, err := st.CreateInvoice(DefaultUserID, testInvoice(march), yearlyNumbers{}, nil); err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+
+	cutoff := time.Date(2026, 4, 15, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name     string
+		filter   InvoiceFilter
+		expected []string
+	}{
+		{"all", InvoiceFilter{}, []string{"2026-0003", "2026-0002", "2026-0001"}},
+		{"status", InvoiceFilter{Statuses: []string{"issued"}}, []string{"2026-0002", "2026-0001"}},
+		{"due before", InvoiceFilter{Statuses: []string{"issued"}, DueBefore: &cutoff}, []string{"2026-0001"}},
+		{"due from", InvoiceFilter{DueFrom: &cutoff}, []string{"2026-0002"}},
+		{"limit", InvoiceFilter{Limit: 1}, []string{"2026-0003"}},
+	}
+
+	for _, test := range tests {
+		invoices, err := st.ListInvoices(DefaultUserID, test.filter)
+		if err != nil {
+			t.Fatalf("%s: ListInvoices failed: %v", test.name, err)
+		}
+		var numbers []string
+		for _, invoice := range invoices {
+			numbers = append(numbers, invoice.Number)
+		}
+		if fmt.Sprint(numbers) != fmt.Sprint(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, numbers)
+		}
+	}
+}
+
+func TestOpenAddsMissingInvoiceColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "time_tracker.db")
+
+	// An invoices table as created before statuses and tax were tracked
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE invoices (
+		id INTEGER NOT NULL, number VARCHAR NOT NULL UNIQUE, client_name VARCHAR NOT NULL,
+		client_email VARCHAR NOT NULL, line_items TEXT NOT NULL, subtotal REAL NOT NULL,
+		total REAL NOT NULL, notes TEXT, issue_date DATE NOT NULL, due_date DATE NOT NULL,
+		pdf_path VARCHAR, created_at DATETIME NOT NULL, PRIMARY KEY (id))`)
+	if err == nil {
+		_, err = db.Exec(`INSERT INTO invoices (number, client_name, client_email, line_items,
+			subtotal, total, issue_date, due_date, created_at)
+			VALUES ('2025-0001', 'Client', 'client@example.com', '[]', 100, 100,
+			'2025-01-01', '2025-01-31', '2025-01-01 09:00:00.000000')`)
+	}
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+
+	st, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer st.Close()
+
+	invoice, err := st.GetInvoice(DefaultUserID, 1)
+	if err != nil {
+		t.Fatalf("GetInvoice failed: %v", err)
+	}
+	if invoice.Status != "draft" || invoice.Tax != 0 || invoice.Total != 100 || invoice.UserID != DefaultUserID {
+		t.Errorf("Expected defaults for the added columns, got %+v", invoice)
+	}
+
+	// The rebuilt table only keeps numbers unique per user
+	user, err := st.CreateUser("alice", time.Now())
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	other, err := st.CreateInvoice(user.ID, testInvoice(time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local)), yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+	if other.Number != "2025-0001" {
+		t.Errorf("Expected the user's own sequence, got %s", other.Number)
+	}
+}
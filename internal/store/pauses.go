@@ -0,0 +1,172 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTimerPaused    = errors.New("the timer is paused")
+	ErrTimerNotPaused = errors.New("the timer is not paused")
+)
+
+// Pause is an interval during which a running entry was paused. End is nil
+// while the entry is still paused.
+type Pause struct {
+	Start time.Time
+	End   *time.Time
+}
+
+// Paused reports whether the entry is paused right now.
+func (e *TimeEntry) Paused() bool {
+	return len(e.Pauses) > 0 && e.Pauses[len(e.Pauses)-1].End == nil
+}
+
+// ActiveTime returns how long the entry was tracked after since, leaving
+// out its pauses. Running entries and open pauses count up to now.
+func (e *TimeEntry) ActiveTime(since, now time.Time) time.Duration {
+	start, end := e.StartTime, now
+	if e.EndTime != nil {
+		end = *e.EndTime
+	}
+	if start.Before(since) {
+		start = since
+	}
+	if !end.After(start) {
+		return 0
+	}
+
+	active := end.Sub(start)
+	for _, pause := range e.Pauses {
+		pauseStart, pauseEnd := pause.Start, end
+		if pause.End != nil && pause.End.Before(end) {
+			pauseEnd = *pause.End
+		}
+		if pauseStart.Before(start) {
+			pauseStart = start
+		}
+		if pauseEnd.After(pauseStart) {
+			active -= pauseEnd.Sub(pauseStart)
+		}
+	}
+	return active
+}
+
+// entryPauses returns the pauses of the entries with the given IDs, oldest
+// first, keyed by entry ID.
+func entryPauses(q queryer, ids ...int) (map[int][]Pause, error) {
+	pauses := map[int][]Pause{}
+	if len(ids) == 0 {
+		return pauses, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.Query(`SELECT time_entry_id, CAST(start_time AS TEXT), CAST(end_time AS TEXT)
+		FROM time_entry_pauses WHERE time_entry_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+		ORDER BY start_time, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pauses: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryID int
+		var start string
+		var end sql.NullString
+		if err := rows.Scan(&entryID, &start, &end); err != nil {
+			return nil, err
+		}
+
+		var pause Pause
+		if pause.Start, err = parseTimestamp(start); err != nil {
+			return nil, fmt.Errorf("pause of time entry %d: %w", entryID, err)
+		}
+		if pause.End, err = parseNullableTimestamp(end); err != nil {
+			return nil, fmt.Errorf("pause of time entry %d: %w", entryID, err)
+		}
+		pauses[entryID] = append(pauses[entryID], pause)
+	}
+	return pauses, rows.Err()
+}
+
+// PauseEntry pauses the user's running timer at the given time. It fails
+// with ErrNoTimerRunning if the user is not tracking anything and with
+// ErrTimerPaused if the timer is paused already.
+func (s *SQLiteStore) PauseEntry(userID int, at time.Time) (*TimeEntry, error) {
+	at = truncateTimestamp(at)
+	var entry *TimeEntry
+	err := s.withTx(func(tx *sql.Tx) error {
+		running, err := runningEntry(tx, userID)
+		if err != nil {
+			return err
+		}
+		if running == nil {
+			return ErrNoTimerRunning
+		}
+		if running.Paused() {
+			return ErrTimerPaused
+		}
+
+		if _, err := tx.Exec(`INSERT INTO time_entry_pauses (time_entry_id, start_time) VALUES (?, ?)`,
+			running.ID, formatTimestamp(at)); err != nil {
+			return fmt.Errorf("failed to pause time entry %d: %w", running.ID, err)
+		}
+
+		running.Pauses = append(running.Pauses, Pause{Start: at})
+		entry = running
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ResumeEntry resumes the user's paused timer at the given time. It fails
+// with ErrNoTimerRunning if the user is not tracking anything and with
+// ErrTimerNotPaused if the timer is not paused.
+func (s *SQLiteStore) ResumeEntry(userID int, at time.Time) (*TimeEntry, error) {
+	at = truncateTimestamp(at)
+	var entry *TimeEntry
+	err := s.withTx(func(tx *sql.Tx) error {
+		running, err := runningEntry(tx, userID)
+		if err != nil {
+			return err
+		}
+		if running == nil {
+			return ErrNoTimerRunning
+		}
+		if !running.Paused() {
+			return ErrTimerNotPaused
+		}
+
+		if err := endPause(tx, running, at); err != nil {
+			return err
+		}
+		entry = running
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// endPause ends the open pause of entry at the given time, which must not
+// be before the pause began.
+func endPause(tx *sql.Tx, entry *TimeEntry, at time.Time) error {
+	if _, err := tx.Exec(`UPDATE time_entry_pauses SET end_time = ? WHERE time_entry_id = ? AND end_time IS NULL`,
+		formatTimestamp(at), entry.ID); err != nil {
+		return fmt.Errorf("failed to resume time entry %d: %w", entry.ID, err)
+	}
+	if entry.Paused() {
+		entry.Pauses[len(entry.Pauses)-1].End = &at
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPauseAndResumeEntry(t *testing.T) {
+	st := openTestStore(t)
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+
+	if _, err := st.PauseEntry(DefaultUserID, start); !errors.Is(err, ErrNoTimerRunning) {
+		t.Errorf("Expected ErrNoTimerRunning, got %v", err)
+	}
+	if _, err := st.StartEntry(DefaultUserID, "Acme", "Website", "", start); err != nil {
+		t.Fatalf("StartEntry failed: %v", err)
+	}
+	if _, err := st.ResumeEntry(DefaultUserID, start); !errors.Is(err, ErrTimerNotPaused) {
+		t.Errorf("Expected ErrTimerNotPaused, got %v", err)
+	}
+
+	// A lunch break from 12:00 to 13:00
+	paused, err := st.PauseEntry(DefaultUserID, start.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("PauseEntry failed: %v", err)
+	}
+	if !paused.Paused() {
+		t.Errorf("Expected the entry to be paused, got %+v", paused.Pauses)
+	}
+	if _, err := st.PauseEntry(DefaultUserID, start.Add(3*time.Hour)); !errors.Is(err, ErrTimerPaused) {
+		t.Errorf("Expected ErrTimerPaused, got %v", err)
+	}
+	if running, err := st.RunningEntry(DefaultUserID); err != nil || !running.Paused() {
+		t.Errorf("Expected the running entry to be paused, got %+v, %v", running, err)
+	}
+	if _, err := st.ResumeEntry(DefaultUserID, start.Add(4*time.Hour)); err != nil {
+		t.Fatalf("ResumeEntry failed: %v", err)
+	}
+
+	// Stopping during a second pause ends the entry when the pause began
+	if _, err := st.PauseEntry(DefaultUserID, start.Add(8*time.Hour)); err != nil {
+		t.Fatalf("PauseEntry failed: %v", err)
+	}
+	stopped, err := st.StopEntry(DefaultUserID, start.Add(9*time.Hour))
+	if err != nil {
+		t.Fatalf("StopEntry failed: %v", err)
+	}
+	if !stopped.EndTime.Equal(start.Add(8*time.Hour)) || len(stopped.Pauses) != 1 {
+		t.Errorf("Expected the entry to end at 17:00 with one pause, got %v, %+v", stopped.EndTime, stopped.Pauses)
+	}
+
+	entries, err := st.ListEntries(DefaultUserID, EntryFilter{})
+	if err != nil {
+		t.Fatalf("ListEntries failed: %v", err)
+	}
+	if len(entries) != 1 || len(entries[0].Pauses) != 1 || entries[0].Pauses[0].End == nil {
+		t.Fatalf("Expected one completed pause, got %+v", entries)
+	}
+	if active := entries[0].ActiveTime(time.Time{}, time.Now()); active != 7*time.Hour {
+		t.Errorf("Expected 7 active hours, got %v", active)
+	}
+	if active := entries[0].ActiveTime(start.Add(2*time.Hour), time.Now()); active != 5*time.Hour {
+		t.Errorf("Expected 5 active hours since 11:00, got %v", active)
+	}
+
+	if err := st.DeleteEntry(DefaultUserID, stopped.ID); err != nil {
+		t.Fatalf("DeleteEntry failed: %v", err)
+	}
+	if pauses, err := entryPauses(st.db, stopped.ID); err != nil || len(pauses) != 0 {
+		t.Errorf("Expected the pauses to be deleted, got %+v, %v", pauses, err)
+	}
+}
+
+func TestUpdateEntryEndsPause(t *testing.T) {
+	st := openTestStore(t)
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+
+	entry, err := st.StartEntry(DefaultUserID, "Acme", "Website", "", start)
+	if err != nil {
+		t.Fatalf("StartEntry failed: %v", err)
+	}
+	if _, err := st.PauseEntry(DefaultUserID, start.Add(time.Hour)); err != nil {
+		t.Fatalf("PauseEntry failed: %v", err)
+	}
+
+	end := start.Add(2 * time.Hour)
+	updated, err := st.UpdateEntry(DefaultUserID, entry.ID, func(entry *TimeEntry) error {
+		entry.EndTime = &end
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	found, err := st.GetEntry(DefaultUserID, entry.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if updated.Paused() || found.Paused() || !found.Pauses[0].End.Equal(end) {
+		t.Errorf("Expected the pause to end with the entry, got %+v", found.Pauses)
+	}
+	if active := found.ActiveTime(time.Time{}, time.Now()); active != time.Hour {
+		t.Errorf("Expected one active hour, got %v", active)
+	}
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrProjectExists = errors.New("a project with this name already exists")
+	ErrUnknownClient = errors.New("client does not exist")
+	// ErrUnknownProject means a project ID is not one of the user's.
+	ErrUnknownProject = errors.New("project does not exist")
+)
+
+// Project is a row of the projects table. Name is what time entries record
+// as their project.
+type Project struct {
+	ID       int
+	UserID   int
+	ClientID *int
+	Name     string
+	// BillingMode is "hourly" or "fixed".
+	BillingMode string
+	// HourlyRate of zero means the project bills its client's rate.
+	HourlyRate float64
+	FixedFee   float64
+	// Budgets of zero mean the project has none.
+	BudgetHours  float64
+	BudgetAmount float64
+	ArchivedAt   *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// ProjectStore persists each user's projects.
+type ProjectStore interface {
+	CreateProject(userID int, project Project) (*Project, error)
+	GetProject(userID, id int) (*Project, error)
+	GetProjectByName(userID int, name string) (*Project, error)
+	ListProjects(userID int, includeArchived bool) ([]Project, error)
+	UpdateProject(userID, id int, update func(project *Project) error) (*Project, error)
+	DeleteProject(userID, id int) error
+}
+
+const projectColumns = `id, user_id, client_id, name, billing_mode, hourly_rate, fixed_fee, budget_hours,
+	budget_amount, CAST(archived_at AS TEXT), CAST(created_at AS TEXT), CAST(updated_at AS TEXT)`
+
+func scanProject(row rowScanner) (*Project, error) {
+	var project Project
+	var clientID sql.NullInt64
+	var archivedAt sql.NullString
+	var createdAt, updatedAt string
+	if err := row.Scan(&project.ID, &project.UserID, &clientID, &project.Name, &project.BillingMode, &project.HourlyRate,
+		&project.FixedFee, &project.BudgetHours, &project.BudgetAmount, &archivedAt, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	if clientID.Valid {
+		id := int(clientID.Int64)
+		project.ClientID = &id
+	}
+
+	var err error
+	if project.ArchivedAt, err = parseNullableTimestamp(archivedAt); err != nil {
+		return nil, fmt.Errorf("project %d: %w", project.ID, err)
+	}
+	if project.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("project %d: %w", project.ID, err)
+	}
+	if project.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+		return nil, fmt.Errorf("project %d: %w", project.ID, err)
+	}
+	return &project, nil
+}
+
+func getProject(q queryer, condition string, args ...interface{}) (*Project, error) {
+	project, err := scanProject(q.QueryRow(`SELECT `+projectColumns+` FROM projects WHERE `+condition, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load project: %w", err)
+	}
+	return project, nil
+}
+
+// checkProject returns ErrProjectExists if another of the user's projects
+// is called project.Name, and ErrUnknownClient if its client is not one of
+// the user's.
+func checkProject(tx *sql.Tx, userID int, project *Project) error {
+	var existing int
+	err := tx.QueryRow(`SELECT id FROM projects WHERE user_id = ? AND name = ? AND id != ?`,
+		userID, project.Name, project.ID).Scan(&existing)
+	if err == nil {
+		return fmt.Errorf("%w: %s", ErrProjectExists, project.Name)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to check project %s: %w", project.Name, err)
+	}
+
+	if project.ClientID == nil {
+		return nil
+	}
+	if _, err := getClient(tx, userID, *project.ClientID); errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: %d", ErrUnknownClient, *project.ClientID)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateProject stores a new project for the user. It fails with
+// ErrProjectExists if the user already has one with the same name and with
+// ErrUnknownClient if its client is not the user's.
+func (s *SQLiteStore) CreateProject(userID int, project Project) (*Project, error) {
+	project.ID = 0
+	project.UserID = userID
+	project.CreatedAt = truncateTimestamp(time.Now())
+	project.UpdatedAt = project.CreatedAt
+
+	err := s.withTx(func(tx *sql.Tx) error {
+		if err := checkProject(tx, userID, &project); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`INSERT INTO projects (user_id, client_id, name, billing_mode, hourly_rate, fixed_fee,
+			budget_hours, budget_amount, archived_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, userID, project.ClientID, project.Name, project.BillingMode,
+			project.HourlyRate, project.FixedFee, project.BudgetHours, project.BudgetAmount,
+			nullableTimestamp(project.ArchivedAt), formatTimestamp(project.CreatedAt), formatTimestamp(project.UpdatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to create project: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to read project id: %w", err)
+		}
+		project.ID = int(id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// GetProject returns the user's project with the given ID or ErrNotFound.
+func (s *SQLiteStore) GetProject(userID, id int) (*Project, error) {
+	return getProject(s.db, `id = ? AND user_id = ?`, id, userID)
+}
+
+// GetProjectByName returns the user's project called name or ErrNotFound.
+func (s *SQLiteStore) GetProjectByName(userID int, name string) (*Project, error) {
+	return getProject(s.db, `name = ? AND user_id = ?`, name, userID)
+}
+
+// ListProjects returns the user's projects ordered by name, leaving out
+// archived ones unless includeArchived is set.
+func (s *SQLiteStore) ListProjects(userID int, includeArchived bool) ([]Project, error) {
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE user_id = ?`
+	if !includeArchived {
+		query += ` AND archived_at IS NULL`
+	}
+
+	rows, err := s.db.Query(query+` ORDER BY name, id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	defer rows.Close()
+
+	projects := []Project{}
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, *project)
+	}
+	return projects, rows.Err()
+}
+
+// UpdateProject loads the project, lets update modify it and saves the
+// result in a single transaction, checking it like CreateProject.
+func (s *SQLiteStore) UpdateProject(userID, id int, update func(project *Project) error) (*Project, error) {
+	var project *Project
+	err := s.withTx(func(tx *sql.Tx) error {
+		current, err := getProject(tx, `id = ? AND user_id = ?`, id, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := update(current); err != nil {
+			return err
+		}
+		if err := checkProject(tx, userID, current); err != nil {
+			return err
+		}
+
+		current.UpdatedAt = truncateTimestamp(time.Now())
+		if _, err := tx.Exec(`UPDATE projects
+			SET client_id = ?, name = ?, billing_mode = ?, hourly_rate = ?, fixed_fee = ?, budget_hours = ?,
+				budget_amount = ?, archived_at = ?, updated_at = ?
+			WHERE id = ?`, current.ClientID, current.Name, current.BillingMode, current.HourlyRate, current.FixedFee,
+			current.BudgetHours, current.BudgetAmount, nullableTimestamp(current.ArchivedAt),
+			formatTimestamp(current.UpdatedAt), id); err != nil {
+			return fmt.Errorf("failed to update project %d: %w", id, err)
+		}
+
+		project = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// DeleteProject removes the user's project with the given ID along with its
+// rate changes. Time entries recorded against it keep its name.
+func (s *SQLiteStore) DeleteProject(userID, id int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := getProject(tx, `id = ? AND user_id = ?`, id, userID); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM rate_changes WHERE project_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete rate changes of project %d: %w", id, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM projects WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete project %d: %w", id, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProjects(t *testing.T) {
+	st := openTestStore(t)
+	client, err := st.CreateClient(DefaultUserID, Client{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+
+	project, err := st.CreateProject(DefaultUserID, Project{
+		ClientID:     &client.ID,
+		Name:         "Website",
+		BillingMode:  "hourly",
+		HourlyRate:   120,
+		BudgetHours:  40,
+		BudgetAmount: 4800,
+	})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	if _, err := st.CreateProject(DefaultUserID, Project{Name: "Website", BillingMode: "hourly"}); !errors.Is(err, ErrProjectExists) {
+		t.Errorf("Expected ErrProjectExists, got %v", err)
+	}
+	missing := 99
+	if _, err := st.CreateProject(DefaultUserID, Project{Name: "App", BillingMode: "hourly", ClientID: &missing}); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("Expected ErrUnknownClient, got %v", err)
+	}
+
+	found, err := st.GetProjectByName(DefaultUserID, "Website")
+	if err != nil {
+		t.Fatalf("GetProjectByName failed: %v", err)
+	}
+	if found.ID != project.ID || found.ClientID == nil || *found.ClientID != client.ID || found.HourlyRate != 120 ||
+		found.BudgetHours != 40 || found.BudgetAmount != 4800 || found.ArchivedAt != nil {
+		t.Errorf("Unexpected project: %+v", found)
+	}
+
+	// Clients with projects cannot be deleted
+	if err := st.DeleteClient(DefaultUserID, client.ID); !errors.Is(err, ErrClientInUse) {
+		t.Errorf("Expected ErrClientInUse, got %v", err)
+	}
+
+	archivedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	archived, err := st.UpdateProject(DefaultUserID, project.ID, func(p *Project) error {
+		p.ClientID = nil
+		p.BillingMode = "fixed"
+		p.FixedFee = 2000
+		p.ArchivedAt = &archivedAt
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateProject failed: %v", err)
+	}
+	if archived.ClientID != nil || archived.BillingMode != "fixed" || archived.ArchivedAt == nil || !archived.ArchivedAt.Equal(archivedAt) {
+		t.Errorf("Unexpected update: %+v", archived)
+	}
+
+	if _, err := st.CreateProject(DefaultUserID, Project{Name: "App", BillingMode: "hourly"}); err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+	active, err := st.ListProjects(DefaultUserID, false)
+	if err != nil {
+		t.Fatalf("ListProjects failed: %v", err)
+	}
+	if len(active) != 1 || active[0].Name != "App" {
+		t.Errorf("Expected only the active project, got %+v", active)
+	}
+	all, err := st.ListProjects(DefaultUserID, true)
+	if err != nil {
+		t.Fatalf("ListProjects failed: %v", err)
+	}
+	if len(all) != 2 || all[0].Name != "App" || all[1].Name != "Website" {
+		t.Errorf("Expected every project ordered by name, got %+v", all)
+	}
+
+	if err := st.DeleteProject(DefaultUserID, project.ID); err != nil {
+		t.Errorf("DeleteProject failed: %v", err)
+	}
+	if _, err := st.GetProject(DefaultUserID, project.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestProjectsAreScopedToUser(t *testing.T) {
+	st := openTestStore(t)
+	alice, err := st.CreateUser("alice", time.Now())
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	client, err := st.CreateClient(DefaultUserID, Client{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	project, err := st.CreateProject(DefaultUserID, Project{Name: "Website", BillingMode: "hourly"})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+
+	if _, err := st.CreateProject(alice.ID, Project{Name: "Website", BillingMode: "hourly"}); err != nil {
+		t.Errorf("Expected names to be unique per user, got %v", err)
+	}
+	if _, err := st.CreateProject(alice.ID, Project{Name: "App", BillingMode: "hourly", ClientID: &client.ID}); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("Expected ErrUnknownClient for another user's client, got %v", err)
+	}
+	if _, err := st.GetProject(alice.ID, project.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for another user's project, got %v", err)
+	}
+	if err := st.DeleteProject(alice.ID, project.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting another user's project, got %v", err)
+	}
+}
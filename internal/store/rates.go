@@ -0,0 +1,146 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RateChange is a row of the rate_changes table: an hourly rate that applies
+// to time tracked from EffectiveFrom on. It belongs to a client if ClientID
+// is set, to a project if ProjectID is set, and is the user's own default
+// rate if neither is.
+type RateChange struct {
+	ID        int
+	UserID    int
+	ClientID  *int
+	ProjectID *int
+	// HourlyRate of zero means the level has no rate from then on.
+	HourlyRate float64
+	// EffectiveFrom is a date; only its year, month and day are stored.
+	EffectiveFrom time.Time
+	CreatedAt     time.Time
+}
+
+// RateStore persists each user's dated rate changes.
+type RateStore interface {
+	CreateRateChange(userID int, change RateChange) (*RateChange, error)
+	ListRateChanges(userID int) ([]RateChange, error)
+	DeleteRateChange(userID, id int) error
+}
+
+const rateChangeColumns = `id, user_id, client_id, project_id, hourly_rate, CAST(effective_from AS TEXT),
+	CAST(created_at AS TEXT)`
+
+func scanRateChange(row rowScanner) (*RateChange, error) {
+	var change RateChange
+	var clientID, projectID sql.NullInt64
+	var effectiveFrom, createdAt string
+	if err := row.Scan(&change.ID, &change.UserID, &clientID, &projectID, &change.HourlyRate, &effectiveFrom,
+		&createdAt); err != nil {
+		return nil, err
+	}
+
+	if clientID.Valid {
+		id := int(clientID.Int64)
+		change.ClientID = &id
+	}
+	if projectID.Valid {
+		id := int(projectID.Int64)
+		change.ProjectID = &id
+	}
+
+	var err error
+	if change.EffectiveFrom, err = time.ParseInLocation(dateLayout, effectiveFrom, time.Local); err != nil {
+		return nil, fmt.Errorf("rate change %d: %w", change.ID, err)
+	}
+	if change.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("rate change %d: %w", change.ID, err)
+	}
+	return &change, nil
+}
+
+// CreateRateChange stores a new rate change for the user. It fails with
+// ErrUnknownClient or ErrUnknownProject if the change belongs to a client
+// or project that is not the user's.
+func (s *SQLiteStore) CreateRateChange(userID int, change RateChange) (*RateChange, error) {
+	change.ID = 0
+	change.UserID = userID
+	change.EffectiveFrom = time.Date(change.EffectiveFrom.Year(), change.EffectiveFrom.Month(),
+		change.EffectiveFrom.Day(), 0, 0, 0, 0, time.Local)
+	change.CreatedAt = truncateTimestamp(time.Now())
+
+	err := s.withTx(func(tx *sql.Tx) error {
+		if change.ClientID != nil {
+			if _, err := getClient(tx, userID, *change.ClientID); errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("%w: %d", ErrUnknownClient, *change.ClientID)
+			} else if err != nil {
+				return err
+			}
+		}
+		if change.ProjectID != nil {
+			if _, err := getProject(tx, `id = ? AND user_id = ?`, *change.ProjectID, userID); errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("%w: %d", ErrUnknownProject, *change.ProjectID)
+			} else if err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.Exec(`INSERT INTO rate_changes (user_id, client_id, project_id, hourly_rate, effective_from,
+			created_at) VALUES (?, ?, ?, ?, ?, ?)`, userID, change.ClientID, change.ProjectID, change.HourlyRate,
+			change.EffectiveFrom.Format(dateLayout), formatTimestamp(change.CreatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to create rate change: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to read rate change id: %w", err)
+		}
+		change.ID = int(id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// ListRateChanges returns the user's rate changes in the order they take
+// effect.
+func (s *SQLiteStore) ListRateChanges(userID int) ([]RateChange, error) {
+	rows, err := s.db.Query(`SELECT `+rateChangeColumns+` FROM rate_changes WHERE user_id = ?
+		ORDER BY effective_from, id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rate changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []RateChange{}
+	for rows.Next() {
+		change, err := scanRateChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, *change)
+	}
+	return changes, rows.Err()
+}
+
+// DeleteRateChange removes the user's rate change with the given ID or
+// returns ErrNotFound.
+func (s *SQLiteStore) DeleteRateChange(userID, id int) error {
+	result, err := s.db.Exec(`DELETE FROM rate_changes WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete rate change %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete rate change %d: %w", id, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
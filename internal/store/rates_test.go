@@ -0,0 +1,102 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateChanges(t *testing.T) {
+	st := openTestStore(t)
+	client, err := st.CreateClient(DefaultUserID, Client{Name: "Acme"})
+	if err != nil {
+		t.Fatalf("CreateClient failed: %v", err)
+	}
+	project, err := st.CreateProject(DefaultUserID, Project{Name: "Website", BillingMode: "hourly"})
+	if err != nil {
+		t.Fatalf("CreateProject failed: %v", err)
+	}
+
+	july := time.Date(2026, 7, 1, 15, 30, 0, 0, time.Local)
+	change, err := st.CreateRateChange(DefaultUserID, RateChange{ProjectID: &project.ID, HourlyRate: 150, EffectiveFrom: july})
+	if err != nil {
+		t.Fatalf("CreateRateChange failed: %v", err)
+	}
+	if !change.EffectiveFrom.Equal(time.Date(2026, 7, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Expected the change to take effect at the start of the day, got %v", change.EffectiveFrom)
+	}
+	if _, err := st.CreateRateChange(DefaultUserID, RateChange{ClientID: &client.ID, HourlyRate: 100, EffectiveFrom: july.AddDate(0, -1, 0)}); err != nil {
+		t.Fatalf("CreateRateChange failed: %v", err)
+	}
+	missing := 99
+	if _, err := st.CreateRateChange(DefaultUserID, RateChange{ClientID: &missing, EffectiveFrom: july}); !errors.Is(err, ErrUnknownClient) {
+		t.Errorf("Expected ErrUnknownClient, got %v", err)
+	}
+	if _, err := st.CreateRateChange(DefaultUserID, RateChange{ProjectID: &missing, EffectiveFrom: july}); !errors.Is(err, ErrUnknownProject) {
+		t.Errorf("Expected ErrUnknownProject, got %v", err)
+	}
+
+	changes, err := st.ListRateChanges(DefaultUserID)
+	if err != nil {
+		t.Fatalf("ListRateChanges failed: %v", err)
+	}
+	if len(changes) != 2 || changes[0].ClientID == nil || changes[1].ID != change.ID || changes[1].HourlyRate != 150 {
+		t.Errorf("Expected the client's change first, got %+v", changes)
+	}
+
+	// Other users see none of them
+	alice, err := st.CreateUser("alice", time.Now())
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if changes, err := st.ListRateChanges(alice.ID); err != nil || len(changes) != 0 {
+		t.Errorf("Expected no rate changes for another user, got %+v, %v", changes, err)
+	}
+	if _, err := st.CreateRateChange(alice.ID, RateChange{ProjectID: &project.ID, EffectiveFrom: july}); !errors.Is(err, ErrUnknownProject) {
+		t.Errorf("Expected ErrUnknownProject for another user's project, got %v", err)
+	}
+	if err := st.DeleteRateChange(alice.ID, change.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting another user's rate change, got %v", err)
+	}
+
+	// Projects and clients take their rate changes with them
+	if err := st.DeleteProject(DefaultUserID, project.ID); err != nil {
+		t.Fatalf("DeleteProject failed: %v", err)
+	}
+	if err := st.DeleteClient(DefaultUserID, client.ID); err != nil {
+		t.Fatalf("DeleteClient failed: %v", err)
+	}
+	if changes, err := st.ListRateChanges(DefaultUserID); err != nil || len(changes) != 0 {
+		t.Errorf("Expected the rate changes to be deleted, got %+v, %v", changes, err)
+	}
+}
+
+func TestEntryRates(t *testing.T) {
+	st := openTestStore(t)
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	end := start.Add(time.Hour)
+	rate := 120.0
+
+	created, err := st.CreateEntry(DefaultUserID, TimeEntry{Client: "Acme", Project: "Website", StartTime: start, EndTime: &end, HourlyRate: &rate})
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+	found, err := st.GetEntry(DefaultUserID, created.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if found.HourlyRate == nil || *found.HourlyRate != 120 {
+		t.Errorf("Expected the entry's own rate, got %v", found.HourlyRate)
+	}
+
+	updated, err := st.UpdateEntry(DefaultUserID, created.ID, func(entry *TimeEntry) error {
+		entry.HourlyRate = nil
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if found, err := st.GetEntry(DefaultUserID, created.ID); err != nil || found.HourlyRate != nil || updated.HourlyRate != nil {
+		t.Errorf("Expected the rate to be removed, got %+v, %v", found, err)
+	}
+}
@@ -0,0 +1,412 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	ErrNotFound       = errors.New("record not found")
+	ErrTimerRunning   = errors.New("a timer is already running")
+	ErrNoTimerRunning = errors.New("no timer is running")
+	ErrAlreadyBilled  = errors.New("time entry is already billed")
+	ErrEntryChanged   = errors.New("time entry changed")
+)
+
+// timestampLayout matches the naive local timestamps SQLAlchemy writes for
+// DateTime columns, so rows created here stay readable by kb-tt-cli.
+const timestampLayout = "2006-01-02 15:04:05.000000"
+
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02T15:04:05.999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339Nano,
+}
+
+// SQLiteStore reads and writes the kb-tt-cli SQLite database directly.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// Open opens the database at path and makes sure the tables used by the API
+// exist. The database file is created if it does not exist yet.
+func Open(path string) (*SQLiteStore, error) {
+	// Writers take the lock when their transaction begins, so let them wait
+	// a while for one another instead of failing
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=30000&_txlock=immediate&_foreign_keys=on", path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	s := &SQLiteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) migrate() error {
+	for _, stmt := range schema {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+
+	for _, column := range addedColumns {
+		exists, err := s.hasColumn(column.table, column.name)
+		if err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+		if exists {
+			continue
+		}
+		if _, err := s.db.Exec(`ALTER TABLE ` + column.table + ` ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+
+	if err := s.scopeInvoiceNumbersByUser(); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	for _, stmt := range indexes {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) hasColumn(table, name string) (bool, error) {
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return false, err
+		}
+		if column == name {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// schema mirrors the tables created by kb-tt-cli so a fresh database works
+// with both the API and the Python CLI, followed by the tables only the API
+// uses.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS time_entries (
+		id INTEGER NOT NULL,
+		client VARCHAR NOT NULL,
+		project VARCHAR NOT NULL,
+		description TEXT,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME,
+		PRIMARY KEY (id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS users (
+		id INTEGER NOT NULL,
+		name VARCHAR NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (id)
+	)`,
+	`INSERT OR IGNORE INTO users (id, name, created_at)
+		VALUES (1, 'default', strftime('%Y-%m-%d %H:%M:%f', 'now', 'localtime'))`,
+	// Owners of time entries, kept apart from kb-tt-cli's table like billing.
+	// Entries without a row here belong to DefaultUserID.
+	`CREATE TABLE IF NOT EXISTS time_entry_users (
+		time_entry_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL REFERENCES users (id),
+		PRIMARY KEY (time_entry_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS ix_time_entry_users_user_id ON time_entry_users (user_id)`,
+	// Hourly rates set on individual time entries, overriding the rates of
+	// their project, client and user.
+	`CREATE TABLE IF NOT EXISTS time_entry_rates (
+		time_entry_id INTEGER NOT NULL,
+		hourly_rate REAL NOT NULL,
+		PRIMARY KEY (time_entry_id)
+	)`,
+	// Pauses of time entries. The entry's end time in time_entries still
+	// spans them, so kb-tt-cli counts paused time as tracked.
+	`CREATE TABLE IF NOT EXISTS time_entry_pauses (
+		id INTEGER NOT NULL,
+		time_entry_id INTEGER NOT NULL,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME,
+		PRIMARY KEY (id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS ix_time_entry_pauses_time_entry_id ON time_entry_pauses (time_entry_id)`,
+	`CREATE TABLE IF NOT EXISTS invoice_sequences (
+		scope VARCHAR NOT NULL,
+		next_value INTEGER NOT NULL,
+		PRIMARY KEY (scope)
+	)`,
+	// Numbers reserved for invoices that were never stored, handed out
+	// again before the sequence moves on.
+	`CREATE TABLE IF NOT EXISTS released_invoice_numbers (
+		scope VARCHAR NOT NULL,
+		value INTEGER NOT NULL,
+		PRIMARY KEY (scope, value)
+	)`,
+	`CREATE TABLE IF NOT EXISTS clients (
+		id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL REFERENCES users (id),
+		name VARCHAR NOT NULL,
+		legal_name VARCHAR,
+		emails TEXT NOT NULL,
+		billing_address TEXT,
+		tax_id VARCHAR,
+		currency VARCHAR,
+		payment_terms_days INTEGER,
+		hourly_rate REAL NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (id)
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS ux_clients_user_name ON clients (user_id, name)`,
+	`CREATE TABLE IF NOT EXISTS projects (
+		id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL REFERENCES users (id),
+		client_id INTEGER REFERENCES clients (id),
+		name VARCHAR NOT NULL,
+		billing_mode VARCHAR NOT NULL DEFAULT 'hourly',
+		hourly_rate REAL NOT NULL DEFAULT 0,
+		fixed_fee REAL NOT NULL DEFAULT 0,
+		budget_hours REAL NOT NULL DEFAULT 0,
+		budget_amount REAL NOT NULL DEFAULT 0,
+		archived_at DATETIME,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (id)
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS ux_projects_user_name ON projects (user_id, name)`,
+	`CREATE TABLE IF NOT EXISTS rate_changes (
+		id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL REFERENCES users (id),
+		client_id INTEGER REFERENCES clients (id),
+		project_id INTEGER REFERENCES projects (id),
+		hourly_rate REAL NOT NULL,
+		effective_from DATE NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS ix_rate_changes_user_id ON rate_changes (user_id)`,
+	invoicesTable("invoices"),
+	`CREATE TABLE IF NOT EXISTS invoice_payments (
+		id INTEGER NOT NULL,
+		invoice_id INTEGER NOT NULL REFERENCES invoices (id),
+		amount REAL NOT NULL,
+		paid_on DATE NOT NULL,
+		reference VARCHAR,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS ix_invoice_payments_invoice_id ON invoice_payments (invoice_id)`,
+	// Links invoices to the time entries they bill. time_entries belongs to
+	// kb-tt-cli, so billing is tracked here rather than in a column there.
+	`CREATE TABLE IF NOT EXISTS invoice_time_entries (
+		invoice_id INTEGER NOT NULL REFERENCES invoices (id),
+		time_entry_id INTEGER NOT NULL,
+		PRIMARY KEY (invoice_id, time_entry_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS ix_invoice_time_entries_time_entry_id ON invoice_time_entries (time_entry_id)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER NOT NULL,
+		name VARCHAR NOT NULL,
+		prefix VARCHAR NOT NULL,
+		key_hash VARCHAR NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		user_id INTEGER NOT NULL DEFAULT 1 REFERENCES users (id),
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME,
+		revoked_at DATETIME,
+		PRIMARY KEY (id)
+	)`,
+}
+
+// addedColumns lists columns added to tables after they were first created,
+// so older databases are upgraded in place. CREATE TABLE statements in
+// schema include them too.
+var addedColumns = []struct {
+	table, name, definition string
+}{
+	{"invoices", "status", "VARCHAR NOT NULL DEFAULT 'draft'"},
+	{"invoices", "issued_at", "DATETIME"},
+	{"invoices", "sent_at", "DATETIME"},
+	{"invoices", "paid_at", "DATETIME"},
+	{"invoices", "voided_at", "DATETIME"},
+	{"invoices", "tax_rate", "REAL NOT NULL DEFAULT 0"},
+	{"invoices", "tax", "REAL NOT NULL DEFAULT 0"},
+	{"invoices", "user_id", "INTEGER NOT NULL DEFAULT 1"},
+	{"api_keys", "user_id", "INTEGER NOT NULL DEFAULT 1"},
+	{"invoices", "client_id", "INTEGER REFERENCES clients (id)"},
+	{"invoices", "currency", "VARCHAR"},
+}
+
+// invoicesTable returns the statement creating the invoices table as name.
+// Invoice numbers are unique per user, see ux_invoices_user_number.
+func invoicesTable(name string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + name + ` (
+		id INTEGER NOT NULL,
+		number VARCHAR NOT NULL,
+		user_id INTEGER NOT NULL DEFAULT 1 REFERENCES users (id),
+		client_name VARCHAR NOT NULL,
+		client_email VARCHAR NOT NULL,
+		line_items TEXT NOT NULL,
+		subtotal REAL NOT NULL,
+		total REAL NOT NULL,
+		notes TEXT,
+		issue_date DATE NOT NULL,
+		due_date DATE NOT NULL,
+		pdf_path VARCHAR,
+		created_at DATETIME NOT NULL,
+		status VARCHAR NOT NULL DEFAULT 'draft',
+		issued_at DATETIME,
+		sent_at DATETIME,
+		paid_at DATETIME,
+		voided_at DATETIME,
+		tax_rate REAL NOT NULL DEFAULT 0,
+		tax REAL NOT NULL DEFAULT 0,
+		client_id INTEGER REFERENCES clients (id),
+		currency VARCHAR,
+		PRIMARY KEY (id)
+	)`
+}
+
+// invoiceColumnNames are the columns of the invoices table, in the order
+// invoicesTable creates them.
+const invoiceColumnNames = `id, number, user_id, client_name, client_email, line_items, subtotal, total,
+	notes, issue_date, due_date, pdf_path, created_at, status, issued_at, sent_at, paid_at, voided_at,
+	tax_rate, tax, client_id, currency`
+
+// scopeInvoiceNumbersByUser rebuilds invoices tables created when invoice
+// numbers were unique across the whole database, since a UNIQUE column
+// constraint cannot be dropped in place. Foreign keys are suspended so
+// payments and billed time entries keep pointing at their invoices.
+func (s *SQLiteStore) scopeInvoiceNumbersByUser() error {
+	var definition string
+	if err := s.db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'invoices'`).Scan(&definition); err != nil {
+		return err
+	}
+	if !strings.Contains(definition, "number VARCHAR NOT NULL UNIQUE") {
+		return nil
+	}
+
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		invoicesTable("invoices_rebuilt"),
+		`INSERT INTO invoices_rebuilt (` + invoiceColumnNames + `) SELECT ` + invoiceColumnNames + ` FROM invoices`,
+		`DROP TABLE invoices`,
+		`ALTER TABLE invoices_rebuilt RENAME TO invoices`,
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// indexes are created once addedColumns exist.
+var indexes = []string{
+	`CREATE UNIQUE INDEX IF NOT EXISTS ux_invoices_user_number ON invoices (user_id, number)`,
+	`CREATE INDEX IF NOT EXISTS ix_api_keys_user_id ON api_keys (user_id)`,
+}
+
+// withTx runs fn inside a transaction, committing on success.
+func (s *SQLiteStore) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.In(time.Local).Format(timestampLayout)
+}
+
+// nullableTimestamp formats t for a nullable DATETIME column.
+func nullableTimestamp(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatTimestamp(*t)
+}
+
+// truncateTimestamp drops the precision the database cannot hold, so values
+// returned after a write match what a later read produces.
+func truncateTimestamp(t time.Time) time.Time {
+	return t.Truncate(time.Microsecond)
+}
+
+// parseNullableTimestamp parses a nullable DATETIME column.
+func parseNullableTimestamp(value sql.NullString) (*time.Time, error) {
+	if !value.Valid || value.String == "" {
+		return nil, nil
+	}
+	t, err := parseTimestamp(value.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", value)
+}
@@ -0,0 +1,547 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeEntry is a row of the time_entries table.
+type TimeEntry struct {
+	ID int
+	// UserID owns the entry. It is read-only.
+	UserID      int
+	Client      string
+	Project     string
+	Description string
+	StartTime   time.Time
+	EndTime     *time.Time
+	// InvoiceID is the invoice billing the entry, if any. It is read-only.
+	InvoiceID *int
+	// HourlyRate, if set, overrides the rates of the entry's project,
+	// client and user.
+	HourlyRate *float64
+	// Pauses are the intervals the entry was paused, oldest first. They are
+	// read-only; see PauseEntry and ResumeEntry.
+	Pauses []Pause
+}
+
+// truncate drops precision the database cannot store.
+func (e *TimeEntry) truncate() {
+	e.StartTime = truncateTimestamp(e.StartTime)
+	if e.EndTime != nil {
+		end := truncateTimestamp(*e.EndTime)
+		e.EndTime = &end
+	}
+}
+
+// TimeEntryStore is the storage used by the time tracker service. Every
+// method only sees the entries of the given user.
+type TimeEntryStore interface {
+	StartEntry(userID int, client, project, description string, at time.Time) (*TimeEntry, error)
+	StopEntry(userID int, at time.Time) (*TimeEntry, error)
+	SwitchEntry(userID int, client, project, description string, at time.Time) (stopped, started *TimeEntry, err error)
+	PauseEntry(userID int, at time.Time) (*TimeEntry, error)
+	ResumeEntry(userID int, at time.Time) (*TimeEntry, error)
+	RunningEntry(userID int) (*TimeEntry, error)
+	ListEntries(userID int, filter EntryFilter) ([]TimeEntry, error)
+	EntriesSince(userID int, since time.Time) ([]TimeEntry, error)
+	CreateEntry(userID int, entry TimeEntry) (*TimeEntry, error)
+	GetEntry(userID, id int) (*TimeEntry, error)
+	UpdateEntry(userID, id int, update func(entry *TimeEntry) error) (*TimeEntry, error)
+	DeleteEntry(userID, id int) error
+}
+
+// entryOwnerColumn selects the user owning a time_entries row; entries
+// kb-tt-cli recorded have no owner row and belong to DefaultUserID (1).
+const entryOwnerColumn = `COALESCE((SELECT o.user_id FROM time_entry_users o
+	WHERE o.time_entry_id = time_entries.id), 1)`
+
+// Datetime columns are cast to text so the driver does not reinterpret the
+// naive local timestamps as UTC.
+const timeEntryColumns = `id, ` + entryOwnerColumn + `, client, project, COALESCE(description, ''),
+	CAST(start_time AS TEXT), CAST(end_time AS TEXT), ` + billingInvoiceColumn + `,
+	(SELECT r.hourly_rate FROM time_entry_rates r WHERE r.time_entry_id = time_entries.id)`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanTimeEntry(row rowScanner) (*TimeEntry, error) {
+	var entry TimeEntry
+	var startTime string
+	var endTime sql.NullString
+	var invoiceID sql.NullInt64
+	var hourlyRate sql.NullFloat64
+	if err := row.Scan(&entry.ID, &entry.UserID, &entry.Client, &entry.Project, &entry.Description, &startTime, &endTime,
+		&invoiceID, &hourlyRate); err != nil {
+		return nil, err
+	}
+	if invoiceID.Valid {
+		id := int(invoiceID.Int64)
+		entry.InvoiceID = &id
+	}
+	if hourlyRate.Valid {
+		entry.HourlyRate = &hourlyRate.Float64
+	}
+
+	start, err := parseTimestamp(startTime)
+	if err != nil {
+		return nil, fmt.Errorf("time entry %d: %w", entry.ID, err)
+	}
+	entry.StartTime = start
+
+	if endTime.Valid && endTime.String != "" {
+		end, err := parseTimestamp(endTime.String)
+		if err != nil {
+			return nil, fmt.Errorf("time entry %d: %w", entry.ID, err)
+		}
+		entry.EndTime = &end
+	}
+
+	return &entry, nil
+}
+
+// scanTimeEntries reads the entries of rows and loads their pauses
+// through q.
+func scanTimeEntries(q queryer, rows *sql.Rows) ([]TimeEntry, error) {
+	entries := []TimeEntry{}
+	var ids []int
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, *entry)
+		ids = append(ids, entry.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pauses, err := entryPauses(q, ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Pauses = pauses[entries[i].ID]
+	}
+	return entries, nil
+}
+
+// loadPauses loads the pauses of a single entry.
+func loadPauses(q queryer, entry *TimeEntry) error {
+	pauses, err := entryPauses(q, entry.ID)
+	if err != nil {
+		return err
+	}
+	entry.Pauses = pauses[entry.ID]
+	return nil
+}
+
+func runningEntry(q queryer, userID int) (*TimeEntry, error) {
+	row := q.QueryRow(`SELECT `+timeEntryColumns+` FROM time_entries
+		WHERE end_time IS NULL AND `+entryOwnerColumn+` = ? ORDER BY start_time DESC LIMIT 1`, userID)
+	entry, err := scanTimeEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load running entry: %w", err)
+	}
+	return entry, loadPauses(q, entry)
+}
+
+// setEntryOwner records that userID owns the entry.
+func setEntryOwner(tx *sql.Tx, entryID, userID int) error {
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO time_entry_users (time_entry_id, user_id) VALUES (?, ?)`,
+		entryID, userID); err != nil {
+		return fmt.Errorf("failed to record owner of time entry %d: %w", entryID, err)
+	}
+	return nil
+}
+
+// setEntryRate records the entry's own hourly rate, or removes it if rate
+// is nil.
+func setEntryRate(tx *sql.Tx, entryID int, rate *float64) error {
+	var err error
+	if rate == nil {
+		_, err = tx.Exec(`DELETE FROM time_entry_rates WHERE time_entry_id = ?`, entryID)
+	} else {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO time_entry_rates (time_entry_id, hourly_rate) VALUES (?, ?)`,
+			entryID, *rate)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record rate of time entry %d: %w", entryID, err)
+	}
+	return nil
+}
+
+// StartEntry starts a new timer for the user at the given time. It fails
+// with ErrTimerRunning if another of the user's entries has not been
+// stopped yet.
+func (s *SQLiteStore) StartEntry(userID int, client, project, description string, at time.Time) (*TimeEntry, error) {
+	at = truncateTimestamp(at)
+	var entry *TimeEntry
+	err := s.withTx(func(tx *sql.Tx) error {
+		running, err := runningEntry(tx, userID)
+		if err != nil {
+			return err
+		}
+		if running != nil {
+			return ErrTimerRunning
+		}
+
+		entry, err = insertEntry(tx, userID, client, project, description, at)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// insertEntry inserts a running entry for the user.
+func insertEntry(tx *sql.Tx, userID int, client, project, description string, at time.Time) (*TimeEntry, error) {
+	result, err := tx.Exec(`INSERT INTO time_entries (client, project, description, start_time)
+		VALUES (?, ?, ?, ?)`, client, project, description, formatTimestamp(at))
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert time entry: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read time entry id: %w", err)
+	}
+	if err := setEntryOwner(tx, int(id), userID); err != nil {
+		return nil, err
+	}
+
+	return &TimeEntry{
+		ID:          int(id),
+		UserID:      userID,
+		Client:      client,
+		Project:     project,
+		Description: description,
+		StartTime:   at,
+	}, nil
+}
+
+// StopEntry stops the user's running timer at the given time. A paused
+// timer stops when its pause began, since the pause is not tracked time. It
+// fails with ErrNoTimerRunning if the user is not tracking anything.
+func (s *SQLiteStore) StopEntry(userID int, at time.Time) (*TimeEntry, error) {
+	at = truncateTimestamp(at)
+	var entry *TimeEntry
+	err := s.withTx(func(tx *sql.Tx) error {
+		running, err := runningEntry(tx, userID)
+		if err != nil {
+			return err
+		}
+		if running == nil {
+			return ErrNoTimerRunning
+		}
+
+		end := at
+		if running.Paused() {
+			end = running.Pauses[len(running.Pauses)-1].Start
+		}
+		if err := stopEntry(tx, running, end); err != nil {
+			return err
+		}
+		entry = running
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// SwitchEntry stops the user's running timer and starts a new one at the
+// same time, in a single transaction. A paused timer stays paused until
+// then, so the pause is not tracked by either entry. It fails with
+// ErrNoTimerRunning if the user is not tracking anything.
+func (s *SQLiteStore) SwitchEntry(userID int, client, project, description string, at time.Time) (stopped, started *TimeEntry, err error) {
+	at = truncateTimestamp(at)
+	err = s.withTx(func(tx *sql.Tx) error {
+		running, err := runningEntry(tx, userID)
+		if err != nil {
+			return err
+		}
+		if running == nil {
+			return ErrNoTimerRunning
+		}
+
+		if running.Paused() {
+			if err := endPause(tx, running, at); err != nil {
+				return err
+			}
+		}
+		if err := stopEntry(tx, running, at); err != nil {
+			return err
+		}
+		stopped = running
+
+		started, err = insertEntry(tx, userID, client, project, description, at)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return stopped, started, nil
+}
+
+// stopEntry ends the running entry at the given time. An open pause is
+// dropped, so a paused entry should end when its pause began.
+func stopEntry(tx *sql.Tx, entry *TimeEntry, end time.Time) error {
+	if entry.Paused() {
+		if _, err := tx.Exec(`DELETE FROM time_entry_pauses WHERE time_entry_id = ? AND end_time IS NULL`, entry.ID); err != nil {
+			return fmt.Errorf("failed to stop time entry: %w", err)
+		}
+		entry.Pauses = entry.Pauses[:len(entry.Pauses)-1]
+	}
+
+	if _, err := tx.Exec(`UPDATE time_entries SET end_time = ? WHERE id = ?`, formatTimestamp(end), entry.ID); err != nil {
+		return fmt.Errorf("failed to stop time entry: %w", err)
+	}
+	entry.EndTime = &end
+	return nil
+}
+
+// RunningEntry returns the entry the user is currently tracking, or nil.
+func (s *SQLiteStore) RunningEntry(userID int) (*TimeEntry, error) {
+	return runningEntry(s.db, userID)
+}
+
+// EntryFilter narrows and orders the entries returned by ListEntries.
+type EntryFilter struct {
+	// From and To bound the start time: From is inclusive, To exclusive.
+	From *time.Time
+	To   *time.Time
+	// Client and Project match exactly when set.
+	Client  string
+	Project string
+	// Query matches anywhere in the description, ignoring case.
+	Query     string
+	Ascending bool
+	// After continues a previous listing from the given position.
+	After *EntryCursor
+	// Limit caps the number of entries; zero or less returns all of them.
+	Limit int
+}
+
+// EntryCursor is the position of an entry in start time order.
+type EntryCursor struct {
+	StartTime time.Time
+	ID        int
+}
+
+// ListEntries returns the entries matching filter, newest first unless
+// filter.Ascending is set. Entries with the same start time are ordered by ID
+// so cursors are stable.
+func (s *SQLiteStore) ListEntries(userID int, filter EntryFilter) ([]TimeEntry, error) {
+	where := []string{entryOwnerColumn + " = ?"}
+	args := []interface{}{userID}
+
+	if filter.From != nil {
+		where = append(where, "start_time >= ?")
+		args = append(args, formatTimestamp(*filter.From))
+	}
+	if filter.To != nil {
+		where = append(where, "start_time < ?")
+		args = append(args, formatTimestamp(*filter.To))
+	}
+	if filter.Client != "" {
+		where = append(where, "client = ?")
+		args = append(args, filter.Client)
+	}
+	if filter.Project != "" {
+		where = append(where, "project = ?")
+		args = append(args, filter.Project)
+	}
+	if filter.Query != "" {
+		where = append(where, `description LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(filter.Query)+"%")
+	}
+
+	order := "DESC"
+	compare := "<"
+	if filter.Ascending {
+		order = "ASC"
+		compare = ">"
+	}
+
+	if filter.After != nil {
+		after := formatTimestamp(truncateTimestamp(filter.After.StartTime))
+		where = append(where, fmt.Sprintf("(start_time %s ? OR (start_time = ? AND id %s ?))", compare, compare))
+		args = append(args, after, after, filter.After.ID)
+	}
+
+	query := `SELECT ` + timeEntryColumns + ` FROM time_entries WHERE ` + strings.Join(where, " AND ")
+	query += fmt.Sprintf(` ORDER BY start_time %s, id %s`, order, order)
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list time entries: %w", err)
+	}
+	return scanTimeEntries(s.db, rows)
+}
+
+// escapeLike escapes the LIKE wildcards in value.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// EntriesSince returns the user's entries started at or after since, oldest
+// first.
+func (s *SQLiteStore) EntriesSince(userID int, since time.Time) ([]TimeEntry, error) {
+	rows, err := s.db.Query(`SELECT `+timeEntryColumns+` FROM time_entries
+		WHERE start_time >= ? AND `+entryOwnerColumn+` = ? ORDER BY start_time ASC, id ASC`, formatTimestamp(since), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list time entries: %w", err)
+	}
+	return scanTimeEntries(s.db, rows)
+}
+
+// CreateEntry inserts a complete entry for the user, typically one recorded
+// by hand.
+func (s *SQLiteStore) CreateEntry(userID int, entry TimeEntry) (*TimeEntry, error) {
+	entry.truncate()
+	entry.UserID = userID
+
+	err := s.withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO time_entries (client, project, description, start_time, end_time)
+			VALUES (?, ?, ?, ?, ?)`, entry.Client, entry.Project, entry.Description,
+			formatTimestamp(entry.StartTime), nullableTimestamp(entry.EndTime))
+		if err != nil {
+			return fmt.Errorf("failed to insert time entry: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to read time entry id: %w", err)
+		}
+		entry.ID = int(id)
+		if err := setEntryOwner(tx, entry.ID, userID); err != nil {
+			return err
+		}
+		return setEntryRate(tx, entry.ID, entry.HourlyRate)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func getEntry(q queryer, userID, id int) (*TimeEntry, error) {
+	row := q.QueryRow(`SELECT `+timeEntryColumns+` FROM time_entries
+		WHERE id = ? AND `+entryOwnerColumn+` = ?`, id, userID)
+	entry, err := scanTimeEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time entry %d: %w", id, err)
+	}
+	return entry, loadPauses(q, entry)
+}
+
+// GetEntry returns the user's entry with the given ID or ErrNotFound.
+func (s *SQLiteStore) GetEntry(userID, id int) (*TimeEntry, error) {
+	return getEntry(s.db, userID, id)
+}
+
+// UpdateEntry loads the entry, lets update modify it and saves the result in
+// a single transaction. An error from update aborts the change. Ending a
+// paused entry also ends its pause.
+func (s *SQLiteStore) UpdateEntry(userID, id int, update func(entry *TimeEntry) error) (*TimeEntry, error) {
+	var entry *TimeEntry
+	err := s.withTx(func(tx *sql.Tx) error {
+		current, err := getEntry(tx, userID, id)
+		if err != nil {
+			return err
+		}
+
+		if err := update(current); err != nil {
+			return err
+		}
+
+		current.truncate()
+		if _, err := tx.Exec(`UPDATE time_entries
+			SET client = ?, project = ?, description = ?, start_time = ?, end_time = ?
+			WHERE id = ?`, current.Client, current.Project, current.Description,
+			formatTimestamp(current.StartTime), nullableTimestamp(current.EndTime), id); err != nil {
+			return fmt.Errorf("failed to update time entry %d: %w", id, err)
+		}
+		if err := setEntryRate(tx, id, current.HourlyRate); err != nil {
+			return err
+		}
+		if current.EndTime != nil && current.Paused() {
+			if err := endPause(tx, current, *current.EndTime); err != nil {
+				return err
+			}
+		}
+
+		entry = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// DeleteEntry removes the user's entry with the given ID. It returns
+// ErrNotFound if there is no such entry and ErrAlreadyBilled if it is on an
+// invoice that is not void.
+func (s *SQLiteStore) DeleteEntry(userID, id int) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if err := checkUnbilled(tx, userID, []int{id}); errors.Is(err, ErrNotFound) {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`DELETE FROM time_entries WHERE id = ? AND `+entryOwnerColumn+` = ?`, id, userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete time entry %d: %w", id, err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to delete time entry %d: %w", id, err)
+		}
+		if affected == 0 {
+			return ErrNotFound
+		}
+
+		if _, err := tx.Exec(`DELETE FROM time_entry_users WHERE time_entry_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete owner of time entry %d: %w", id, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM time_entry_pauses WHERE time_entry_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete pauses of time entry %d: %w", id, err)
+		}
+		// Entry IDs are reused, so the links of void invoices must not
+		// outlive the entry
+		if _, err := tx.Exec(`DELETE FROM invoice_time_entries WHERE time_entry_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete invoice links of time entry %d: %w", id, err)
+		}
+		return setEntryRate(tx, id, nil)
+	})
+}
@@ -0,0 +1,284 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	st, err := Open(filepath.Join(t.TempDir(), "time_tracker.db"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	return st
+}
+
+func TestStartAndStopEntry(t *testing.T) {
+	st := openTestStore(t)
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+	entry, err := st.StartEntry(DefaultUserID, "Test Client", "Test Project", "Test Description", start)
+	if err != nil {
+		t.Fatalf("StartEntry failed: %v", err)
+	}
+	if entry.ID == 0 {
+		t.Error("Expected a non-zero ID")
+	}
+
+	running, err := st.RunningEntry(DefaultUserID)
+	if err != nil {
+		t.Fatalf("RunningEntry failed: %v", err)
+	}
+	if running == nil || running.ID != entry.ID {
+		t.Fatalf("Expected running entry %d, got %+v", entry.ID, running)
+	}
+	if !running.StartTime.Equal(start) {
+		t.Errorf("Expected start time %v, got %v", start, running.StartTime)
+	}
+
+	end := start.Add(90 * time.Minute)
+	stopped, err := st.StopEntry(DefaultUserID, end)
+	if err != nil {
+		t.Fatalf("StopEntry failed: %v", err)
+	}
+	if stopped.ID != entry.ID || stopped.Client != "Test Client" {
+		t.Errorf("Unexpected stopped entry: %+v", stopped)
+	}
+	if stopped.EndTime == nil || !stopped.EndTime.Equal(end) {
+		t.Errorf("Expected end time %v, got %v", end, stopped.EndTime)
+	}
+
+	running, err = st.RunningEntry(DefaultUserID)
+	if err != nil {
+		t.Fatalf("RunningEntry failed: %v", err)
+	}
+	if running != nil {
+		t.Errorf("Expected no running entry, got %+v", running)
+	}
+}
+
+func TestStartEntryWhileRunning(t *testing.T) {
+	st := openTestStore(t)
+
+	if _, err := st.StartEntry(DefaultUserID, "Client", "Project", "", time.Now()); err != nil {
+		t.Fatalf("StartEntry failed: %v", err)
+	}
+
+	_, err := st.StartEntry(DefaultUserID, "Client", "Project", "", time.Now())
+	if !errors.Is(err, ErrTimerRunning) {
+		t.Errorf("Expected ErrTimerRunning, got %v", err)
+	}
+}
+
+func TestStopEntryWithoutTimer(t *testing.T) {
+	st := openTestStore(t)
+
+	_, err := st.StopEntry(DefaultUserID, time.Now())
+	if !errors.Is(err, ErrNoTimerRunning) {
+		t.Errorf("Expected ErrNoTimerRunning, got %v", err)
+	}
+}
+
+func TestSwitchEntry(t *testing.T) {
+	st := openTestStore(t)
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+	at := start.Add(2 * time.Hour)
+
+	if _, _, err := st.SwitchEntry(DefaultUserID, "Acme", "App", "", at); !errors.Is(err, ErrNoTimerRunning) {
+		t.Errorf("Expected ErrNoTimerRunning, got %v", err)
+	}
+
+	first, err := st.StartEntry(DefaultUserID, "Acme", "Website", "", start)
+	if err != nil {
+		t.Fatalf("StartEntry failed: %v", err)
+	}
+	if _, err := st.PauseEntry(DefaultUserID, start.Add(time.Hour)); err != nil {
+		t.Fatalf("PauseEntry failed: %v", err)
+	}
+
+	stopped, started, err := st.SwitchEntry(DefaultUserID, "Acme", "App", "Review", at)
+	if err != nil {
+		t.Fatalf("SwitchEntry failed: %v", err)
+	}
+	if stopped.ID != first.ID || stopped.EndTime == nil || !stopped.EndTime.Equal(at) || stopped.Paused() {
+		t.Errorf("Expected the first entry to end at the switch, got %+v", stopped)
+	}
+	if !started.StartTime.Equal(at) || started.Project != "App" || started.Description != "Review" {
+		t.Errorf("Expected the new entry to start at the switch, got %+v", started)
+	}
+	if active := stopped.ActiveTime(time.Time{}, at); active != time.Hour {
+		t.Errorf("Expected the pause to stay untracked, got %v", active)
+	}
+
+	running, err := st.RunningEntry(DefaultUserID)
+	if err != nil || running == nil || running.ID != started.ID {
+		t.Errorf("Expected entry %d to be running, got %+v, %v", started.ID, running, err)
+	}
+}
+
+func TestListEntriesAndEntriesSince(t *testing.T) {
+	st := openTestStore(t)
+	base := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+	for i := 0; i < 3; i++ {
+		start := base.Add(time.Duration(i) * 24 * time.Hour)
+		if _, err := st.StartEntry(DefaultUserID, "Client", "Project", "", start); err != nil {
+			t.Fatalf("StartEntry failed: %v", err)
+		}
+		if _, err := st.StopEntry(DefaultUserID, start.Add(time.Hour)); err != nil {
+			t.Fatalf("StopEntry failed: %v", err)
+		}
+	}
+
+	entries, err := st.ListEntries(DefaultUserID, EntryFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListEntries failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if !entries[0].StartTime.After(entries[1].StartTime) {
+		t.Error("Expected entries to be ordered newest first")
+	}
+
+	since, err := st.EntriesSince(DefaultUserID, base.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("EntriesSince failed: %v", err)
+	}
+	if len(since) != 2 {
+		t.Errorf("Expected 2 entries since the second day, got %d", len(since))
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []string{
+		"2024-01-01 09:30:00.123456",
+		"2024-01-01T09:30:00.123456",
+		"2024-01-01 09:30:00",
+	}
+
+	for _, value := range tests {
+		parsed, err := parseTimestamp(value)
+		if err != nil {
+			t.Errorf("parseTimestamp(%q) failed: %v", value, err)
+			continue
+		}
+		if parsed.Hour() != 9 || parsed.Minute() != 30 {
+			t.Errorf("parseTimestamp(%q) = %v", value, parsed)
+		}
+	}
+
+	if _, err := parseTimestamp("not a time"); err == nil {
+		t.Error("Expected an error for an invalid timestamp")
+	}
+}
+
+func TestCreateUpdateAndDeleteEntry(t *testing.T) {
+	st := openTestStore(t)
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+	end := start.Add(2 * time.Hour)
+
+	created, err := st.CreateEntry(DefaultUserID, TimeEntry{Client: "Client", Project: "Project", StartTime: start, EndTime: &end})
+	if err != nil {
+		t.Fatalf("CreateEntry failed: %v", err)
+	}
+
+	loaded, err := st.GetEntry(DefaultUserID, created.ID)
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if loaded.EndTime == nil || !loaded.EndTime.Equal(end) {
+		t.Errorf("Expected end time %v, got %v", end, loaded.EndTime)
+	}
+
+	updated, err := st.UpdateEntry(DefaultUserID, created.ID, func(entry *TimeEntry) error {
+		entry.Description = "Fixed"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if updated.Description != "Fixed" {
+		t.Errorf("Expected description 'Fixed', got '%s'", updated.Description)
+	}
+
+	abort := errors.New("abort")
+	if _, err := st.UpdateEntry(DefaultUserID, created.ID, func(entry *TimeEntry) error {
+		entry.Description = "Discarded"
+		return abort
+	}); !errors.Is(err, abort) {
+		t.Errorf("Expected the update error, got %v", err)
+	}
+	if loaded, _ := st.GetEntry(DefaultUserID, created.ID); loaded.Description != "Fixed" {
+		t.Errorf("Expected aborted update to be rolled back, got '%s'", loaded.Description)
+	}
+
+	if err := st.DeleteEntry(DefaultUserID, created.ID); err != nil {
+		t.Fatalf("DeleteEntry failed: %v", err)
+	}
+	if _, err := st.GetEntry(DefaultUserID, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := st.DeleteEntry(DefaultUserID, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestListEntriesFilter(t *testing.T) {
+	st := openTestStore(t)
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.Local)
+
+	seed := []TimeEntry{
+		{Client: "Acme", Project: "Website", Description: "Homepage layout"},
+		{Client: "Acme", Project: "Website", Description: "50% discount banner"},
+		{Client: "Acme", Project: "API", Description: "Auth endpoints"},
+		{Client: "Globex", Project: "Website", Description: "homepage copy"},
+	}
+	for i, entry := range seed {
+		entry.StartTime = base.Add(time.Duration(i) * 24 * time.Hour)
+		end := entry.StartTime.Add(time.Hour)
+		entry.EndTime = &end
+		if _, err := st.CreateEntry(DefaultUserID, entry); err != nil {
+			t.Fatalf("CreateEntry failed: %v", err)
+		}
+	}
+
+	from := base.Add(24 * time.Hour)
+	to := base.Add(3 * 24 * time.Hour)
+	tests := []struct {
+		name     string
+		filter   EntryFilter
+		expected []string
+	}{
+		{"Client", EntryFilter{Client: "Acme", Ascending: true}, []string{"Homepage layout", "50% discount banner", "Auth endpoints"}},
+		{"Project", EntryFilter{Project: "Website"}, []string{"homepage copy", "50% discount banner", "Homepage layout"}},
+		{"Date range", EntryFilter{From: &from, To: &to}, []string{"Auth endpoints", "50% discount banner"}},
+		{"Query ignores case", EntryFilter{Query: "HOMEPAGE", Ascending: true}, []string{"Homepage layout", "homepage copy"}},
+		{"Query escapes wildcards", EntryFilter{Query: "50%"}, []string{"50% discount banner"}},
+		{"Cursor", EntryFilter{After: &EntryCursor{StartTime: base.Add(24 * time.Hour), ID: 2}}, []string{"Homepage layout"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := st.ListEntries(DefaultUserID, test.filter)
+			if err != nil {
+				t.Fatalf("ListEntries failed: %v", err)
+			}
+
+			var descriptions []string
+			for _, entry := range entries {
+				descriptions = append(descriptions, entry.Description)
+			}
+			if strings.Join(descriptions, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("Expected %v, got %v", test.expected, descriptions)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultUserID is the user created with the database. It owns everything
+// recorded before there were users, and every time entry kb-tt-cli records
+// itself.
+const DefaultUserID = 1
+
+var ErrUserExists = errors.New("a user with this name already exists")
+
+// User is a row of the users table.
+type User struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+}
+
+// UserStore persists users.
+type UserStore interface {
+	CreateUser(name string, at time.Time) (*User, error)
+	GetUser(id int) (*User, error)
+	ListUsers() ([]User, error)
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	var createdAt string
+	if err := row.Scan(&user.ID, &user.Name, &createdAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if user.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("user %d: %w", user.ID, err)
+	}
+	return &user, nil
+}
+
+// CreateUser stores a new user, or fails with ErrUserExists if the name is
+// taken.
+func (s *SQLiteStore) CreateUser(name string, at time.Time) (*User, error) {
+	user := &User{Name: name, CreatedAt: truncateTimestamp(at)}
+	err := s.withTx(func(tx *sql.Tx) error {
+		var existing int
+		err := tx.QueryRow(`SELECT id FROM users WHERE name = ?`, name).Scan(&existing)
+		if err == nil {
+			return fmt.Errorf("%w: %s", ErrUserExists, name)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check user %s: %w", name, err)
+		}
+
+		result, err := tx.Exec(`INSERT INTO users (name, created_at) VALUES (?, ?)`, name, formatTimestamp(user.CreatedAt))
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to read user id: %w", err)
+		}
+		user.ID = int(id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUser returns the user with the given ID or ErrNotFound.
+func (s *SQLiteStore) GetUser(id int) (*User, error) {
+	user, err := scanUser(s.db.QueryRow(`SELECT id, name, CAST(created_at AS TEXT) FROM users WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user %d: %w", id, err)
+	}
+	return user, nil
+}
+
+// ListUsers returns every user, oldest first.
+func (s *SQLiteStore) ListUsers() ([]User, error) {
+	rows, err := s.db.Query(`SELECT id, name, CAST(created_at AS TEXT) FROM users ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
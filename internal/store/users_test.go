@@ -0,0 +1,103 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUsers(t *testing.T) {
+	st := openTestStore(t)
+
+	users, err := st.ListUsers()
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != DefaultUserID {
+		t.Errorf("Expected only the default user, got %+v", users)
+	}
+
+	user, err := st.CreateUser("alice", time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	if _, err := st.CreateUser("alice", time.Now()); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+
+	found, err := st.GetUser(user.ID)
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	if found.Name != "alice" || !found.CreatedAt.Equal(user.CreatedAt) {
+		t.Errorf("Unexpected user: %+v", found)
+	}
+	if _, err := st.GetUser(99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStoreIsScopedToUser(t *testing.T) {
+	st := openTestStore(t)
+	alice, err := st.CreateUser("alice", time.Now())
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)
+
+	// Each user has their own timer
+	mine, err := st.StartEntry(DefaultUserID, "Acme", "Web", "", start)
+	if err != nil {
+		t.Fatalf("StartEntry failed: %v", err)
+	}
+	theirs, err := st.StartEntry(alice.ID, "Globex", "App", "", start)
+	if err != nil {
+		t.Fatalf("StartEntry for a second user failed: %v", err)
+	}
+	if theirs.UserID != alice.ID {
+		t.Errorf("Expected the entry to belong to %d, got %d", alice.ID, theirs.UserID)
+	}
+	if running, err := st.RunningEntry(alice.ID); err != nil || running == nil || running.ID != theirs.ID {
+		t.Errorf("Expected the user's own running entry, got %+v, %v", running, err)
+	}
+
+	stopped, err := st.StopEntry(DefaultUserID, start.Add(time.Hour))
+	if err != nil || stopped.ID != mine.ID {
+		t.Fatalf("Expected to stop the default user's entry, got %+v, %v", stopped, err)
+	}
+	if running, err := st.RunningEntry(alice.ID); err != nil || running == nil {
+		t.Errorf("Expected the other timer to keep running, got %+v, %v", running, err)
+	}
+
+	// Entries of other users are not found
+	if _, err := st.GetEntry(alice.ID, mine.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for another user's entry, got %v", err)
+	}
+	if err := st.DeleteEntry(alice.ID, mine.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting another user's entry, got %v", err)
+	}
+	entries, err := st.ListEntries(alice.ID, EntryFilter{})
+	if err != nil {
+		t.Fatalf("ListEntries failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != theirs.ID {
+		t.Errorf("Expected only the user's entry, got %+v", entries)
+	}
+
+	// Invoices cannot bill or show another user's work
+	invoice := testInvoice(start)
+	invoice.TimeEntryIDs = []int{mine.ID}
+	if _, err := st.CreateInvoice(alice.ID, invoice, yearlyNumbers{}, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound billing another user's entry, got %v", err)
+	}
+	created, err := st.CreateInvoice(DefaultUserID, invoice, yearlyNumbers{}, nil)
+	if err != nil {
+		t.Fatalf("CreateInvoice failed: %v", err)
+	}
+	if _, err := st.GetInvoice(alice.ID, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for another user's invoice, got %v", err)
+	}
+	if invoices, err := st.ListInvoices(alice.ID, InvoiceFilter{}); err != nil || len(invoices) != 0 {
+		t.Errorf("Expected no invoices for the user, got %+v, %v", invoices, err)
+	}
+}
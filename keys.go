@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/services"
+	"kb-freelance-api/internal/store"
+)
+
+var keysUsage = `usage:
+  kb-freelance-api keys create -name NAME -scopes SCOPE[,SCOPE...] [-user ID]
+  kb-freelance-api keys list
+  kb-freelance-api keys revoke ID
+
+scopes: ` + strings.Join(services.Scopes, ", ") + `
+`
+
+// runKeys manages API keys from the command line, which is how the first
+// admin key is created. It returns the process exit code.
+func runKeys(cfg *config.Config, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, keysUsage)
+		return 2
+	}
+
+	st, err := store.Open(cfg.DatabasePath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer st.Close()
+	service := services.NewAPIKeyService(st)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		name := flags.String("name", "", "name describing who uses the key")
+		scopes := flags.String("scopes", "", "comma-separated scopes")
+		userID := flags.Int("user", store.DefaultUserID, "ID of the user the key acts for")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		key, err := service.CreateKey(ctx, *userID, *name, splitScopes(*scopes))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Created API key %d (%s) for user %d with scopes %s\n", key.ID, key.Name, key.UserID, strings.Join(key.Scopes, ", "))
+		fmt.Fprintf(stdout, "%s\n", key.Key)
+		fmt.Fprintln(stdout, "Store the key now; it cannot be shown again.")
+		return 0
+
+	case "list":
+		keys, err := service.ListKeys(ctx)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tUSER\tPREFIX\tSCOPES\tCREATED\tLAST USED\tREVOKED")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.UserID, key.Prefix, strings.Join(key.Scopes, ","),
+				key.CreatedAt.Format(time.DateTime), formatOptionalTime(key.LastUsedAt), formatOptionalTime(key.RevokedAt))
+		}
+		w.Flush()
+		return 0
+
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprint(stderr, keysUsage)
+			return 2
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid API key id %q\n", args[1])
+			return 2
+		}
+		key, err := service.RevokeKey(ctx, id)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Revoked API key %d (%s)\n", key.ID, key.Name)
+		return 0
+
+	default:
+		fmt.Fprint(stderr, keysUsage)
+		return 2
+	}
+}
+
+func splitScopes(value string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(value, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.DateTime)
+}
@@ -1,25 +1,49 @@
 package main
 
 import (
+	"context"
 	"kb-freelance-api/internal/api"
 	"kb-freelance-api/internal/config"
-	"log"
+	"kb-freelance-api/internal/logging"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/joho/godotenv"
 )
 
 func main() {
 	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		log.Printf("No .env file found, using system environment variables: %v", err)
-	}
+	envErr := godotenv.Load()
 
 	// Load configuration
 	cfg := config.Load()
 
+	logger := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	slog.SetDefault(logger)
+	if envErr != nil {
+		logger.Info("No .env file found, using system environment variables", "error", envErr)
+	}
+	logger.Debug("Configuration loaded",
+		"time_tracker_path", cfg.TimeTrackerPath,
+		"invoice_gen_path", cfg.InvoiceGenPath,
+		"python", cfg.PythonExecPath,
+		"time_tracker_backend", cfg.TimeTrackerBackend,
+		"invoice_renderer", cfg.InvoiceRenderer,
+	)
+
+	// "keys" and "users" manage API keys and users instead of starting the
+	// server
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		os.Exit(runKeys(cfg, os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		os.Exit(runUsers(cfg, os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// Create API server
-	server := api.NewServer(cfg)
+	server := api.NewServer(cfg, logger)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -27,8 +51,12 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Starting server on port %s", port)
-	if err := server.Start(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// Stop on Ctrl-C or SIGTERM, so the Python workers are stopped too
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := server.Start(ctx, ":"+port); err != nil {
+		logger.Error("Failed to start server", "error", err)
+		os.Exit(1)
 	}
 }
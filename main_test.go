@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"kb-freelance-api/internal/config"
 )
 
 func TestMain(m *testing.M) {
@@ -30,5 +35,65 @@ func TestMainFunction(t *testing.T) {
 	t.Log("Main function exists and package compiles successfully")
 }
 
+func TestKeysCommand(t *testing.T) {
+	cfg := &config.Config{DatabasePath: filepath.Join(t.TempDir(), "time_tracker.db")}
+	var stdout, stderr bytes.Buffer
+
+	if code := runKeys(cfg, []string{"create", "-name", "ci", "-scopes", "time:read, invoice:read"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("create exited with %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "invoice:read, time:read") || !strings.Contains(stdout.String(), "\nkb_") {
+		t.Errorf("Expected the new key and its scopes, got %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := runKeys(cfg, []string{"revoke", "1"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("revoke exited with %d: %s", code, stderr.String())
+	}
 
+	stdout.Reset()
+	if code := runKeys(cfg, []string{"list"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("list exited with %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "1 ") || strings.HasSuffix(lines[1], " -") {
+		t.Errorf("Expected one revoked key, got %q", stdout.String())
+	}
+
+	stderr.Reset()
+	if code := runKeys(cfg, []string{"create", "-name", "ci", "-scopes", "everything"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "unknown scope") {
+		t.Errorf("Expected an unknown scope to be rejected, got %d: %q", code, stderr.String())
+	}
+	if code := runKeys(cfg, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("Expected usage errors to exit with 2, got %d", code)
+	}
+}
 
+func TestUsersCommand(t *testing.T) {
+	cfg := &config.Config{DatabasePath: filepath.Join(t.TempDir(), "time_tracker.db")}
+	var stdout, stderr bytes.Buffer
+
+	if code := runUsers(cfg, []string{"create", "-name", "alice"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("create exited with %d: %s", code, stderr.String())
+	}
+	if code := runUsers(cfg, []string{"create", "-name", "alice"}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "already exists") {
+		t.Errorf("Expected a duplicate name to be rejected, got %d: %q", code, stderr.String())
+	}
+
+	stdout.Reset()
+	if code := runKeys(cfg, []string{"create", "-name", "alice", "-scopes", "time:read", "-user", "2"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("keys create exited with %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "for user 2") {
+		t.Errorf("Expected the key to belong to the new user, got %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := runUsers(cfg, []string{"list"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("list exited with %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[2], "2 ") || !strings.Contains(lines[2], "alice") {
+		t.Errorf("Expected the default user and alice, got %q", stdout.String())
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"kb-freelance-api/internal/config"
+	"kb-freelance-api/internal/services"
+	"kb-freelance-api/internal/store"
+)
+
+var usersUsage = `usage:
+  kb-freelance-api users create -name NAME
+  kb-freelance-api users list
+`
+
+// runUsers manages users from the command line. Give a new user a key with
+// "keys create -user ID". It returns the process exit code.
+func runUsers(cfg *config.Config, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usersUsage)
+		return 2
+	}
+
+	st, err := store.Open(cfg.DatabasePath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer st.Close()
+	service := services.NewUserService(st)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("users create", flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		name := flags.String("name", "", "unique name of the user")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		user, err := service.CreateUser(ctx, *name)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Created user %d (%s)\n", user.ID, user.Name)
+		return 0
+
+	case "list":
+		users, err := service.ListUsers(ctx)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tCREATED")
+		for _, user := range users {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", user.ID, user.Name, user.CreatedAt.Format(time.DateTime))
+		}
+		w.Flush()
+		return 0
+
+	default:
+		fmt.Fprint(stderr, usersUsage)
+		return 2
+	}
+}